@@ -1,14 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/calsync"
 	"github.com/mlvieira/bookings/internal/config"
 	"github.com/mlvieira/bookings/internal/driver"
+	"github.com/mlvieira/bookings/internal/emails"
 	"github.com/mlvieira/bookings/internal/handlers"
 	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/mailer"
+	"github.com/mlvieira/bookings/internal/outbox"
+	"github.com/mlvieira/bookings/internal/photos"
 	"github.com/mlvieira/bookings/internal/render"
 	"github.com/mlvieira/bookings/internal/routes"
 )
@@ -24,10 +38,24 @@ func main() {
 
 	defer db.SQL.Close()
 
-	defer close(app.MailChan)
-
-	app.InfoLog.Println("Starting mail server")
-	listenForMail()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app.InfoLog.Println("Starting mail worker")
+	mailCtx, stopMail := context.WithCancel(context.Background())
+	mailDone := make(chan struct{})
+	go func() {
+		app.Outbox.Run(mailCtx)
+		close(mailDone)
+	}()
+
+	app.InfoLog.Println("Starting calendar sync")
+	syncCtx, stopSync := context.WithCancel(context.Background())
+	syncDone := make(chan struct{})
+	go func() {
+		app.CalendarSync.Run(syncCtx)
+		close(syncDone)
+	}()
 
 	fmt.Printf("Starting aplication on http://localhost%s\n", app.Port)
 
@@ -36,7 +64,28 @@ func main() {
 		Handler: routes.Routes(&app),
 	}
 
-	log.Fatal(srv.ListenAndServe())
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	app.InfoLog.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		app.ErrorLog.Println(err)
+	}
+
+	stopSync()
+	<-syncDone
+
+	// stop the mail worker only once no request can queue more mail
+	stopMail()
+	<-mailDone
 }
 
 func run() (*driver.DB, error) {
@@ -52,6 +101,13 @@ func run() (*driver.DB, error) {
 	app.TemplateCache = tc
 	app.UseCache = app.InProduction
 	app.Port = ":8080"
+	app.BaseURL = "http://localhost:8080"
+
+	signingKey, err := loadSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	app.SigningKey = signingKey
 
 	db, err := driver.ConnectSQL("dev:dev@/bookings?parseTime=true")
 	if err != nil {
@@ -62,8 +118,104 @@ func run() (*driver.DB, error) {
 
 	repo := handlers.NewRepo(&app, db)
 	handlers.NewHandlers(repo)
+
+	app.Mail, err = loadMailConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := mailer.New(app.Mail)
+	if err != nil {
+		return nil, err
+	}
+
+	app.Emails, err = emails.New("./email-templates")
+	if err != nil {
+		return nil, err
+	}
+
+	app.Photos, err = photos.New(getenv("BOOKINGS_PHOTO_DIR", "./uploads/photos"), photos.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	app.Outbox = outbox.New(repo.DB, m.Send, outbox.Options{
+		ErrorLog: app.ErrorLog,
+		InfoLog:  app.InfoLog,
+	})
+	app.CalendarSync = calsync.New(repo.DB, calsync.Options{
+		ErrorLog: app.ErrorLog,
+		InfoLog:  app.InfoLog,
+	})
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
 
 	return db, nil
 }
+
+// loadSigningKey reads the key used to sign guest links from BOOKINGS_SIGNING_KEY.
+// A random key is generated when it is not set, which invalidates links on restart.
+func loadSigningKey() ([]byte, error) {
+	if key := os.Getenv("BOOKINGS_SIGNING_KEY"); key != "" {
+		return []byte(key), nil
+	}
+
+	app.InfoLog.Println("BOOKINGS_SIGNING_KEY not set, generating a temporary signing key")
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// loadMailConfig reads the outgoing mail settings from BOOKINGS_MAIL_* and BOOKINGS_SMTP_*
+// environment variables. The defaults deliver to a local development SMTP server.
+func loadMailConfig() (config.MailConfig, error) {
+	cfg := config.MailConfig{
+		Transport:    getenv("BOOKINGS_MAIL_TRANSPORT", "smtp"),
+		Host:         getenv("BOOKINGS_SMTP_HOST", "localhost"),
+		Username:     os.Getenv("BOOKINGS_SMTP_USERNAME"),
+		Password:     os.Getenv("BOOKINGS_SMTP_PASSWORD"),
+		Encryption:   getenv("BOOKINGS_SMTP_ENCRYPTION", "none"),
+		DKIMDomain:   os.Getenv("BOOKINGS_DKIM_DOMAIN"),
+		DKIMSelector: os.Getenv("BOOKINGS_DKIM_SELECTOR"),
+		From:         getenv("BOOKINGS_MAIL_FROM", "noreply@bookings.com"),
+		DropDir:      getenv("BOOKINGS_MAIL_DROP_DIR", "./tmp/mail"),
+	}
+
+	port, err := strconv.Atoi(getenv("BOOKINGS_SMTP_PORT", "1025"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid BOOKINGS_SMTP_PORT: %w", err)
+	}
+	cfg.Port = port
+
+	if keyFile := os.Getenv("BOOKINGS_DKIM_KEY_FILE"); keyFile != "" {
+		cfg.DKIMPrivateKey, err = os.ReadFile(keyFile)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	for _, email := range strings.Split(os.Getenv("BOOKINGS_OWNER_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			cfg.OwnerEmails = append(cfg.OwnerEmails, email)
+		}
+	}
+
+	if len(cfg.OwnerEmails) == 0 {
+		app.InfoLog.Println("BOOKINGS_OWNER_EMAILS not set, owner notifications are disabled")
+	}
+
+	return cfg, nil
+}
+
+// getenv returns the environment variable key or def when it is not set
+func getenv(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return def
+}
@@ -11,11 +11,9 @@ require (
 require (
 	github.com/asaskevich/govalidator v0.0.0-20230301143203-a9d515a09cc2
 	github.com/go-sql-driver/mysql v1.8.1
+	github.com/toorop/go-dkim v0.0.0-20201103131630-e1cd1a0a5208
+	github.com/xhit/go-simple-mail/v2 v2.16.0
+	golang.org/x/crypto v0.29.0
 )
 
-require (
-	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/toorop/go-dkim v0.0.0-20201103131630-e1cd1a0a5208 // indirect
-	github.com/xhit/go-simple-mail/v2 v2.16.0 // indirect
-	golang.org/x/crypto v0.29.0 // indirect
-)
+require filippo.io/edwards25519 v1.1.0 // indirect
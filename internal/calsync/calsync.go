@@ -0,0 +1,290 @@
+// Package calsync imports the iCalendar feeds other booking sites publish for our
+// rooms. A background worker polls every configured feed and keeps its events in
+// sync as External room restrictions, so those dates can't be booked here.
+package calsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mlvieira/bookings/internal/ical"
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// Store is the part of the database repository the sync needs
+type Store interface {
+	PolledCalendarImports() ([]models.CalendarImport, error)
+	SyncExternalBlocks(imp models.CalendarImport, blocks []models.RoomRestriction) (models.CalendarSyncResult, error)
+	UpdateCalendarImportStatus(id int, syncedAt time.Time, syncErr string) error
+}
+
+// Options sets how often the poller fetches the calendars with a URL and how much of a
+// feed it accepts, uploads included. Unset fields use the defaults below.
+type Options struct {
+	// Interval is how often every feed is fetched
+	Interval time.Duration
+	// Timeout bounds fetching a single feed
+	Timeout time.Duration
+	// MaxFeedSize is the largest feed, in bytes, that is read
+	MaxFeedSize int64
+	// Client fetches the feeds. A client with Timeout is used when it is nil.
+	Client   *http.Client
+	ErrorLog *log.Logger
+	InfoLog  *log.Logger
+}
+
+const (
+	defaultInterval    = 30 * time.Minute
+	defaultTimeout     = 30 * time.Second
+	defaultMaxFeedSize = 5 << 20
+	// maxUIDLength is the size of the uid column; longer UIDs are stored hashed
+	maxUIDLength = 255
+	// maxReasonLength is the size of the reason column
+	maxReasonLength = 255
+)
+
+var (
+	// ErrFeedTooLarge is returned when a feed is larger than MaxFeedSize
+	ErrFeedTooLarge = errors.New("calendar feed is too large")
+	// ErrNoURL is returned when syncing an import that only takes uploaded files
+	ErrNoURL = errors.New("calendar import has no URL")
+)
+
+// Syncer fetches external calendars and reconciles their events
+type Syncer struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+
+	// mu serialises syncs so a feed is never reconciled twice at once
+	mu sync.Mutex
+}
+
+// New creates a syncer backed by store
+func New(store Store, opts Options) *Syncer {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.MaxFeedSize <= 0 {
+		opts.MaxFeedSize = defaultMaxFeedSize
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: opts.Timeout}
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = log.Default()
+	}
+	if opts.InfoLog == nil {
+		opts.InfoLog = log.Default()
+	}
+
+	return &Syncer{
+		store: store,
+		opts:  opts,
+		now:   time.Now,
+	}
+}
+
+// MaxFeedSize returns the largest feed, in bytes, that is imported
+func (s *Syncer) MaxFeedSize() int64 {
+	return s.opts.MaxFeedSize
+}
+
+// Run syncs every feed on start and then once per interval until ctx is cancelled
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.SyncAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncAll syncs every import that has a URL. Failures are recorded on the import
+// and logged; they don't stop the other imports from syncing.
+func (s *Syncer) SyncAll(ctx context.Context) {
+	imports, err := s.store.PolledCalendarImports()
+	if err != nil {
+		s.opts.ErrorLog.Println("loading calendar imports:", err)
+		return
+	}
+
+	for _, imp := range imports {
+		if ctx.Err() != nil {
+			return
+		}
+
+		result, err := s.Sync(ctx, imp)
+		if err != nil {
+			s.opts.ErrorLog.Printf("syncing calendar %d (%s) of room %d: %v", imp.ID, imp.Name, imp.RoomID, err)
+			continue
+		}
+
+		if result.Conflicts > 0 {
+			s.opts.ErrorLog.Printf("calendar %d (%s) of room %d overlaps %d reservations or blocks", imp.ID, imp.Name, imp.RoomID, result.Conflicts)
+		}
+	}
+}
+
+// Sync fetches the feed of an import and reconciles its events
+func (s *Syncer) Sync(ctx context.Context, imp models.CalendarImport) (models.CalendarSyncResult, error) {
+	if imp.URL == "" {
+		return models.CalendarSyncResult{}, ErrNoURL
+	}
+
+	body, err := s.fetch(ctx, imp.URL)
+	if err != nil {
+		return models.CalendarSyncResult{}, s.record(imp, err)
+	}
+	defer body.Close()
+
+	return s.Import(imp, body)
+}
+
+// Import reconciles the events of an iCalendar stream, such as an uploaded file, with
+// the blocks of an import. The outcome is recorded on the import.
+func (s *Syncer) Import(imp models.CalendarImport, r io.Reader) (models.CalendarSyncResult, error) {
+	// one byte more than the limit tells a feed at the limit from a larger one
+	limited := &io.LimitedReader{R: r, N: s.opts.MaxFeedSize + 1}
+
+	events, err := ical.Parse(limited)
+	if limited.N == 0 {
+		err = ErrFeedTooLarge
+	}
+	if err != nil {
+		return models.CalendarSyncResult{}, s.record(imp, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.store.SyncExternalBlocks(imp, Blocks(imp, events))
+	return result, s.record(imp, err)
+}
+
+// record saves the time and outcome of a sync and returns err
+func (s *Syncer) record(imp models.CalendarImport, err error) error {
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+
+	if uerr := s.store.UpdateCalendarImportStatus(imp.ID, s.now(), msg); uerr != nil {
+		s.opts.ErrorLog.Println("updating calendar import:", uerr)
+	}
+
+	return err
+}
+
+// fetch downloads a feed. webcal:// URLs, as handed out by many sites, are fetched over https.
+func (s *Syncer) fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	if rest, ok := strings.CutPrefix(url, "webcal://"); ok {
+		url = "https://" + rest
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("calendar feed returned %s", resp.Status)
+	}
+
+	return &cancelBody{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// cancelBody releases the request context once the feed has been read
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Blocks turns the events of an external calendar into External room restrictions.
+// Cancelled events are left out, so their blocks are removed.
+func Blocks(imp models.CalendarImport, events []ical.Event) []models.RoomRestriction {
+	var blocks []models.RoomRestriction
+
+	for _, e := range events {
+		if e.Status == "CANCELLED" {
+			continue
+		}
+
+		reason := imp.Name
+		if summary := strings.TrimSpace(e.Summary); summary != "" {
+			reason += ": " + summary
+		}
+
+		blocks = append(blocks, models.RoomRestriction{
+			StartDate:        e.Start,
+			EndDate:          e.End,
+			RoomID:           imp.RoomID,
+			RestrictionID:    models.RestrictionExternal,
+			CalendarImportID: imp.ID,
+			UID:              storedUID(e.UID),
+			Reason:           truncate(reason, maxReasonLength),
+		})
+	}
+
+	return blocks
+}
+
+// storedUID returns the UID as stored, hashing UIDs too long for the column
+func storedUID(uid string) string {
+	if len(uid) <= maxUIDLength {
+		return uid
+	}
+
+	sum := sha256.Sum256([]byte(uid))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
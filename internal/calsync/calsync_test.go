@@ -0,0 +1,191 @@
+package calsync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+const feed = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:stay-1@channel.example.com\r\n" +
+	"DTSTART;VALUE=DATE:20501217\r\n" +
+	"DTEND;VALUE=DATE:20501220\r\n" +
+	"SUMMARY:Reserved\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:stay-2@channel.example.com\r\n" +
+	"DTSTART;VALUE=DATE:20501222\r\n" +
+	"DTEND;VALUE=DATE:20501224\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+// fakeStore records what the syncer saved
+type fakeStore struct {
+	imports []models.CalendarImport
+	synced  map[int][]models.RoomRestriction
+	status  map[int]string
+}
+
+func newFakeStore(imports ...models.CalendarImport) *fakeStore {
+	return &fakeStore{
+		imports: imports,
+		synced:  make(map[int][]models.RoomRestriction),
+		status:  make(map[int]string),
+	}
+}
+
+func (s *fakeStore) PolledCalendarImports() ([]models.CalendarImport, error) {
+	return s.imports, nil
+}
+
+func (s *fakeStore) SyncExternalBlocks(imp models.CalendarImport, blocks []models.RoomRestriction) (models.CalendarSyncResult, error) {
+	s.synced[imp.ID] = blocks
+	return models.CalendarSyncResult{Added: len(blocks)}, nil
+}
+
+func (s *fakeStore) UpdateCalendarImportStatus(id int, syncedAt time.Time, syncErr string) error {
+	s.status[id] = syncErr
+	return nil
+}
+
+func quietOptions(client *http.Client) Options {
+	return Options{
+		Client:   client,
+		ErrorLog: log.New(io.Discard, "", 0),
+		InfoLog:  log.New(io.Discard, "", 0),
+	}
+}
+
+func TestSyncAll(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendar.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		io.WriteString(w, feed)
+	}))
+	defer ts.Close()
+
+	host := strings.TrimPrefix(ts.URL, "https://")
+
+	store := newFakeStore(
+		models.CalendarImport{ID: 1, RoomID: 4, Name: "Channel", URL: ts.URL + "/calendar.ics"},
+		models.CalendarImport{ID: 2, RoomID: 4, Name: "Webcal", URL: "webcal://" + host + "/calendar.ics"},
+		models.CalendarImport{ID: 3, RoomID: 4, Name: "Gone", URL: ts.URL + "/missing.ics"},
+	)
+
+	New(store, quietOptions(ts.Client())).SyncAll(context.Background())
+
+	for _, id := range []int{1, 2} {
+		blocks := store.synced[id]
+		if len(blocks) != 1 {
+			t.Fatalf("import %d: expected the cancelled event to be left out, got %d blocks", id, len(blocks))
+		}
+
+		b := blocks[0]
+		if b.UID != "stay-1@channel.example.com" || b.RoomID != 4 || b.CalendarImportID != id ||
+			b.RestrictionID != models.RestrictionExternal {
+			t.Errorf("import %d: unexpected block %+v", id, b)
+		}
+
+		if !b.StartDate.Equal(time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC)) || !b.EndDate.Equal(time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("import %d: unexpected dates %s to %s", id, b.StartDate, b.EndDate)
+		}
+
+		if store.status[id] != "" {
+			t.Errorf("import %d: expected a successful sync, got %q", id, store.status[id])
+		}
+	}
+
+	if store.synced[1][0].Reason != "Channel: Reserved" {
+		t.Errorf("unexpected reason %q", store.synced[1][0].Reason)
+	}
+
+	if _, ok := store.synced[3]; ok {
+		t.Error("expected a failed fetch to leave the blocks alone")
+	}
+
+	if !strings.Contains(store.status[3], "404") {
+		t.Errorf("expected the failed fetch to be recorded, got %q", store.status[3])
+	}
+}
+
+func TestImport(t *testing.T) {
+	imp := models.CalendarImport{ID: 1, RoomID: 4, Name: "Offline"}
+
+	t.Run("Uploaded file", func(t *testing.T) {
+		store := newFakeStore()
+
+		result, err := New(store, quietOptions(nil)).Import(imp, strings.NewReader(feed))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Added != 1 || len(store.synced[1]) != 1 {
+			t.Errorf("expected one block, got %+v", result)
+		}
+	})
+
+	t.Run("Too large", func(t *testing.T) {
+		store := newFakeStore()
+		opts := quietOptions(nil)
+		opts.MaxFeedSize = 64
+
+		_, err := New(store, opts).Import(imp, strings.NewReader(feed))
+		if !errors.Is(err, ErrFeedTooLarge) {
+			t.Fatalf("expected ErrFeedTooLarge, got %v", err)
+		}
+
+		if store.status[1] != ErrFeedTooLarge.Error() {
+			t.Errorf("expected the error to be recorded, got %q", store.status[1])
+		}
+	})
+
+	t.Run("Not a calendar", func(t *testing.T) {
+		store := newFakeStore()
+
+		_, err := New(store, quietOptions(nil)).Import(imp, strings.NewReader("<html></html>"))
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		if _, ok := store.synced[1]; ok {
+			t.Error("expected the blocks to be left alone")
+		}
+	})
+}
+
+func TestSyncWithoutURL(t *testing.T) {
+	_, err := New(newFakeStore(), quietOptions(nil)).Sync(context.Background(), models.CalendarImport{ID: 1})
+	if !errors.Is(err, ErrNoURL) {
+		t.Errorf("expected ErrNoURL, got %v", err)
+	}
+}
+
+func TestBlocksLongValues(t *testing.T) {
+	blocks := Blocks(models.CalendarImport{ID: 1, Name: "Channel"}, nil)
+	if len(blocks) != 0 {
+		t.Fatalf("expected no blocks, got %d", len(blocks))
+	}
+
+	long := strings.Repeat("x", 300)
+	if uid := storedUID(long); len(uid) > maxUIDLength || uid != storedUID(long) {
+		t.Errorf("expected a stable UID that fits the column, got %q", uid)
+	}
+
+	if reason := truncate(strings.Repeat("é", 200), maxReasonLength); len(reason) > maxReasonLength || !strings.HasPrefix(strings.Repeat("é", 200), reason) {
+		t.Errorf("expected the reason to be cut between characters, got %d bytes", len(reason))
+	}
+}
@@ -2,14 +2,18 @@ package config
 
 import (
 	"encoding/gob"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
-	"text/template"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/mlvieira/bookings/internal/calsync"
+	"github.com/mlvieira/bookings/internal/emails"
 	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/outbox"
+	"github.com/mlvieira/bookings/internal/photos"
 )
 
 // AppConfig holds the application config
@@ -21,7 +25,35 @@ type AppConfig struct {
 	InProduction  bool
 	Port          string
 	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+	Outbox        *outbox.Outbox
+	Emails        *emails.Renderer
+	Photos        *photos.Store
+	CalendarSync  *calsync.Syncer
+	Mail          MailConfig
+	BaseURL       string
+	SigningKey    []byte
+}
+
+// MailConfig holds the outgoing mail settings
+type MailConfig struct {
+	// Transport selects how mail is delivered: "smtp" (default), "file" or "memory"
+	Transport string
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	// Encryption is "none", "starttls" or "tls" (implicit TLS)
+	Encryption string
+	// DKIMPrivateKey is a PEM encoded RSA key. Messages are signed when it is set.
+	DKIMPrivateKey []byte
+	DKIMDomain     string
+	DKIMSelector   string
+	// From is the sender used when a message does not set one
+	From string
+	// OwnerEmails receive booking and cancellation notifications
+	OwnerEmails []string
+	// DropDir is where the file transport writes messages
+	DropDir string
 }
 
 // SetupAppConfig initializes the main application configuration
@@ -31,14 +63,13 @@ func SetupAppConfig(inProduction bool) *AppConfig {
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
-
-	mailChan := make(chan models.MailData)
+	gob.Register(models.Cart{})
+	gob.Register(models.ReservationGroup{})
 
 	app := AppConfig{
 		InProduction: inProduction,
 		InfoLog:      log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
 		ErrorLog:     log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile),
-		MailChan:     mailChan,
 	}
 
 	session := scs.New()
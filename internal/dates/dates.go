@@ -0,0 +1,20 @@
+// Package dates holds the calendar day arithmetic shared by pricing, stay rules and
+// reports. Stays are counted in whole days, so times of day and daylight saving
+// shifts must not change the result.
+package dates
+
+import "time"
+
+// TruncateDay drops the time of day, keeping the date and location
+func TruncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// DaysBetween counts calendar days from a to b, ignoring the time of day and daylight
+// saving shifts. It is negative when b is before a.
+func DaysBetween(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(ub.Sub(ua).Hours() / 24)
+}
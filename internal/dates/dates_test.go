@@ -0,0 +1,42 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTruncateDay(t *testing.T) {
+	loc := time.FixedZone("UTC-3", -3*60*60)
+	got := TruncateDay(time.Date(2050, 12, 17, 23, 30, 0, 0, loc))
+
+	if !got.Equal(time.Date(2050, 12, 17, 0, 0, 0, 0, loc)) || got.Location() != loc {
+		t.Errorf("unexpected day %s", got)
+	}
+}
+
+func TestDaysBetween(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+
+	tests := []struct {
+		name     string
+		a, b     time.Time
+		expected int
+	}{
+		{"Same day", time.Date(2050, 12, 17, 8, 0, 0, 0, time.UTC), time.Date(2050, 12, 17, 22, 0, 0, 0, time.UTC), 0},
+		{"Three nights", time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC), time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC), 3},
+		{"Late to early", time.Date(2050, 12, 17, 23, 0, 0, 0, time.UTC), time.Date(2050, 12, 18, 1, 0, 0, 0, time.UTC), 1},
+		{"Backwards", time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC), time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC), -3},
+		{"Across daylight saving", time.Date(2050, 3, 12, 0, 0, 0, 0, newYork), time.Date(2050, 3, 14, 0, 0, 0, 0, newYork), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DaysBetween(tt.a, tt.b); got != tt.expected {
+				t.Errorf("DaysBetween() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
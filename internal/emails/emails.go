@@ -0,0 +1,276 @@
+// Package emails renders the named email templates in email-templates. Every
+// template defines a "subject" and a "body" and is wrapped in the shared
+// layout; a text/plain alternative is generated from the body.
+package emails
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/dates"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/pricing"
+)
+
+// Names of the available templates
+const (
+	BookingConfirmation = "booking-confirmation"
+	BookingCancelled    = "booking-cancelled"
+	BookingChanged      = "booking-changed"
+	OwnerBooking        = "owner-booking"
+	OwnerCancellation   = "owner-cancellation"
+	GroupConfirmation   = "group-confirmation"
+	OwnerGroupBooking   = "owner-group-booking"
+)
+
+// Guest is the person a reservation was made for
+type Guest struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+}
+
+// Links holds absolute URLs included in an email
+type Links struct {
+	// Manage is the guest's signed link to view or cancel the reservation
+	Manage string
+	// Admin points staff to the reservation in the admin area
+	Admin string
+}
+
+// Data is passed to every email template
+type Data struct {
+	Guest       Guest
+	Reservation models.Reservation
+	Room        models.Room
+	Links       Links
+	// Previous is the reservation before staff moved it to other dates or another room
+	Previous models.Reservation
+	// Group and Stays are set for rooms booked together in one checkout
+	Group models.ReservationGroup
+	Stays []Stay
+}
+
+// Stay is one reservation of a group with its own links
+type Stay struct {
+	Reservation models.Reservation
+	Links       Links
+}
+
+// Message is a rendered email
+type Message struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// ReservationData builds the template data for a reservation
+func ReservationData(res models.Reservation, links Links) Data {
+	return Data{
+		Guest: Guest{
+			FirstName: res.FirstName,
+			LastName:  res.LastName,
+			Email:     res.Email,
+			Phone:     res.Phone,
+		},
+		Reservation: res,
+		Room:        res.Room,
+		Links:       links,
+	}
+}
+
+// GroupData builds the template data for a group of reservations booked by the same
+// guest, with the links of each reservation from links
+func GroupData(group models.ReservationGroup, links func(res models.Reservation) Links) Data {
+	var data Data
+	if len(group.Reservations) > 0 {
+		data = ReservationData(group.Reservations[0], links(group.Reservations[0]))
+	}
+
+	data.Group = group
+	for _, res := range group.Reservations {
+		data.Stays = append(data.Stays, Stay{Reservation: res, Links: links(res)})
+	}
+
+	return data
+}
+
+// SampleData returns made-up data used to preview the templates
+func SampleData(baseURL string) Data {
+	start := dates.TruncateDay(time.Now().AddDate(0, 0, 14))
+
+	res := models.Reservation{
+		ID:        1234,
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Email:     "jane@example.com",
+		Phone:     "555-0100",
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 3),
+		RoomID:    1,
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+		Total:     45000,
+	}
+
+	data := ReservationData(res, Links{
+		Manage: baseURL + "/reservations/manage/preview",
+		Admin:  baseURL + "/admin/reservations/details/1234",
+	})
+
+	data.Previous = res
+	data.Previous.StartDate = start.AddDate(0, 0, -7)
+	data.Previous.EndDate = start.AddDate(0, 0, -5)
+	data.Previous.Room = models.Room{ID: 2, RoomName: "Major's Suite"}
+	data.Previous.RoomID = 2
+	data.Previous.Total = 30000
+
+	second := res
+	second.ID = 1235
+	second.RoomID = 2
+	second.Room = models.Room{ID: 2, RoomName: "Major's Suite"}
+	second.Total = 30000
+
+	group := GroupData(models.ReservationGroup{
+		ID:           12,
+		Total:        res.Total + second.Total,
+		Reservations: []models.Reservation{res, second},
+	}, func(res models.Reservation) Links {
+		return Links{
+			Manage: baseURL + "/reservations/manage/preview",
+			Admin:  fmt.Sprintf("%s/admin/reservations/details/%d", baseURL, res.ID),
+		}
+	})
+
+	data.Group = group.Group
+	data.Stays = group.Stays
+
+	return data
+}
+
+// Renderer holds the parsed email templates
+type Renderer struct {
+	templates map[string]*template.Template
+}
+
+var funcMap = template.FuncMap{
+	"money": pricing.FormatCents,
+	"date": func(t time.Time) string {
+		return t.Format("01-02-2006")
+	},
+}
+
+// New parses the *.email.html templates in dir together with its *.layout.html files
+func New(dir string) (*Renderer, error) {
+	pages, err := filepath.Glob(filepath.Join(dir, "*.email.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	layouts, err := filepath.Glob(filepath.Join(dir, "*.layout.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Renderer{templates: map[string]*template.Template{}}
+
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), ".email.html")
+
+		ts, err := template.New(filepath.Base(page)).Funcs(funcMap).ParseFiles(append([]string{page}, layouts...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range []string{"subject", "body"} {
+			if ts.Lookup(block) == nil {
+				return nil, fmt.Errorf("email template %s does not define %q", name, block)
+			}
+		}
+
+		r.templates[name] = ts
+	}
+
+	return r, nil
+}
+
+// Names returns the available template names in alphabetical order
+func (r *Renderer) Names() []string {
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Has reports whether a template with the given name exists
+func (r *Renderer) Has(name string) bool {
+	_, ok := r.templates[name]
+	return ok
+}
+
+// Render executes the named template with data
+func (r *Renderer) Render(name string, data Data) (Message, error) {
+	ts, ok := r.templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, body, page bytes.Buffer
+
+	if err := ts.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+
+	if err := ts.ExecuteTemplate(&body, "body", data); err != nil {
+		return Message{}, err
+	}
+
+	if err := ts.Execute(&page, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(html.UnescapeString(subject.String())),
+		HTML:    page.String(),
+		Text:    PlainText(body.String()),
+	}, nil
+}
+
+var (
+	linkRe       = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	breakRe      = regexp.MustCompile(`(?i)<br\s*/?>`)
+	blockEndRe   = regexp.MustCompile(`(?i)</(p|div|h[1-6]|tr|table|li)>`)
+	tagRe        = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacesRe     = regexp.MustCompile(`[ \t]+`)
+	blankLinesRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// PlainText converts an HTML fragment to readable plain text. Links keep their
+// target in brackets so they still work in text-only mail clients.
+func PlainText(fragment string) string {
+	s := linkRe.ReplaceAllString(fragment, "$2 [$1]")
+	s = breakRe.ReplaceAllString(s, "\n")
+	s = blockEndRe.ReplaceAllString(s, "\n\n")
+	s = tagRe.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spacesRe.ReplaceAllString(line, " "))
+	}
+
+	s = strings.Join(lines, "\n")
+	s = blankLinesRe.ReplaceAllString(s, "\n\n")
+
+	return strings.TrimSpace(s) + "\n"
+}
@@ -0,0 +1,232 @@
+package emails
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+func newTestRenderer(t *testing.T) *Renderer {
+	t.Helper()
+
+	r, err := New("../../email-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestNew(t *testing.T) {
+	r := newTestRenderer(t)
+
+	for _, name := range []string{BookingConfirmation, BookingCancelled, BookingChanged, OwnerBooking, OwnerCancellation, GroupConfirmation, OwnerGroupBooking} {
+		if !r.Has(name) {
+			t.Errorf("expected template %s to be loaded", name)
+		}
+	}
+
+	if got := len(r.Names()); got != 7 {
+		t.Errorf("expected 7 templates, got %v", r.Names())
+	}
+}
+
+func TestNew_MissingBlock(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"base.layout.html":  `{{define "layout"}}<html>{{template "body" .}}</html>{{end}}`,
+		"broken.email.html": `{{template "layout" .}}{{define "body"}}hi{{end}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := New(dir); err == nil {
+		t.Error("expected an error for a template without a subject")
+	}
+}
+
+func TestRender(t *testing.T) {
+	r := newTestRenderer(t)
+
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := ReservationData(models.Reservation{
+		ID:        7,
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@example.com",
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 2),
+		Room:      models.Room{RoomName: "General's Quarters"},
+		Total:     30000,
+	}, Links{Manage: "http://localhost/reservations/manage/abc"})
+
+	msg, err := r.Render(BookingConfirmation, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Subject != "Your Reservation is Confirmed! 🎉" {
+		t.Errorf("unexpected subject %q", msg.Subject)
+	}
+
+	for _, want := range []string{"Dear John", "01-01-2050", "01-03-2050", "$300.00", `href="http://localhost/reservations/manage/abc"`, "<title>Your Reservation is Confirmed! 🎉</title>"} {
+		if !strings.Contains(msg.HTML, want) {
+			t.Errorf("expected HTML to contain %q", want)
+		}
+	}
+
+	for _, want := range []string{"Dear John,", "General's Quarters", "Manage your reservation [http://localhost/reservations/manage/abc]"} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("expected text to contain %q:\n%s", want, msg.Text)
+		}
+	}
+
+	if strings.Contains(msg.Text, "<") {
+		t.Errorf("expected no markup in the text part:\n%s", msg.Text)
+	}
+
+	msg, err = r.Render(OwnerCancellation, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Subject != "Reservation 7 for room General's Quarters was cancelled" {
+		t.Errorf("unexpected subject %q", msg.Subject)
+	}
+
+	data.Previous = data.Reservation
+	data.Previous.StartDate = start.AddDate(0, 0, 5)
+	data.Previous.EndDate = start.AddDate(0, 0, 6)
+	data.Previous.Room = models.Room{RoomName: "Major's Suite"}
+	data.Previous.Total = 10000
+
+	msg, err = r.Render(BookingChanged, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"Before: the room Major's Suite from 01-06-2050 to 01-07-2050, for a total of $100.00.", "Now: the room General's Quarters from 01-01-2050 to 01-03-2050, for a total of $300.00."} {
+		if !strings.Contains(strings.Join(strings.Fields(msg.Text), " "), want) {
+			t.Errorf("expected text to contain %q:\n%s", want, msg.Text)
+		}
+	}
+
+	if _, err := r.Render("missing", data); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+}
+
+func TestRender_Group(t *testing.T) {
+	r := newTestRenderer(t)
+
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := models.Reservation{
+		ID:        7,
+		FirstName: "John",
+		LastName:  "Smith",
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 2),
+		Room:      models.Room{RoomName: "General's Quarters"},
+		Total:     30000,
+	}
+	second := first
+	second.ID = 8
+	second.Room = models.Room{RoomName: "Major's Suite"}
+	second.Total = 20000
+
+	data := GroupData(models.ReservationGroup{
+		ID:           3,
+		Total:        50000,
+		Reservations: []models.Reservation{first, second},
+	}, func(res models.Reservation) Links {
+		return Links{Manage: fmt.Sprintf("http://localhost/reservations/manage/%d", res.ID)}
+	})
+
+	msg, err := r.Render(GroupConfirmation, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Subject != "Your 2 Reservations are Confirmed! 🎉" {
+		t.Errorf("unexpected subject %q", msg.Subject)
+	}
+
+	text := strings.Join(strings.Fields(msg.Text), " ")
+	for _, want := range []string{
+		"Dear John,",
+		"The room General's Quarters from 01-01-2050 to 01-03-2050, for $300.00. Manage this reservation [http://localhost/reservations/manage/7]",
+		"The room Major's Suite from 01-01-2050 to 01-03-2050, for $200.00. Manage this reservation [http://localhost/reservations/manage/8]",
+		"Total for your stays: $500.00",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected text to contain %q:\n%s", want, msg.Text)
+		}
+	}
+
+	msg, err = r.Render(OwnerGroupBooking, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(msg.Text, "John Smith booked 2 rooms") {
+		t.Errorf("expected the owner email to name the guest:\n%s", msg.Text)
+	}
+}
+
+func TestRender_EscapesGuestInput(t *testing.T) {
+	r := newTestRenderer(t)
+
+	data := ReservationData(models.Reservation{
+		FirstName: `<script>alert("x")</script>`,
+		LastName:  "O'Brien",
+		Room:      models.Room{RoomName: "Major's Suite"},
+	}, Links{Admin: "javascript:alert(1)"})
+
+	msg, err := r.Render(OwnerBooking, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(msg.HTML, "<script>") {
+		t.Error("expected the guest name to be escaped in the HTML part")
+	}
+
+	if strings.Contains(msg.HTML, `href="javascript:`) {
+		t.Error("expected an unsafe link to be filtered")
+	}
+
+	if !strings.Contains(msg.Text, `<script>alert("x")</script> O'Brien`) {
+		t.Errorf("expected the text part to show the name as typed:\n%s", msg.Text)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{"paragraphs", "<p>One</p>\n<p>Two</p>", "One\n\nTwo\n"},
+		{"line breaks", "One<br>Two<br/>Three", "One\nTwo\nThree\n"},
+		{"links", `<a href="http://x.test/a?b=1&amp;c=2">Go</a>`, "Go [http://x.test/a?b=1&c=2]\n"},
+		{"entities", "<p>Tom &amp; Jerry&#39;s</p>", "Tom & Jerry's\n"},
+		{"whitespace", "<h5>  Title  </h5>\n\n\n\n<p>  a\n    b  </p>", "Title\n\na\nb\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlainText(tt.html); got != tt.expected {
+				t.Errorf("PlainText() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package forms
 import (
 	"fmt"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -64,3 +65,44 @@ func (f *Form) IsInt(field string) bool {
 	}
 	return true
 }
+
+var slugRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// IsSlug checks the field only holds lowercase letters, digits and single dashes
+func (f *Form) IsSlug(field string) bool {
+	if !slugRe.MatchString(f.Get(field)) {
+		f.Errors.Add(field, "Use only lowercase letters, numbers and dashes")
+		return false
+	}
+	return true
+}
+
+// IntBetween checks the field is an integer between min and max, inclusive
+func (f *Form) IntBetween(field string, min, max int) bool {
+	value, err := strconv.Atoi(f.Get(field))
+	if err != nil || value < min || value > max {
+		f.Errors.Add(field, fmt.Sprintf("This field must be a number between %d and %d", min, max))
+		return false
+	}
+	return true
+}
+
+var amountRe = regexp.MustCompile(`^[0-9]{1,7}(\.[0-9]{1,2})?$`)
+
+// Cents checks the field is a dollar amount above zero with at most two decimals and
+// returns it in cents
+func (f *Form) Cents(field string) (int, bool) {
+	value := strings.TrimSpace(f.Get(field))
+	if amountRe.MatchString(value) {
+		dollars, fraction, _ := strings.Cut(value, ".")
+		d, _ := strconv.Atoi(dollars)
+		c, _ := strconv.Atoi((fraction + "00")[:2])
+
+		if cents := d*100 + c; cents > 0 {
+			return cents, true
+		}
+	}
+
+	f.Errors.Add(field, "Enter an amount above zero, like 120 or 120.50")
+	return 0, false
+}
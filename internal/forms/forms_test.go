@@ -126,3 +126,86 @@ func TestForm_IsEmail(t *testing.T) {
 	}
 
 }
+
+func TestForm_IsSlug(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"majors-suite", true},
+		{"room-2", true},
+		{"Majors-Suite", false},
+		{"majors--suite", false},
+		{"-majors", false},
+		{"majors suite", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		newForm := New(url.Values{"slug": {tt.value}})
+
+		if got := newForm.IsSlug("slug"); got != tt.valid {
+			t.Errorf("IsSlug(%q) = %v, want %v", tt.value, got, tt.valid)
+		}
+
+		if newForm.Valid() != tt.valid {
+			t.Errorf("expected form validity %v for %q", tt.valid, tt.value)
+		}
+	}
+}
+
+func TestForm_IntBetween(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"1", true},
+		{"20", true},
+		{"0", false},
+		{"21", false},
+		{"two", false},
+	}
+
+	for _, tt := range tests {
+		newForm := New(url.Values{"capacity": {tt.value}})
+
+		if got := newForm.IntBetween("capacity", 1, 20); got != tt.valid {
+			t.Errorf("IntBetween(%q) = %v, want %v", tt.value, got, tt.valid)
+		}
+
+		if !tt.valid && newForm.Errors.Get("capacity") == "" {
+			t.Errorf("expected an error for %q", tt.value)
+		}
+	}
+}
+
+func TestForm_Cents(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int
+		valid    bool
+	}{
+		{"120", 12000, true},
+		{"120.5", 12050, true},
+		{"0.99", 99, true},
+		{" 85.00 ", 8500, true},
+		{"0", 0, false},
+		{"12.345", 0, false},
+		{"-10", 0, false},
+		{"$10", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		newForm := New(url.Values{"base_rate": {tt.value}})
+
+		cents, valid := newForm.Cents("base_rate")
+		if valid != tt.valid || cents != tt.expected {
+			t.Errorf("Cents(%q) = %d, %v, want %d, %v", tt.value, cents, valid, tt.expected, tt.valid)
+		}
+
+		if !tt.valid && newForm.Errors.Get("base_rate") == "" {
+			t.Errorf("expected an error for %q", tt.value)
+		}
+	}
+}
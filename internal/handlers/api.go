@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mlvieira/bookings/internal/forms"
+	"github.com/mlvieira/bookings/internal/lifecycle"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/repository"
+	"github.com/mlvieira/bookings/internal/tokens"
+)
+
+// apiDateLayout is the ISO-8601 calendar date layout used by the API
+const apiDateLayout = "2006-01-02"
+
+// apiMaxBodySize limits the size of API request bodies
+const apiMaxBodySize = 1 << 20
+
+// apiEnvelope wraps every API response
+type apiEnvelope struct {
+	Data  any       `json:"data,omitempty"`
+	Error *apiError `json:"error,omitempty"`
+}
+
+// apiError describes why an API request failed
+type apiError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// apiDate is a calendar date encoded as YYYY-MM-DD
+type apiDate time.Time
+
+func (d apiDate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Time(d).Format(apiDateLayout))
+}
+
+func (d *apiDate) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	t, err := time.Parse(apiDateLayout, s)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, use YYYY-MM-DD", s)
+	}
+
+	*d = apiDate(t)
+	return nil
+}
+
+type apiRoom struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Slug        string `json:"slug"`
+	Capacity    int    `json:"capacity"`
+}
+
+type apiNight struct {
+	Date    apiDate `json:"date"`
+	Rate    int     `json:"rate"`
+	Weekend bool    `json:"weekend"`
+	Season  string  `json:"season,omitempty"`
+}
+
+type apiQuote struct {
+	Nights []apiNight `json:"nights"`
+	Total  int        `json:"total"`
+}
+
+type apiAvailability struct {
+	StartDate apiDate            `json:"startDate"`
+	EndDate   apiDate            `json:"endDate"`
+	Rooms     []apiAvailableRoom `json:"rooms"`
+	// Excluded lists the free rooms whose stay rules do not allow the stay
+	Excluded []models.StayRuleViolation `json:"excluded"`
+}
+
+type apiAvailableRoom struct {
+	apiRoom
+	Quote *apiQuote `json:"quote,omitempty"`
+}
+
+// apiReservation is a reservation as the API returns it. Cancelled predates Status and
+// is only kept for older clients: it is set for every status that gives up the room,
+// no-shows included.
+type apiReservation struct {
+	ID        int       `json:"id"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Room      apiRoom   `json:"room"`
+	StartDate apiDate   `json:"startDate"`
+	EndDate   apiDate   `json:"endDate"`
+	Adults    int       `json:"adults"`
+	Children  int       `json:"children"`
+	Total     int       `json:"total"`
+	Status    string    `json:"status"`
+	Cancelled bool      `json:"cancelled"`
+	GroupID   int       `json:"groupId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Token     string    `json:"token,omitempty"`
+	ManageURL string    `json:"manageUrl,omitempty"`
+}
+
+// apiReservationRequest is the body of a new reservation. Adults defaults to one
+// when left out.
+type apiReservationRequest struct {
+	RoomID    int     `json:"roomId"`
+	StartDate apiDate `json:"startDate"`
+	EndDate   apiDate `json:"endDate"`
+	Adults    int     `json:"adults"`
+	Children  int     `json:"children"`
+	FirstName string  `json:"firstName"`
+	LastName  string  `json:"lastName"`
+	Email     string  `json:"email"`
+	Phone     string  `json:"phone"`
+}
+
+func newAPIRoom(room models.Room) apiRoom {
+	return apiRoom{
+		ID:          room.ID,
+		Name:        room.RoomName,
+		Description: room.RoomDescription,
+		Slug:        room.RoomURL,
+		Capacity:    room.Capacity,
+	}
+}
+
+func newAPIQuote(quote models.Quote) *apiQuote {
+	q := apiQuote{
+		Nights: []apiNight{},
+		Total:  quote.Total,
+	}
+
+	for _, n := range quote.Nights {
+		q.Nights = append(q.Nights, apiNight{
+			Date:    apiDate(n.Date),
+			Rate:    n.Rate,
+			Weekend: n.Weekend,
+			Season:  n.Season,
+		})
+	}
+
+	return &q
+}
+
+func newAPIReservation(res models.Reservation) apiReservation {
+	return apiReservation{
+		ID:        res.ID,
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Email:     res.Email,
+		Phone:     res.Phone,
+		Room:      newAPIRoom(res.Room),
+		StartDate: apiDate(res.StartDate),
+		EndDate:   apiDate(res.EndDate),
+		Adults:    res.Adults,
+		Children:  res.Children,
+		Total:     res.Total,
+		Status:    res.Status,
+		Cancelled: lifecycle.Status(res.Status).ReleasesRoom(),
+		GroupID:   res.GroupID,
+		CreatedAt: res.CreatedAt,
+	}
+}
+
+// writeAPIJSON writes data wrapped in the API envelope
+func writeAPIJSON(w http.ResponseWriter, status int, data any) {
+	out, err := json.Marshal(apiEnvelope{Data: data})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// writeAPIError writes an error wrapped in the API envelope
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeAPIErrorFields(w, status, code, message, nil)
+}
+
+// writeAPIErrorFields writes a validation error with per-field messages
+func writeAPIErrorFields(w http.ResponseWriter, status int, code, message string, fields map[string]string) {
+	out, _ := json.Marshal(apiEnvelope{
+		Error: &apiError{
+			Code:    code,
+			Message: message,
+			Fields:  fields,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// ApiNotFound handles requests to unknown API routes
+func (m *Repository) ApiNotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "not_found", "Resource not found")
+}
+
+// ApiMethodNotAllowed handles requests using an unsupported method on an API route
+func (m *Repository) ApiMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+}
+
+// ApiListRooms handles the GET request listing rooms
+func (m *Repository) ApiListRooms(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 100 {
+			writeAPIError(w, http.StatusBadRequest, "invalid_limit", "limit must be an integer between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	rooms, err := m.DB.GetAllRooms(limit)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	out := []apiRoom{}
+	for _, room := range rooms {
+		out = append(out, newAPIRoom(room))
+	}
+
+	writeAPIJSON(w, http.StatusOK, out)
+}
+
+// ApiGetRoom handles the GET request for a single room by its slug
+func (m *Repository) ApiGetRoom(w http.ResponseWriter, r *http.Request) {
+	room, err := m.DB.GetRoomByUrl(chi.URLParam(r, "room"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && room.Active != 1) {
+		writeAPIError(w, http.StatusNotFound, "room_not_found", "Room not found")
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, newAPIRoom(room))
+}
+
+// ApiSearchAvailability handles the GET request searching every room for availability
+func (m *Repository) ApiSearchAvailability(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	startDate, err := time.Parse(apiDateLayout, query.Get("start"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_start", "start is required and must use the YYYY-MM-DD format")
+		return
+	}
+
+	endDate, err := time.Parse(apiDateLayout, query.Get("end"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_end", "end is required and must use the YYYY-MM-DD format")
+		return
+	}
+
+	if !endDate.After(startDate) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_range", "end must be after start")
+		return
+	}
+
+	p, err := parseParty(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_guests", err.Error())
+		return
+	}
+
+	rooms, excluded, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate, p.minCapacity())
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	// a party split across rooms only finds rooms when enough are free to sleep everyone
+	if !p.fits(rooms) {
+		rooms = nil
+	}
+
+	out := apiAvailability{
+		StartDate: apiDate(startDate),
+		EndDate:   apiDate(endDate),
+		Rooms:     []apiAvailableRoom{},
+		Excluded:  excluded,
+	}
+
+	if out.Excluded == nil {
+		out.Excluded = []models.StayRuleViolation{}
+	}
+
+	for _, room := range rooms {
+		available := apiAvailableRoom{apiRoom: newAPIRoom(room)}
+
+		quote, err := m.DB.QuoteStay(room.ID, startDate, endDate)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		} else {
+			available.Quote = newAPIQuote(quote)
+		}
+
+		out.Rooms = append(out.Rooms, available)
+	}
+
+	writeAPIJSON(w, http.StatusOK, out)
+}
+
+// ApiCreateReservation handles the POST request booking a room
+func (m *Repository) ApiCreateReservation(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/json")
+		return
+	}
+
+	var payload apiReservationRequest
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&payload); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_body", fmt.Sprintf("Invalid request body: %s", err))
+		return
+	}
+
+	form := forms.New(url.Values{
+		"first_name": {payload.FirstName},
+		"last_name":  {payload.LastName},
+		"email":      {payload.Email},
+		"phone":      {payload.Phone},
+	})
+
+	form.Required("first_name", "last_name", "email", "phone")
+	form.MinLength("first_name", 3)
+	form.MinLength("last_name", 3)
+	form.IsEmail("email")
+
+	fields := map[string]string{}
+	for field, jsonField := range map[string]string{
+		"first_name": "firstName",
+		"last_name":  "lastName",
+		"email":      "email",
+		"phone":      "phone",
+	} {
+		if msg := form.Errors.Get(field); msg != "" {
+			fields[jsonField] = msg
+		}
+	}
+
+	startDate, endDate := time.Time(payload.StartDate), time.Time(payload.EndDate)
+
+	if startDate.IsZero() {
+		fields["startDate"] = "This field cannot be blank"
+	}
+	if endDate.IsZero() {
+		fields["endDate"] = "This field cannot be blank"
+	} else if !endDate.After(startDate) {
+		fields["endDate"] = "Departure must be after arrival"
+	}
+
+	if payload.Adults == 0 {
+		payload.Adults = 1
+	}
+
+	if payload.Adults < 1 || payload.Adults > maxRoomCapacity {
+		fields["adults"] = fmt.Sprintf("Must be between 1 and %d", maxRoomCapacity)
+	}
+	if payload.Children < 0 || payload.Children > maxRoomCapacity {
+		fields["children"] = fmt.Sprintf("Must be between 0 and %d", maxRoomCapacity)
+	}
+
+	room, err := m.DB.GetRoomByID(payload.RoomID)
+	if err != nil || room.Active != 1 {
+		fields["roomId"] = "Room not found"
+	} else if _, ok := fields["adults"]; !ok {
+		if err := checkOccupancy(payload.Adults+payload.Children, room.Capacity); err != nil {
+			fields["adults"] = err.Error()
+		}
+	}
+
+	if len(fields) > 0 {
+		writeAPIErrorFields(w, http.StatusUnprocessableEntity, "validation_failed", "The reservation is invalid", fields)
+		return
+	}
+
+	quote, err := m.DB.QuoteStay(payload.RoomID, startDate, endDate)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Error pricing the stay")
+		return
+	}
+
+	res := models.Reservation{
+		FirstName: strings.TrimSpace(payload.FirstName),
+		LastName:  strings.TrimSpace(payload.LastName),
+		Email:     strings.TrimSpace(payload.Email),
+		Phone:     strings.TrimSpace(payload.Phone),
+		StartDate: startDate,
+		EndDate:   endDate,
+		RoomID:    payload.RoomID,
+		Room:      room,
+		Adults:    payload.Adults,
+		Children:  payload.Children,
+		Total:     quote.Total,
+	}
+
+	lastID, err := m.DB.BookRoom(res)
+	if err != nil {
+		var unavailable *repository.RoomUnavailableError
+		if errors.As(err, &unavailable) {
+			writeAPIError(w, http.StatusConflict, "room_unavailable", "The room is not available for the selected dates")
+			return
+		}
+
+		var ruleErr *repository.StayRuleError
+		if errors.As(err, &ruleErr) {
+			writeAPIError(w, http.StatusUnprocessableEntity, "stay_rule_violation", ruleErr.Violation.Message)
+			return
+		}
+
+		var occupancyErr *repository.OccupancyError
+		if errors.As(err, &occupancyErr) {
+			writeAPIError(w, http.StatusUnprocessableEntity, "over_capacity", fmt.Sprintf("The room sleeps at most %d guests", occupancyErr.Capacity))
+			return
+		}
+
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Error saving the reservation")
+		return
+	}
+
+	res.ID = lastID
+	res.CreatedAt = time.Now()
+
+	m.sendBookingEmails(res)
+
+	out := newAPIReservation(res)
+	out.Token = m.manageReservationToken(res)
+	out.ManageURL = m.manageReservationURL(res)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reservations/%s", out.Token))
+	writeAPIJSON(w, http.StatusCreated, out)
+}
+
+// ApiGetReservation handles the GET request for a reservation identified by its signed token
+func (m *Repository) ApiGetReservation(w http.ResponseWriter, r *http.Request) {
+	res, err := m.reservationFromToken(r)
+	if errors.Is(err, tokens.ErrExpiredToken) {
+		writeAPIError(w, http.StatusGone, "token_expired", "The reservation token has expired")
+		return
+	}
+	if errors.Is(err, tokens.ErrInvalidToken) || errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, "reservation_not_found", "Reservation not found")
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, newAPIReservation(res))
+}
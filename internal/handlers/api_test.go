@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/lifecycle"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/tokens"
+)
+
+type apiTestResponse struct {
+	Data  json.RawMessage `json:"data"`
+	Error *apiError       `json:"error"`
+}
+
+func doAPIRequest(t *testing.T, method, target, contentType, body string) (*httptest.ResponseRecorder, apiTestResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s: expected application/json, got %q", method, target, ct)
+	}
+
+	var resp apiTestResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: failed parsing json: %v", method, target, err)
+	}
+
+	return rr, resp
+}
+
+func TestAPI_Routes(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		expectedCode int
+		expectedErr  string
+	}{
+		{"List rooms", "GET", "/api/v1/rooms", http.StatusOK, ""},
+		{"List rooms invalid limit", "GET", "/api/v1/rooms?limit=0", http.StatusBadRequest, "invalid_limit"},
+		{"Get room", "GET", "/api/v1/rooms/majors-suite", http.StatusOK, ""},
+		{"Get room not found", "GET", "/api/v1/rooms/unknown", http.StatusNotFound, "room_not_found"},
+		{"Get inactive room", "GET", "/api/v1/rooms/closed-suite", http.StatusNotFound, "room_not_found"},
+		{"Get room database error", "GET", "/api/v1/rooms/db-error", http.StatusInternalServerError, "internal_error"},
+		{"Availability", "GET", "/api/v1/availability?start=2050-12-20&end=2050-12-23", http.StatusOK, ""},
+		{"Availability missing start", "GET", "/api/v1/availability?end=2050-12-23", http.StatusBadRequest, "invalid_start"},
+		{"Availability invalid end", "GET", "/api/v1/availability?start=2050-12-20&end=12-23-2050", http.StatusBadRequest, "invalid_end"},
+		{"Availability invalid range", "GET", "/api/v1/availability?start=2050-12-20&end=2050-12-20", http.StatusBadRequest, "invalid_range"},
+		{"Availability database error", "GET", "/api/v1/availability?start=2050-12-17&end=2050-12-20", http.StatusInternalServerError, "internal_error"},
+		{"Reservation invalid token", "GET", "/api/v1/reservations/invalid", http.StatusNotFound, "reservation_not_found"},
+		{"Unknown route", "GET", "/api/v1/unknown", http.StatusNotFound, "not_found"},
+		{"Method not allowed", "DELETE", "/api/v1/rooms", http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, resp := doAPIRequest(t, tt.method, tt.target, "", "")
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedErr == "" {
+				if resp.Error != nil {
+					t.Errorf("unexpected error %+v", resp.Error)
+				}
+				return
+			}
+
+			if resp.Error == nil || resp.Error.Code != tt.expectedErr {
+				t.Errorf("expected error code %q, got %+v", tt.expectedErr, resp.Error)
+			}
+		})
+	}
+}
+
+func TestAPI_SearchAvailability(t *testing.T) {
+	_, resp := doAPIRequest(t, "GET", "/api/v1/availability?start=2050-12-20&end=2050-12-23", "", "")
+
+	var out struct {
+		StartDate string `json:"startDate"`
+		Rooms     []struct {
+			ID    int       `json:"id"`
+			Quote *apiQuote `json:"quote"`
+		} `json:"rooms"`
+	}
+	if err := json.Unmarshal(resp.Data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.StartDate != "2050-12-20" {
+		t.Errorf("expected ISO start date, got %q", out.StartDate)
+	}
+
+	if len(out.Rooms) != 1 || out.Rooms[0].Quote == nil || len(out.Rooms[0].Quote.Nights) != 3 {
+		t.Errorf("unexpected rooms: %+v", out.Rooms)
+	}
+
+	_, resp = doAPIRequest(t, "GET", "/api/v1/availability?start=2050-12-20&end=2050-12-23&adults=2&children=1", "", "")
+	if err := json.Unmarshal(resp.Data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Rooms) != 0 {
+		t.Errorf("expected no room to sleep three guests, got %+v", out.Rooms)
+	}
+
+	_, resp = doAPIRequest(t, "GET", "/api/v1/availability?start=2050-12-20&end=2050-12-23&adults=2&children=1&rooms=2", "", "")
+	if err := json.Unmarshal(resp.Data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Rooms) != 0 {
+		t.Errorf("expected no rooms when fewer are free than asked for, got %+v", out.Rooms)
+	}
+
+	rr, resp := doAPIRequest(t, "GET", "/api/v1/availability?start=2050-12-20&end=2050-12-23&adults=0", "", "")
+	if rr.Code != http.StatusBadRequest || resp.Error == nil || resp.Error.Code != "invalid_guests" {
+		t.Errorf("expected invalid_guests, got %d %+v", rr.Code, resp.Error)
+	}
+}
+
+func TestAPI_CreateReservation(t *testing.T) {
+	valid := `{"roomId":1,"startDate":"2050-12-20","endDate":"2050-12-23","firstName":"John","lastName":"Smith","email":"john@example.com","phone":"555-555-5555"}`
+
+	tests := []struct {
+		name          string
+		contentType   string
+		body          string
+		expectedCode  int
+		expectedErr   string
+		expectedField string
+	}{
+		{"Valid", "application/json", valid, http.StatusCreated, "", ""},
+		{"Wrong content type", "text/plain", valid, http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"Malformed body", "application/json", `{"roomId":`, http.StatusBadRequest, "invalid_body", ""},
+		{"Unknown field", "application/json", `{"room":1}`, http.StatusBadRequest, "invalid_body", ""},
+		{"Invalid date", "application/json", strings.Replace(valid, "2050-12-20", "12-20-2050", 1), http.StatusBadRequest, "invalid_body", ""},
+		{"Invalid email", "application/json", strings.Replace(valid, "john@example.com", "john", 1), http.StatusUnprocessableEntity, "validation_failed", "email"},
+		{"Short first name", "application/json", strings.Replace(valid, "John", "Jo", 1), http.StatusUnprocessableEntity, "validation_failed", "firstName"},
+		{"Departure before arrival", "application/json", strings.Replace(valid, "2050-12-23", "2050-12-19", 1), http.StatusUnprocessableEntity, "validation_failed", "endDate"},
+		{"Unknown room", "application/json", strings.Replace(valid, `"roomId":1`, `"roomId":3`, 1), http.StatusUnprocessableEntity, "validation_failed", "roomId"},
+		{"Guests", "application/json", strings.Replace(valid, `"roomId":1`, `"roomId":1,"adults":1,"children":1`, 1), http.StatusCreated, "", ""},
+		{"Too many guests", "application/json", strings.Replace(valid, `"roomId":1`, `"roomId":1,"adults":2,"children":1`, 1), http.StatusUnprocessableEntity, "validation_failed", "adults"},
+		{"Negative children", "application/json", strings.Replace(valid, `"roomId":1`, `"roomId":1,"children":-1`, 1), http.StatusUnprocessableEntity, "validation_failed", "children"},
+		{"Booking error", "application/json", strings.Replace(valid, "john@example.com", "john@at.com", 1), http.StatusInternalServerError, "internal_error", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, resp := doAPIRequest(t, "POST", "/api/v1/reservations", tt.contentType, tt.body)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedErr == "" {
+				var res apiReservation
+				if err := json.Unmarshal(resp.Data, &res); err != nil {
+					t.Fatal(err)
+				}
+
+				if res.ID == 0 || res.Token == "" || res.Total <= 0 || res.Adults < 1 {
+					t.Errorf("unexpected reservation: %+v", res)
+				}
+
+				if loc := rr.Header().Get("Location"); loc != "/api/v1/reservations/"+res.Token {
+					t.Errorf("unexpected location %q", loc)
+				}
+				return
+			}
+
+			if resp.Error == nil || resp.Error.Code != tt.expectedErr {
+				t.Fatalf("expected error code %q, got %+v", tt.expectedErr, resp.Error)
+			}
+
+			if tt.expectedField != "" && resp.Error.Fields[tt.expectedField] == "" {
+				t.Errorf("expected a message for field %q, got %+v", tt.expectedField, resp.Error.Fields)
+			}
+		})
+	}
+}
+
+func TestAPI_GetReservation(t *testing.T) {
+	future := time.Now().Add(24 * time.Hour)
+	past := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{"Valid", tokens.Sign(app.SigningKey, manageTokenPurpose, 1, future), http.StatusOK},
+		{"Expired", tokens.Sign(app.SigningKey, manageTokenPurpose, 1, past), http.StatusGone},
+		{"Wrong purpose", tokens.Sign(app.SigningKey, "other", 1, future), http.StatusNotFound},
+		{"Database error", tokens.Sign(app.SigningKey, manageTokenPurpose, 2, future), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, resp := doAPIRequest(t, "GET", fmt.Sprintf("/api/v1/reservations/%s", tt.token), "", "")
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var res apiReservation
+			if err := json.Unmarshal(resp.Data, &res); err != nil {
+				t.Fatal(err)
+			}
+
+			if res.ID != 1 || res.Email != "john@example.com" {
+				t.Errorf("unexpected reservation: %+v", res)
+			}
+		})
+	}
+}
+
+func TestNewAPIReservationCancelled(t *testing.T) {
+	for _, status := range lifecycle.Statuses() {
+		res := newAPIReservation(models.Reservation{Status: string(status)})
+
+		if res.Cancelled != status.ReleasesRoom() {
+			t.Errorf("status %s: expected cancelled %v, got %v", status, status.ReleasesRoom(), res.Cancelled)
+		}
+	}
+}
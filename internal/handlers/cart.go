@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mlvieira/bookings/internal/emails"
+	"github.com/mlvieira/bookings/internal/forms"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/render"
+	"github.com/mlvieira/bookings/internal/repository"
+)
+
+// maxCartItems bounds how many rooms a guest can book in one checkout
+const maxCartItems = 10
+
+// cartFromSession returns the guest's cart, empty when nothing was added yet
+func (m *Repository) cartFromSession(r *http.Request) models.Cart {
+	cart, _ := m.App.Session.Get(r.Context(), "cart").(models.Cart)
+	return cart
+}
+
+// cartHasRoom reports whether the cart already holds the room for nights overlapping the dates
+func cartHasRoom(cart models.Cart, res models.Reservation) bool {
+	for _, item := range cart.Items {
+		if item.RoomID == res.RoomID && item.StartDate.Before(res.EndDate) && res.StartDate.Before(item.EndDate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PostCartAdd handles the POST request adding a room for the searched dates to the cart
+func (m *Repository) PostCartAdd(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || res.StartDate.IsZero() {
+		m.App.Session.Put(r.Context(), "error", "Error getting reservation from session")
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Error parsing form")
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid room id")
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if err != nil || room.Active != 1 {
+		m.App.Session.Put(r.Context(), "error", "Room not found")
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	item := models.Reservation{
+		StartDate: res.StartDate,
+		EndDate:   res.EndDate,
+		RoomID:    room.ID,
+		Room:      models.Room{ID: room.ID, RoomName: room.RoomName, Capacity: room.Capacity},
+		Adults:    max(res.Adults, 1),
+		Children:  res.Children,
+	}
+
+	// a party split across rooms says who sleeps in each, otherwise the whole party
+	// stays in this room
+	form := forms.New(r.PostForm)
+	if form.Has("adults") {
+		item.Adults, item.Children = validateGuests(form, room.Capacity)
+		if !form.Valid() {
+			msg := form.Errors.Get("adults")
+			if msg == "" {
+				msg = form.Errors.Get("children")
+			}
+
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sorry, %s can't be added. %s.", room.RoomName, msg))
+			http.Redirect(w, r, "/availability", http.StatusSeeOther)
+			return
+		}
+	} else if item.Guests() > room.Capacity {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sorry, %s sleeps at most %d guests", room.RoomName, room.Capacity))
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	cart := m.cartFromSession(r)
+
+	if len(cart.Items) >= maxCartItems {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("You can book at most %d rooms at once", maxCartItems))
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
+		return
+	}
+
+	if cartHasRoom(cart, item) {
+		m.App.Session.Put(r.Context(), "warning", "This room is already in your cart for these dates")
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
+		return
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(item.StartDate, item.EndDate, item.RoomID)
+
+	var ruleErr *repository.StayRuleError
+	if errors.As(err, &ruleErr) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sorry, this stay can't be booked. %s.", ruleErr.Violation.Message))
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Error searching database")
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+	if !available {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this room is no longer available for the selected dates. Please search again.")
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	quote, err := m.DB.QuoteStay(item.RoomID, item.StartDate, item.EndDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Error pricing your stay")
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	item.Total = quote.Total
+	cart.Items = append(cart.Items, item)
+
+	if res.Adults > 0 {
+		cart.Adults = res.Adults
+		cart.Children = res.Children
+	}
+
+	m.App.Session.Put(r.Context(), "cart", cart)
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s added to your cart", room.RoomName))
+	http.Redirect(w, r, "/cart", http.StatusSeeOther)
+}
+
+// PostCartRemove handles the POST request removing an item from the cart
+func (m *Repository) PostCartRemove(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Error parsing form")
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
+		return
+	}
+
+	cart := m.cartFromSession(r)
+
+	i, err := strconv.Atoi(r.Form.Get("item"))
+	if err != nil || i < 0 || i >= len(cart.Items) {
+		m.App.Session.Put(r.Context(), "error", "This room is not in your cart")
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
+		return
+	}
+
+	cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+
+	m.App.Session.Put(r.Context(), "cart", cart)
+	m.App.Session.Put(r.Context(), "flash", "Room removed from your cart")
+	http.Redirect(w, r, "/cart", http.StatusSeeOther)
+}
+
+// Cart handles the GET request for the cart and checkout form
+func (m *Repository) Cart(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]any)
+	data["cart"] = m.cartFromSession(r)
+	data["guest"] = models.Reservation{}
+
+	render.Template(w, r, "cart.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+// PostCart handles the POST request booking every room of the cart for the guest.
+// The rooms are booked together, so when one of them can't be booked none is.
+func (m *Repository) PostCart(w http.ResponseWriter, r *http.Request) {
+	cart := m.cartFromSession(r)
+	if len(cart.Items) == 0 {
+		m.App.Session.Put(r.Context(), "error", "Your cart is empty")
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Error parsing form")
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
+		return
+	}
+
+	guest := models.Reservation{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		Phone:     r.Form.Get("phone"),
+	}
+
+	if err := cartPartyError(cart); err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("first_name", "last_name", "email", "phone")
+	form.MinLength("first_name", 3)
+	form.MinLength("last_name", 3)
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		data := make(map[string]any)
+		data["cart"] = cart
+		data["guest"] = guest
+
+		render.Template(w, r, "cart.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+
+		return
+	}
+
+	// prices are quoted again in case rates changed since the rooms were added
+	var group models.ReservationGroup
+	for _, item := range cart.Items {
+		quote, err := m.DB.QuoteStay(item.RoomID, item.StartDate, item.EndDate)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Error pricing your stay")
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		}
+
+		item.FirstName = guest.FirstName
+		item.LastName = guest.LastName
+		item.Email = guest.Email
+		item.Phone = guest.Phone
+		item.Total = quote.Total
+
+		group.Reservations = append(group.Reservations, item)
+	}
+
+	group, err = m.DB.BookGroup(group)
+	if err != nil {
+		var unavailable *repository.RoomUnavailableError
+		if errors.As(err, &unavailable) {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf(
+				"Sorry, %s is no longer available from %s to %s. Nothing was booked, please remove it from your cart and try again.",
+				cartRoomName(cart, unavailable.RoomID), unavailable.StartDate.Format("01-02-2006"), unavailable.EndDate.Format("01-02-2006")))
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		}
+
+		var ruleErr *repository.StayRuleError
+		if errors.As(err, &ruleErr) {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf(
+				"Sorry, the stay in %s can't be booked. %s. Nothing was booked.",
+				cartRoomName(cart, ruleErr.Violation.RoomID), ruleErr.Violation.Message))
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		}
+
+		var occupancyErr *repository.OccupancyError
+		if errors.As(err, &occupancyErr) {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf(
+				"Sorry, %s sleeps at most %d guests. Nothing was booked.",
+				cartRoomName(cart, occupancyErr.RoomID), occupancyErr.Capacity))
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		}
+
+		m.App.Session.Put(r.Context(), "error", "Error inserting reservation in the database")
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
+		return
+	}
+
+	m.sendGroupBookingEmails(group)
+
+	m.App.Session.Remove(r.Context(), "cart")
+	m.App.Session.Put(r.Context(), "group", group)
+
+	http.Redirect(w, r, "/cart/summary", http.StatusSeeOther)
+}
+
+// cartPartyError returns an error when the rooms of a stay in the cart don't sleep the
+// whole party between them. Rooms booked for other dates are another stay of the
+// same party.
+func cartPartyError(cart models.Cart) error {
+	// carts filled before guests were counted have no party
+	party := cart.Adults + cart.Children
+	if party == 0 {
+		return nil
+	}
+
+	var stays []models.Reservation
+	guests := make(map[int]int)
+
+	for _, item := range cart.Items {
+		i := slices.IndexFunc(stays, func(stay models.Reservation) bool {
+			return stay.StartDate.Equal(item.StartDate) && stay.EndDate.Equal(item.EndDate)
+		})
+		if i < 0 {
+			i = len(stays)
+			stays = append(stays, item)
+		}
+
+		guests[i] += item.Guests()
+	}
+
+	for i, stay := range stays {
+		if guests[i] != party {
+			return fmt.Errorf("Your rooms from %s to %s sleep %d guests but your party is %d. Remove a room and add it again with the right guests.",
+				stay.StartDate.Format("01-02-2006"), stay.EndDate.Format("01-02-2006"), guests[i], party)
+		}
+	}
+
+	return nil
+}
+
+// cartRoomName returns the name of a room in the cart for error messages
+func cartRoomName(cart models.Cart, roomID int) string {
+	for _, item := range cart.Items {
+		if item.RoomID == roomID {
+			return item.Room.RoomName
+		}
+	}
+
+	return "a room"
+}
+
+// sendGroupBookingEmails sends the guest a single confirmation of all the rooms booked
+// together and notifies the owner
+func (m *Repository) sendGroupBookingEmails(group models.ReservationGroup) {
+	data := emails.GroupData(group, func(res models.Reservation) emails.Links {
+		return emails.Links{
+			Manage: m.manageReservationURL(res),
+			Admin:  fmt.Sprintf("%s/admin/reservations/details/%d", m.App.BaseURL, res.ID),
+		}
+	})
+
+	m.queueEmail(data.Guest.Email, emails.GroupConfirmation, data)
+	m.notifyOwners(emails.OwnerGroupBooking, data)
+}
+
+// CartSummary handles the GET request with the rooms booked in the last checkout
+func (m *Repository) CartSummary(w http.ResponseWriter, r *http.Request) {
+	group, ok := m.App.Session.Get(r.Context(), "group").(models.ReservationGroup)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Error getting reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	m.App.Session.Remove(r.Context(), "group")
+
+	manageURLs := make(map[int]string)
+	for _, res := range group.Reservations {
+		manageURLs[res.ID] = m.manageReservationURL(res)
+	}
+
+	data := make(map[string]any)
+	data["group"] = group
+	data["manageURLs"] = manageURLs
+
+	render.Template(w, r, "cart-summary.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
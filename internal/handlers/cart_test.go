@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// createTestCart returns a cart with one item per room, for the test reservation dates
+func createTestCart(roomIDs ...int) models.Cart {
+	var cart models.Cart
+	for _, id := range roomIDs {
+		item := createTestReservation(id, "Room")
+		item.Total = 30000
+		cart.Items = append(cart.Items, item)
+	}
+
+	return cart
+}
+
+// createTestPartyCart returns a test cart, one adult per room, for a party of adults and
+// children. The first room also sleeps the children.
+func createTestPartyCart(adults, children int, roomIDs ...int) models.Cart {
+	cart := createTestCart(roomIDs...)
+	cart.Adults = adults
+	cart.Children = children
+	cart.Items[0].Children = children
+
+	return cart
+}
+
+// serveCartRequest posts form to the handler with the given session values and
+// returns the recorder along with the session context to inspect afterwards
+func serveCartRequest(t *testing.T, method, path string, form url.Values, session map[string]any, handler http.HandlerFunc) (*httptest.ResponseRecorder, *http.Request) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	for key, value := range session {
+		app.Session.Put(ctx, key, value)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	return rr, req
+}
+
+func TestCartHasRoom(t *testing.T) {
+	cart := createTestCart(1)
+
+	tests := []struct {
+		name     string
+		roomID   int
+		from     int
+		nights   int
+		expected bool
+	}{
+		{"Same stay", 1, 0, 3, true},
+		{"Overlapping", 1, 2, 2, true},
+		{"Back to back", 1, 3, 2, false},
+		{"Other room", 2, 0, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := cart.Items[0].StartDate.AddDate(0, 0, tt.from)
+			res := models.Reservation{
+				RoomID:    tt.roomID,
+				StartDate: start,
+				EndDate:   start.AddDate(0, 0, tt.nights),
+			}
+
+			if got := cartHasRoom(cart, res); got != tt.expected {
+				t.Errorf("cartHasRoom() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRepository_PostCartAdd(t *testing.T) {
+	searched := models.Reservation{
+		StartDate: time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC),
+	}
+	taken := searched
+	taken.StartDate = taken.StartDate.AddDate(0, 0, 1)
+	party := searched
+	party.Adults = 2
+	party.Children = 1
+
+	tests := []struct {
+		name             string
+		roomID           string
+		guests           string
+		session          map[string]any
+		expectedLocation string
+		expectedItems    int
+	}{
+		{"Add", "1", "", map[string]any{"reservation": searched}, "/cart", 1},
+		{"Add another room", "2", "", map[string]any{"reservation": searched, "cart": createTestCart(1)}, "/cart", 2},
+		{"Already in the cart", "1", "", map[string]any{"reservation": searched, "cart": createTestCart(1)}, "/cart", 1},
+		{"Cart full", "1", "", map[string]any{"reservation": searched, "cart": createTestCart(2, 2, 2, 2, 2, 2, 2, 2, 2, 2)}, "/cart", 10},
+		{"Unavailable", "1", "", map[string]any{"reservation": taken}, "/availability", 0},
+		{"Too many guests", "1", "", map[string]any{"reservation": party}, "/availability", 0},
+		{"Part of the party", "1", "adults=1&children=1", map[string]any{"reservation": party}, "/cart", 1},
+		{"Part too big for the room", "1", "adults=2&children=1", map[string]any{"reservation": party}, "/availability", 0},
+		{"Part without adults", "1", "adults=0&children=1", map[string]any{"reservation": party}, "/availability", 0},
+		{"Unknown room", "9", "", map[string]any{"reservation": searched}, "/availability", 0},
+		{"Invalid room", "abc", "", map[string]any{"reservation": searched}, "/availability", 0},
+		{"No search", "1", "", nil, "/availability", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form, _ := url.ParseQuery(tt.guests)
+			form.Add("room_id", tt.roomID)
+
+			rr, req := serveCartRequest(t, "POST", "/cart/add", form, tt.session, Repo.PostCartAdd)
+			defer app.Session.Destroy(req.Context())
+
+			if rr.Code != http.StatusSeeOther {
+				t.Fatalf("expected status 303, got %d", rr.Code)
+			}
+
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("expected redirect to %s, got %s", tt.expectedLocation, location)
+			}
+
+			cart, _ := app.Session.Get(req.Context(), "cart").(models.Cart)
+			if len(cart.Items) != tt.expectedItems {
+				t.Errorf("expected %d items in the cart, got %d", tt.expectedItems, len(cart.Items))
+			}
+
+			if tt.name == "Add" && (cart.Items[0].Total == 0 || cart.Items[0].Adults != 1) {
+				t.Errorf("expected the added room to be priced for one adult, got %+v", cart.Items[0])
+			}
+
+			if tt.name == "Part of the party" {
+				item := cart.Items[0]
+				if item.Adults != 1 || item.Children != 1 || cart.Adults != 2 || cart.Children != 1 {
+					t.Errorf("expected one adult and one child of a party of three, got %+v in %+v", item, cart)
+				}
+			}
+		})
+	}
+}
+
+func TestRepository_PostCartRemove(t *testing.T) {
+	tests := []struct {
+		name          string
+		item          string
+		expectedItems int
+	}{
+		{"Remove", "0", 1},
+		{"Out of range", "2", 2},
+		{"Invalid", "first", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("item", tt.item)
+
+			rr, req := serveCartRequest(t, "POST", "/cart/remove", form, map[string]any{"cart": createTestCart(1, 2)}, Repo.PostCartRemove)
+			defer app.Session.Destroy(req.Context())
+
+			if location := rr.Header().Get("Location"); location != "/cart" {
+				t.Errorf("expected redirect to /cart, got %s", location)
+			}
+
+			cart, _ := app.Session.Get(req.Context(), "cart").(models.Cart)
+			if len(cart.Items) != tt.expectedItems {
+				t.Errorf("expected %d items in the cart, got %d", tt.expectedItems, len(cart.Items))
+			}
+
+			if tt.name == "Remove" && cart.Items[0].RoomID != 2 {
+				t.Errorf("expected room 2 to be left in the cart, got room %d", cart.Items[0].RoomID)
+			}
+		})
+	}
+}
+
+func TestRepository_Cart(t *testing.T) {
+	for _, session := range []map[string]any{nil, {"cart": createTestCart(1, 2)}} {
+		rr, req := serveCartRequest(t, "GET", "/cart", url.Values{}, session, Repo.Cart)
+		app.Session.Destroy(req.Context())
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostCart(t *testing.T) {
+	guest := url.Values{}
+	guest.Add("first_name", "John")
+	guest.Add("last_name", "Doe")
+	guest.Add("email", "john@example.com")
+	guest.Add("phone", "55555555")
+
+	invalid := url.Values{}
+	invalid.Add("first_name", "John")
+	invalid.Add("email", "john@example")
+
+	tests := []struct {
+		name             string
+		form             url.Values
+		cart             models.Cart
+		expectedCode     int
+		expectedLocation string
+		expectCart       bool
+	}{
+		{"Book", guest, createTestCart(1, 2), http.StatusSeeOther, "/cart/summary", false},
+		{"Party split across rooms", guest, createTestPartyCart(2, 1, 1, 2), http.StatusSeeOther, "/cart/summary", false},
+		{"Party without enough rooms", guest, createTestPartyCart(3, 0, 1, 2), http.StatusSeeOther, "/cart", true},
+		{"Rooms for more than the party", guest, createTestPartyCart(1, 0, 1, 2), http.StatusSeeOther, "/cart", true},
+		{"Empty cart", guest, models.Cart{}, http.StatusSeeOther, "/availability", true},
+		{"Invalid form", invalid, createTestCart(1), http.StatusOK, "", true},
+		{"One room taken", guest, createTestCart(1, 409), http.StatusSeeOther, "/cart", true},
+		{"Stay rule", guest, createTestCart(423, 1), http.StatusSeeOther, "/cart", true},
+		{"Pricing error", guest, createTestCart(1, 404), http.StatusSeeOther, "/cart", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, req := serveCartRequest(t, "POST", "/cart", tt.form, map[string]any{"cart": tt.cart}, Repo.PostCart)
+			defer app.Session.Destroy(req.Context())
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("expected redirect to %q, got %q", tt.expectedLocation, location)
+			}
+
+			_, hasCart := app.Session.Get(req.Context(), "cart").(models.Cart)
+			if hasCart != tt.expectCart {
+				t.Errorf("expected cart kept in session %v, got %v", tt.expectCart, hasCart)
+			}
+
+			group, booked := app.Session.Get(req.Context(), "group").(models.ReservationGroup)
+			if booked != (tt.expectedLocation == "/cart/summary") {
+				t.Fatalf("unexpected group in session: %v", booked)
+			}
+
+			if booked {
+				if len(group.Reservations) != len(tt.cart.Items) {
+					t.Errorf("expected %d reservations, got %d", len(tt.cart.Items), len(group.Reservations))
+				}
+				for _, res := range group.Reservations {
+					if res.Email != "john@example.com" || res.GroupID != group.ID || res.ID == 0 {
+						t.Errorf("unexpected reservation %+v", res)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRepository_CartSummary(t *testing.T) {
+	group := models.ReservationGroup{
+		ID:    1,
+		Total: 60000,
+		Reservations: []models.Reservation{
+			createTestReservation(1, "General's Quarters"),
+			createTestReservation(2, "Major's Suite"),
+		},
+	}
+	group.Reservations[0].ID = 1
+	group.Reservations[1].ID = 2
+
+	rr, req := serveCartRequest(t, "GET", "/cart/summary", url.Values{}, map[string]any{"group": group}, Repo.CartSummary)
+	app.Session.Destroy(req.Context())
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rr.Code)
+	}
+
+	for _, want := range []string{"General&#39;s Quarters", "Major&#39;s Suite", "/reservations/manage/"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected the summary to contain %q", want)
+		}
+	}
+
+	rr, req = serveCartRequest(t, "GET", "/cart/summary", url.Values{}, nil, Repo.CartSummary)
+	app.Session.Destroy(req.Context())
+
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Errorf("expected status 307 without a booked group, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/dates"
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/lifecycle"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/xlsx"
+)
+
+// exportColumn is a column reservations can be exported with
+type exportColumn struct {
+	Key   string
+	Title string
+	value func(res models.Reservation) any
+}
+
+// exportColumns lists the export columns in the order they are written
+var exportColumns = []exportColumn{
+	{"id", "ID", func(res models.Reservation) any { return res.ID }},
+	{"first_name", "First name", func(res models.Reservation) any { return res.FirstName }},
+	{"last_name", "Last name", func(res models.Reservation) any { return res.LastName }},
+	{"email", "Email", func(res models.Reservation) any { return res.Email }},
+	{"phone", "Phone", func(res models.Reservation) any { return res.Phone }},
+	{"room", "Room", func(res models.Reservation) any { return res.Room.RoomName }},
+	{"start_date", "Arrival", func(res models.Reservation) any { return res.StartDate }},
+	{"end_date", "Departure", func(res models.Reservation) any { return res.EndDate }},
+	{"nights", "Nights", func(res models.Reservation) any {
+		return dates.DaysBetween(res.StartDate, res.EndDate)
+	}},
+	{"adults", "Adults", func(res models.Reservation) any { return res.Adults }},
+	{"children", "Children", func(res models.Reservation) any { return res.Children }},
+	{"total", "Total", func(res models.Reservation) any { return float64(res.Total) / 100 }},
+	{"status", "Status", func(res models.Reservation) any { return lifecycle.Name(res.Status) }},
+	{"created_at", "Booked on", func(res models.Reservation) any { return res.CreatedAt }},
+}
+
+// parseExportRequest reads the format, filter and columns of an export from the query
+func parseExportRequest(query url.Values) (string, models.ReservationFilter, []exportColumn, error) {
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		return format, models.ReservationFilter{}, nil, errors.New("Choose CSV or XLSX")
+	}
+
+	filter, err := parseReservationFilter(query)
+	if err != nil {
+		return format, filter, nil, err
+	}
+
+	var keys []string
+	for _, v := range query["columns"] {
+		for _, key := range strings.Split(v, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return format, filter, exportColumns, nil
+	}
+
+	selected := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		found := false
+		for _, c := range exportColumns {
+			found = found || c.Key == key
+		}
+
+		if !found {
+			return format, filter, nil, fmt.Errorf("Unknown column %q", key)
+		}
+
+		selected[key] = true
+	}
+
+	var columns []exportColumn
+	for _, c := range exportColumns {
+		if selected[c.Key] {
+			columns = append(columns, c)
+		}
+	}
+
+	return format, filter, columns, nil
+}
+
+// AdminExportReservations streams the reservations matching the query filters as a
+// CSV or XLSX download with the chosen columns
+func (m *Repository) AdminExportReservations(w http.ResponseWriter, r *http.Request) {
+	format, filter, columns, err := parseExportRequest(r.URL.Query())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Could not export reservations: "+err.Error())
+		http.Redirect(w, r, "/admin/reservations/all", http.StatusSeeOther)
+		return
+	}
+
+	titles := make([]string, len(columns))
+	for i, c := range columns {
+		titles[i] = c.Title
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="reservations-%s.%s"`, time.Now().Format("20060102"), format))
+
+	// out records whether anything reached the client, after which errors can only be logged
+	out := &sentWriter{w: w}
+
+	var writeRow func(res models.Reservation) error
+	var finish func() error
+
+	switch format {
+	case "xlsx":
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+
+		xw, err := xlsx.NewWriter(out, "Reservations")
+		if err == nil {
+			err = xw.WriteHeader(titles)
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		row := make([]any, len(columns))
+		writeRow = func(res models.Reservation) error {
+			for i, c := range columns {
+				row[i] = c.value(res)
+			}
+			return xw.WriteRow(row)
+		}
+		finish = xw.Close
+	default:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+		cw := csv.NewWriter(out)
+		cw.Write(titles)
+
+		row := make([]string, len(columns))
+		writeRow = func(res models.Reservation) error {
+			for i, c := range columns {
+				row[i] = csvValue(c.value(res))
+			}
+			return cw.Write(row)
+		}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	}
+
+	err = m.DB.EachReservation(filter, writeRow)
+	if err != nil && !out.sent {
+		w.Header().Del("Content-Disposition")
+		helpers.ServerError(w, err)
+		return
+	}
+	if err != nil {
+		// the download has started, so the client can only be told by cutting it short
+		m.App.ErrorLog.Println("exporting reservations:", err)
+		return
+	}
+
+	if err := finish(); err != nil {
+		m.App.ErrorLog.Println("exporting reservations:", err)
+	}
+}
+
+// csvValue formats a cell for CSV. Text starting like a formula is prefixed with a
+// quote so spreadsheet applications don't run it.
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case time.Time:
+		return v.Format(xlsx.DateLayout)
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	}
+
+	return fmt.Sprint(v)
+}
+
+// sentWriter records whether anything was written through it
+type sentWriter struct {
+	w    io.Writer
+	sent bool
+}
+
+func (s *sentWriter) Write(p []byte) (int, error) {
+	s.sent = s.sent || len(p) > 0
+	return s.w.Write(p)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRepository_AdminExportReservations(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedCode  int
+		expectedRows  [][]string
+		expectedError string
+	}{
+		{
+			"CSV with columns", "?columns=id,phone&columns=total", http.StatusOK,
+			[][]string{{"ID", "Phone", "Total"}, {"1", "'=1+2", "350.00"}, {"2", "555-0100", "0.00"}}, "",
+		},
+		{
+			"CSV filtered by room", "?room_id=2&columns=id,room,start_date,nights,status", http.StatusOK,
+			[][]string{{"ID", "Room", "Arrival", "Nights", "Status"}, {"2", "Major's Suite", "2050-12-22", "2", "Confirmed"}}, "",
+		},
+		{
+			"CSV with guests", "?columns=id,adults,children", http.StatusOK,
+			[][]string{{"ID", "Adults", "Children"}, {"1", "2", "0"}, {"2", "1", "1"}}, "",
+		},
+		{"Unknown column", "?columns=id,password", http.StatusSeeOther, nil, `Could not export reservations: Unknown column "password"`},
+		{"Bad format", "?format=pdf", http.StatusSeeOther, nil, "Could not export reservations: Choose CSV or XLSX"},
+		{"Bad date", "?start=12-17-2050", http.StatusSeeOther, nil, "Could not export reservations: Invalid start date"},
+		{"Reversed dates", "?start=2050-12-20&end=2050-12-17", http.StatusSeeOther, nil, "Could not export reservations: The end date must be after the start date"},
+		{"Bad status", "?status=maybe", http.StatusSeeOther, nil, "Could not export reservations: Invalid status"},
+		{"Database error", "?q=error", http.StatusInternalServerError, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/reservations/export"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.AdminExportReservations).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			if tt.expectedRows != nil {
+				if !strings.HasPrefix(rr.Header().Get("Content-Disposition"), `attachment; filename="reservations-`) {
+					t.Errorf("unexpected Content-Disposition %q", rr.Header().Get("Content-Disposition"))
+				}
+
+				rows, err := csv.NewReader(rr.Body).ReadAll()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(rows, tt.expectedRows) {
+					t.Errorf("expected %v, got %v", tt.expectedRows, rows)
+				}
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_AdminExportReservationsXLSX(t *testing.T) {
+	req, err := http.NewRequest("GET", "/admin/reservations/export?format=xlsx&columns=first_name,total", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = req.WithContext(getCtx(req))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminExportReservations).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if rr.Header().Get("Content-Type") != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		t.Errorf("unexpected Content-Type %q", rr.Header().Get("Content-Type"))
+	}
+
+	body := rr.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sheet = string(b)
+	}
+
+	for _, expected := range []string{">First name<", ">Jane<", `<c r="B2"><v>350</v></c>`} {
+		if !strings.Contains(sheet, expected) {
+			t.Errorf("expected the sheet to contain %s", expected)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mlvieira/bookings/internal/dates"
+	"github.com/mlvieira/bookings/internal/forms"
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/ical"
+	"github.com/mlvieira/bookings/internal/lifecycle"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/render"
+	"github.com/mlvieira/bookings/internal/tokens"
+)
+
+// Calendar feeds export stays from a year ago up to two years ahead
+const (
+	feedPastDays   = 365
+	feedFutureDays = 730
+)
+
+// AdminCalendarFeeds lists the calendar feeds and the form to create one
+func (m *Repository) AdminCalendarFeeds(w http.ResponseWriter, r *http.Request) {
+	feeds, err := m.DB.ListCalendarFeeds()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.ListRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["feeds"] = feeds
+	data["rooms"] = rooms
+
+	stringMap := make(map[string]string)
+	stringMap["new_feed_url"] = m.App.Session.PopString(r.Context(), "new_feed_url")
+
+	render.Template(w, r, "admin-calendar-feeds.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+}
+
+// PostAdminCreateCalendarFeed creates a calendar feed for one room or the whole
+// property. Its URL is shown once.
+func (m *Repository) PostAdminCreateCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("feed_name")
+	form.MinLength("feed_name", 3)
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Feed name must be at least 3 characters long")
+		http.Redirect(w, r, "/admin/feeds", http.StatusSeeOther)
+		return
+	}
+
+	feed := models.CalendarFeed{
+		Name: strings.TrimSpace(r.Form.Get("feed_name")),
+	}
+
+	if form.Has("room_id") {
+		feed.RoomID, err = strconv.Atoi(r.Form.Get("room_id"))
+		if err == nil {
+			_, err = m.DB.GetRoomByID(feed.RoomID)
+		}
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Room not found")
+			http.Redirect(w, r, "/admin/feeds", http.StatusSeeOther)
+			return
+		}
+	}
+
+	token, err := tokens.NewFeedToken()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	feed.TokenHash = tokens.HashFeedToken(token)
+
+	_, err = m.DB.CreateCalendarFeed(feed)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Error creating calendar feed")
+		http.Redirect(w, r, "/admin/feeds", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "new_feed_url", fmt.Sprintf("%s/feeds/%s.ics", m.App.BaseURL, token))
+	m.App.Session.Put(r.Context(), "flash", "Calendar feed created. Copy its URL now, it won't be shown again")
+
+	http.Redirect(w, r, "/admin/feeds", http.StatusSeeOther)
+}
+
+// PostAdminDeleteCalendarFeed revokes a calendar feed, so its URL stops working
+func (m *Repository) PostAdminDeleteCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid feed id")
+		http.Redirect(w, r, "/admin/feeds", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.DeleteCalendarFeed(feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Calendar feed not found")
+		http.Redirect(w, r, "/admin/feeds", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Calendar feed revoked")
+	http.Redirect(w, r, "/admin/feeds", http.StatusSeeOther)
+}
+
+// CalendarFeed serves the reservations and owner blocks of a feed as iCalendar. The
+// secret in the URL is the only authentication, so calendar apps can subscribe to it.
+func (m *Repository) CalendarFeed(w http.ResponseWriter, r *http.Request) {
+	feed, err := m.DB.GetCalendarFeedByToken(tokens.HashFeedToken(chi.URLParam(r, "token")))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	today := dates.TruncateDay(time.Now())
+	start := today.AddDate(0, 0, -feedPastDays)
+	end := today.AddDate(0, 0, feedFutureDays)
+
+	reservations, err := m.DB.AllReservations(&start, &end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	blocks, err := m.DB.RoomBlocksBetween(start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	domain := m.feedDomain()
+
+	cal := ical.Calendar{Name: "Bookings"}
+	if feed.RoomID != 0 {
+		cal.Name = feed.Room.RoomName
+	}
+
+	for _, res := range reservations {
+		if lifecycle.Status(res.Status).ReleasesRoom() || (feed.RoomID != 0 && res.RoomID != feed.RoomID) {
+			continue
+		}
+
+		cal.Events = append(cal.Events, ical.Event{
+			UID:          fmt.Sprintf("reservation-%d@%s", res.ID, domain),
+			Summary:      fmt.Sprintf("%s %s (%s)", res.FirstName, res.LastName, res.Room.RoomName),
+			Description:  fmt.Sprintf("Reservation #%d", res.ID),
+			URL:          fmt.Sprintf("%s/admin/reservations/details/%d", m.App.BaseURL, res.ID),
+			Start:        res.StartDate,
+			End:          res.EndDate,
+			Created:      res.CreatedAt,
+			LastModified: res.UpdatedAt,
+		})
+	}
+
+	for _, block := range blocks {
+		if feed.RoomID != 0 && block.RoomID != feed.RoomID {
+			continue
+		}
+
+		cal.Events = append(cal.Events, ical.Event{
+			UID:          fmt.Sprintf("block-%d@%s", block.ID, domain),
+			Summary:      fmt.Sprintf("%s blocked: %s", block.Room.RoomName, block.Reason),
+			Start:        block.StartDate,
+			End:          block.EndDate,
+			Created:      block.CreatedAt,
+			LastModified: block.UpdatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if err := ical.Write(w, cal); err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// feedDomain returns the host name used to make event UIDs globally unique
+func (m *Repository) feedDomain() string {
+	u, err := url.Parse(m.App.BaseURL)
+	if err != nil || u.Hostname() == "" {
+		return "bookings"
+	}
+
+	return u.Hostname()
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRepository_CalendarFeed(t *testing.T) {
+	tests := []struct {
+		name         string
+		token        string
+		expectedCode int
+		expected     []string
+		unexpected   []string
+	}{
+		{
+			"Property",
+			"cal_test-property",
+			http.StatusOK,
+			[]string{"X-WR-CALNAME:Bookings", "UID:reservation-1@localhost", "SUMMARY:John Doe (Test)", "UID:block-7@localhost"},
+			nil,
+		},
+		{
+			"Room",
+			"cal_test-room",
+			http.StatusOK,
+			[]string{"X-WR-CALNAME:Test", "UID:reservation-1@localhost", "SUMMARY:Test blocked: Owner stay"},
+			nil,
+		},
+		{"Unknown secret", "cal_unknown", http.StatusNotFound, nil, []string{"BEGIN:VCALENDAR"}},
+	}
+
+	ts := httptest.NewTLSServer(getRoutes())
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := ts.Client().Get(fmt.Sprintf("%s/feeds/%s.ics", ts.URL, tt.token))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, resp.StatusCode)
+			}
+
+			if tt.expectedCode == http.StatusOK && !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/calendar") {
+				t.Errorf("expected a text/calendar response, got %q", resp.Header.Get("Content-Type"))
+			}
+
+			var body bytes.Buffer
+			body.ReadFrom(resp.Body)
+
+			for _, expected := range tt.expected {
+				if !strings.Contains(body.String(), expected) {
+					t.Errorf("expected the feed to contain %q", expected)
+				}
+			}
+
+			for _, unexpected := range tt.unexpected {
+				if strings.Contains(body.String(), unexpected) {
+					t.Errorf("expected the feed not to contain %q", unexpected)
+				}
+			}
+		})
+	}
+}
+
+func TestRepository_AdminCalendarFeeds(t *testing.T) {
+	req, err := http.NewRequest("GET", "/admin/feeds", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	app.Session.Put(ctx, "user", createTestUser(1, 3))
+	app.Session.Put(ctx, "new_feed_url", "http://localhost:8080/feeds/cal_new.ics")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminCalendarFeeds).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	for _, expected := range []string{"Cleaning team", "All rooms", "http://localhost:8080/feeds/cal_new.ics"} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected the page to contain %q", expected)
+		}
+	}
+}
+
+func TestRepository_PostAdminCreateCalendarFeed(t *testing.T) {
+	tests := []struct {
+		name          string
+		form          url.Values
+		expectedFlash string
+		expectedError string
+	}{
+		{"Property feed", url.Values{"feed_name": {"Owner phone"}}, "Calendar feed created. Copy its URL now, it won't be shown again", ""},
+		{"Room feed", url.Values{"feed_name": {"Cleaning team"}, "room_id": {"1"}}, "Calendar feed created. Copy its URL now, it won't be shown again", ""},
+		{"Short name", url.Values{"feed_name": {"ab"}}, "", "Feed name must be at least 3 characters long"},
+		{"Unknown room", url.Values{"feed_name": {"Cleaning team"}, "room_id": {"5"}}, "", "Room not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/admin/feeds", strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminCreateCalendarFeed).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/feeds" {
+				t.Errorf("expected redirect to /admin/feeds, got %d %s", rr.Code, rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			feedURL := app.Session.GetString(ctx, "new_feed_url")
+			if tt.expectedFlash != "" && (!strings.HasPrefix(feedURL, "http://localhost:8080/feeds/cal_") || !strings.HasSuffix(feedURL, ".ics")) {
+				t.Errorf("unexpected feed url %q", feedURL)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_PostAdminDeleteCalendarFeed(t *testing.T) {
+	tests := []struct {
+		name          string
+		feedID        string
+		expectedFlash string
+		expectedError string
+	}{
+		{"Revoke", "1", "Calendar feed revoked", ""},
+		{"Not found", "3", "", "Calendar feed not found"},
+		{"Invalid id", "a", "", "Invalid feed id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", fmt.Sprintf("/admin/feeds/%s/delete", tt.feedID), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.feedID)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminDeleteCalendarFeed).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/feeds" {
+				t.Errorf("expected redirect to /admin/feeds, got %d %s", rr.Code, rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/mlvieira/bookings/internal/forms"
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// party is who an availability search is for and how many rooms they want
+type party struct {
+	Adults   int
+	Children int
+	Rooms    int
+}
+
+// Guests returns the size of the party
+func (p party) Guests() int {
+	return p.Adults + p.Children
+}
+
+// minCapacity is the smallest room to search for. A party taking one room must fit in
+// it, one split across several rooms can use rooms of any size.
+func (p party) minCapacity() int {
+	if p.Rooms > 1 {
+		return 1
+	}
+
+	return p.Guests()
+}
+
+// fits reports whether the party can be split across the available rooms
+func (p party) fits(rooms []models.Room) bool {
+	if len(rooms) < p.Rooms {
+		return false
+	}
+
+	capacity := 0
+	for _, room := range rooms {
+		capacity += room.Capacity
+	}
+
+	return capacity >= p.Guests()
+}
+
+// parseParty reads the adults, children and rooms of an availability search. Searches
+// that don't ask, like links saved before guest counts existed, are for one adult in
+// one room.
+func parseParty(values url.Values) (party, error) {
+	p := party{Adults: 1, Rooms: 1}
+
+	var err error
+
+	if s := values.Get("rooms"); s != "" {
+		p.Rooms, err = strconv.Atoi(s)
+		if err != nil || p.Rooms < 1 || p.Rooms > maxCartItems {
+			return party{}, fmt.Errorf("Choose between 1 and %d rooms", maxCartItems)
+		}
+	}
+
+	maxGuests := p.Rooms * maxRoomCapacity
+
+	if s := values.Get("adults"); s != "" {
+		p.Adults, err = strconv.Atoi(s)
+		if err != nil || p.Adults < 1 || p.Adults > maxGuests {
+			return party{}, fmt.Errorf("Choose between 1 and %d adults", maxGuests)
+		}
+	}
+
+	if s := values.Get("children"); s != "" {
+		p.Children, err = strconv.Atoi(s)
+		if err != nil || p.Children < 0 || p.Children > maxGuests {
+			return party{}, fmt.Errorf("Choose between 0 and %d children", maxGuests)
+		}
+	}
+
+	if p.Adults < p.Rooms {
+		return party{}, errors.New("Each room needs at least one adult")
+	}
+
+	if p.Guests() > maxGuests {
+		return party{}, errors.New("Choose more rooms for that many guests")
+	}
+
+	return p, nil
+}
+
+// checkOccupancy returns an error when a room sleeping capacity guests can't fit the party
+func checkOccupancy(guests, capacity int) error {
+	if guests > capacity {
+		return fmt.Errorf("This room sleeps at most %d guests", capacity)
+	}
+
+	return nil
+}
+
+// validateGuests checks the adults and children fields of a booking form and that the
+// party fits a room sleeping capacity guests, adding the errors to the form. The counts
+// are returned as entered so an invalid form can show them again.
+func validateGuests(form *forms.Form, capacity int) (int, int) {
+	adults, _ := strconv.Atoi(form.Get("adults"))
+	children, _ := strconv.Atoi(form.Get("children"))
+
+	valid := form.IntBetween("adults", 1, maxRoomCapacity)
+	valid = form.IntBetween("children", 0, maxRoomCapacity) && valid
+	if !valid {
+		return adults, children
+	}
+
+	if err := checkOccupancy(adults+children, capacity); err != nil {
+		form.Errors.Add("adults", err.Error())
+	}
+
+	return adults, children
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/mlvieira/bookings/internal/forms"
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+func TestParseParty(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		expected  party
+		expectErr bool
+	}{
+		{"Not asked", "", party{Adults: 1, Rooms: 1}, false},
+		{"Family", "adults=2&children=3", party{Adults: 2, Children: 3, Rooms: 1}, false},
+		{"Family in two rooms", "adults=2&children=3&rooms=2", party{Adults: 2, Children: 3, Rooms: 2}, false},
+		{"Large group", "adults=30&rooms=2", party{Adults: 30, Rooms: 2}, false},
+		{"No adult", "adults=0", party{}, true},
+		{"Negative children", "children=-1", party{}, true},
+		{"Not a number", "adults=two", party{}, true},
+		{"Too many", "adults=15&children=6", party{}, true},
+		{"No rooms", "rooms=0", party{}, true},
+		{"Too many rooms", "adults=11&rooms=11", party{}, true},
+		{"Room without adult", "adults=1&children=1&rooms=2", party{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+
+			p, err := parseParty(values)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if p != tt.expected {
+				t.Errorf("got %+v, want %+v", p, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPartyFits(t *testing.T) {
+	rooms := []models.Room{{ID: 1, Capacity: 2}, {ID: 2, Capacity: 3}}
+
+	tests := []struct {
+		name        string
+		party       party
+		minCapacity int
+		expected    bool
+	}{
+		{"One room", party{Adults: 2, Rooms: 1}, 2, true},
+		{"Split across rooms", party{Adults: 2, Children: 3, Rooms: 2}, 1, true},
+		{"Too many guests", party{Adults: 4, Children: 2, Rooms: 2}, 1, false},
+		{"Too many rooms", party{Adults: 3, Rooms: 3}, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.party.minCapacity(); got != tt.minCapacity {
+				t.Errorf("minCapacity() = %d, want %d", got, tt.minCapacity)
+			}
+
+			if got := tt.party.fits(rooms); got != tt.expected {
+				t.Errorf("fits() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateGuests(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		capacity int
+		expected bool
+	}{
+		{"Fits", "adults=2&children=1", 3, true},
+		{"Over capacity", "adults=2&children=2", 3, false},
+		{"Missing", "adults=2", 3, false},
+		{"No adult", "adults=0&children=1", 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			form := forms.New(values)
+
+			validateGuests(form, tt.capacity)
+
+			if form.Valid() != tt.expected {
+				t.Errorf("expected valid %v, got errors %v", tt.expected, form.Errors)
+			}
+		})
+	}
+}
@@ -1,21 +1,30 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/mlvieira/bookings/internal/config"
 	"github.com/mlvieira/bookings/internal/driver"
+	"github.com/mlvieira/bookings/internal/emails"
 	"github.com/mlvieira/bookings/internal/forms"
 	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/lifecycle"
 	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/rbac"
 	"github.com/mlvieira/bookings/internal/render"
 	"github.com/mlvieira/bookings/internal/repository"
 	dbrepo "github.com/mlvieira/bookings/internal/repository/dbRepo"
+	"github.com/mlvieira/bookings/internal/tokens"
 )
 
 // Repo the repository used by the handlers
@@ -63,13 +72,25 @@ func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
 // RoomsPage handles the GET request for individual room page
 func (m *Repository) RoomsPage(w http.ResponseWriter, r *http.Request) {
 	room, err := m.DB.GetRoomByUrl(chi.URLParam(r, "room"))
-	if err != nil {
+	if err != nil || room.Active != 1 {
 		helpers.ClientError(w, http.StatusNotFound)
 		return
 	}
 
+	roomPhotos, err := m.DB.GetRoomPhotos(room.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// the gallery opens on the cover photo
+	sort.SliceStable(roomPhotos, func(i, j int) bool {
+		return roomPhotos[i].IsCover > roomPhotos[j].IsCover
+	})
+
 	data := make(map[string]any)
 	data["room"] = room
+	data["photos"] = roomPhotos
 
 	render.Template(w, r, "rooms.page.html", &models.TemplateData{
 		Data: data,
@@ -87,6 +108,13 @@ type jsonResponse struct {
 	Message string `json:"message"`
 }
 
+// availabilityResponse is the JSON response for a room availability search, with the price of the stay
+type availabilityResponse struct {
+	OK      bool          `json:"ok"`
+	Message string        `json:"message"`
+	Quote   *models.Quote `json:"quote,omitempty"`
+}
+
 // AvailabilityJSON handles the POST request and returns a JSON response
 func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
@@ -120,9 +148,44 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 	endDate, _ := time.Parse(layout, ed)
 
+	if !endDate.After(startDate) {
+		resp := jsonResponse{
+			OK:      false,
+			Message: "Departure must be after arrival",
+		}
+		out, _ := json.Marshal(resp)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	p, err := parseParty(r.Form)
+	if err != nil {
+		resp := jsonResponse{
+			OK:      false,
+			Message: err.Error(),
+		}
+		out, _ := json.Marshal(resp)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
 	roomID, _ := strconv.Atoi(r.FormValue("room_id"))
 
 	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+
+	var ruleErr *repository.StayRuleError
+	if errors.As(err, &ruleErr) {
+		resp := jsonResponse{
+			OK:      false,
+			Message: ruleErr.Violation.Message,
+		}
+		out, _ := json.Marshal(resp)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
 	if err != nil {
 		resp := jsonResponse{
 			OK:      false,
@@ -134,6 +197,22 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if available {
+		room, err := m.DB.GetRoomByID(roomID)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		} else if err := checkOccupancy(p.minCapacity(), room.Capacity); err != nil {
+			resp := jsonResponse{
+				OK:      false,
+				Message: err.Error(),
+			}
+			out, _ := json.Marshal(resp)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(out)
+			return
+		}
+	}
+
 	var msg string
 
 	if available {
@@ -142,15 +221,26 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 		msg = "Unavailable"
 	}
 
-	resp := jsonResponse{
+	resp := availabilityResponse{
 		OK:      available,
 		Message: msg,
 	}
 
+	if available {
+		quote, err := m.DB.QuoteStay(roomID, startDate, endDate)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		} else {
+			resp.Quote = &quote
+		}
+	}
+
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate:   endDate,
 		RoomID:    roomID,
+		Adults:    p.Adults,
+		Children:  p.Children,
 	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
@@ -195,25 +285,70 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	if !endDate.After(startDate) {
+		m.App.Session.Put(r.Context(), "error", "Departure must be after arrival")
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	p, err := parseParty(r.Form)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	rooms, excluded, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate, p.minCapacity())
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Error searching database")
 		http.Redirect(w, r, "/availability", http.StatusSeeOther)
 		return
 	}
 
-	if len(rooms) == 0 {
+	if len(rooms) == 0 && len(excluded) == 0 {
 		m.App.Session.Put(r.Context(), "error", "No availability")
 		http.Redirect(w, r, "/availability", http.StatusSeeOther)
 		return
 	}
 
+	if len(rooms) > 0 && !p.fits(rooms) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Not enough rooms are free to sleep %d guests in %d rooms on these dates", p.Guests(), p.Rooms))
+		http.Redirect(w, r, "/availability", http.StatusSeeOther)
+		return
+	}
+
+	if len(rooms) == 0 {
+		data := make(map[string]any)
+		data["excluded"] = excluded
+
+		m.App.Session.Put(r.Context(), "error", "No room can be booked for these dates")
+		render.Template(w, r, "availability.page.html", &models.TemplateData{
+			Data: data,
+		})
+		return
+	}
+
+	quotes := make(map[int]models.Quote)
+	for _, room := range rooms {
+		quote, err := m.DB.QuoteStay(room.ID, startDate, endDate)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			continue
+		}
+		quotes[room.ID] = quote
+	}
+
 	data := make(map[string]any)
 	data["rooms"] = rooms
+	data["quotes"] = quotes
+	data["excluded"] = excluded
+	data["party"] = p
 
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate:   endDate,
+		Adults:    p.Adults,
+		Children:  p.Children,
 	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
@@ -233,18 +368,33 @@ func (m *Repository) Booking(w http.ResponseWriter, r *http.Request) {
 	}
 
 	room, err := m.DB.GetRoomByID(res.RoomID)
-	if err != nil {
+	if err != nil || room.Active != 1 {
 		m.App.Session.Put(r.Context(), "error", "Room not found")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	res.Room.RoomName = room.RoomName
+	res.Room.Capacity = room.Capacity
+
+	if res.Adults == 0 {
+		res.Adults = 1
+	}
+
+	quote, err := m.DB.QuoteStay(res.RoomID, res.StartDate, res.EndDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Error pricing your stay")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	res.Total = quote.Total
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	data := make(map[string]any)
 	data["reservation"] = res
+	data["quote"] = quote
 
 	render.Template(w, r, "reservation.page.html", &models.TemplateData{
 		Form: forms.New(nil),
@@ -273,6 +423,15 @@ func (m *Repository) PostBooking(w http.ResponseWriter, r *http.Request) {
 	reservation.Email = r.Form.Get("email")
 	reservation.Phone = r.Form.Get("phone")
 
+	quote, err := m.DB.QuoteStay(reservation.RoomID, reservation.StartDate, reservation.EndDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Error pricing your stay")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	reservation.Total = quote.Total
+
 	form := forms.New(r.PostForm)
 
 	form.Required("first_name", "last_name", "email", "phone")
@@ -280,9 +439,12 @@ func (m *Repository) PostBooking(w http.ResponseWriter, r *http.Request) {
 	form.MinLength("last_name", 3)
 	form.IsEmail("email")
 
+	reservation.Adults, reservation.Children = validateGuests(form, reservation.Room.Capacity)
+
 	if !form.Valid() {
 		data := make(map[string]any)
 		data["reservation"] = reservation
+		data["quote"] = quote
 		http.Error(w, "error", http.StatusSeeOther)
 
 		render.Template(w, r, "reservation.page.html", &models.TemplateData{
@@ -293,63 +455,90 @@ func (m *Repository) PostBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lastID, err := m.DB.InsertReservation(reservation)
+	lastID, err := m.DB.BookRoom(reservation)
 	if err != nil {
+		var unavailable *repository.RoomUnavailableError
+		if errors.As(err, &unavailable) {
+			m.App.Session.Put(r.Context(), "error", "Sorry, this room is no longer available for the selected dates. Please search again.")
+			http.Redirect(w, r, "/availability", http.StatusSeeOther)
+			return
+		}
+
+		var ruleErr *repository.StayRuleError
+		if errors.As(err, &ruleErr) {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sorry, this stay can't be booked. %s.", ruleErr.Violation.Message))
+			http.Redirect(w, r, "/availability", http.StatusSeeOther)
+			return
+		}
+
+		var occupancyErr *repository.OccupancyError
+		if errors.As(err, &occupancyErr) {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sorry, this room sleeps at most %d guests. Please search again.", occupancyErr.Capacity))
+			http.Redirect(w, r, "/availability", http.StatusSeeOther)
+			return
+		}
+
 		m.App.Session.Put(r.Context(), "error", "Error inserting reservation in the database")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: lastID,
-		RestrictionID: 1,
-	}
+	reservation.ID = lastID
 
-	err = m.DB.InsertRoomRestriction(restriction)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Error inserting room restriction in the database")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
+	m.sendBookingEmails(reservation)
 
-	htmlMsg := fmt.Sprintf(`
-		<strong>Reservation Confirmation</strong><br/>
-		Dear %s, <br>
-		This is a confirmation of your reservation from %s to %s for the room %s.
-	`, reservation.FirstName, reservation.StartDate.Format("01-02-2006"), reservation.EndDate.Format("01-02-2006"), reservation.Room.RoomName)
+	m.App.Session.Put(r.Context(), "reservation", reservation)
 
-	msg := models.MailData{
-		To:       reservation.Email,
-		From:     "noreply@bookings.com",
-		Subject:  "Your Reservation is Confirmed! 🎉",
-		Content:  htmlMsg,
-		Template: "confirmation.html",
+	http.Redirect(w, r, "/book/summary", http.StatusSeeOther)
+}
+
+// queueMail stores an email in the outbox. Delivery happens in the background so a
+// slow or unavailable mail server never holds up the request.
+func (m *Repository) queueMail(msg models.MailData) {
+	if err := m.App.Outbox.Enqueue(msg); err != nil {
+		m.App.ErrorLog.Printf("queueing email to %s: %v", msg.To, err)
 	}
+}
 
-	m.App.MailChan <- msg
+// queueEmail renders the named email template and queues it for delivery to the given address
+func (m *Repository) queueEmail(to, name string, data emails.Data) {
+	msg, err := m.App.Emails.Render(name, data)
+	if err != nil {
+		m.App.ErrorLog.Printf("rendering email %s: %v", name, err)
+		return
+	}
 
-	htmlMsg = fmt.Sprintf(`
-		<strong>Your room has been booked</strong><br/>
-		We're here to tell you great news!
-		Your room %s has been booked from %s to %s.
-	`, reservation.Room.RoomName, reservation.StartDate.Format("01-02-2006"), reservation.EndDate.Format("01-02-2006"))
+	m.queueMail(models.MailData{
+		To:           to,
+		Subject:      msg.Subject,
+		Content:      msg.HTML,
+		PlainContent: msg.Text,
+		Template:     name,
+	})
+}
 
-	msg = models.MailData{
-		To:       "john@realstate",
-		From:     "noreply@bookings.com",
-		Subject:  fmt.Sprintf("Your room %s has been booked! 🎉", reservation.Room.RoomName),
-		Content:  htmlMsg,
-		Template: "confirmation.html",
+// notifyOwners queues the named email for every configured owner address
+func (m *Repository) notifyOwners(name string, data emails.Data) {
+	for _, owner := range m.App.Mail.OwnerEmails {
+		m.queueEmail(owner, name, data)
 	}
+}
 
-	m.App.MailChan <- msg
+// reservationEmailData builds the email template data for a reservation, including
+// the guest's manage link and the admin link for owners
+func (m *Repository) reservationEmailData(res models.Reservation) emails.Data {
+	return emails.ReservationData(res, emails.Links{
+		Manage: m.manageReservationURL(res),
+		Admin:  fmt.Sprintf("%s/admin/reservations/details/%d", m.App.BaseURL, res.ID),
+	})
+}
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
+// sendBookingEmails sends the booking confirmation to the guest and notifies the owner
+func (m *Repository) sendBookingEmails(res models.Reservation) {
+	data := m.reservationEmailData(res)
 
-	http.Redirect(w, r, "/book/summary", http.StatusSeeOther)
+	m.queueEmail(res.Email, emails.BookingConfirmation, data)
+	m.notifyOwners(emails.OwnerBooking, data)
 }
 
 // ReservationSummary handles the GET request with the data from the reservation sent
@@ -366,12 +555,104 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 	data := make(map[string]any)
 
 	data["reservation"] = reservation
+	if reservation.ID != 0 {
+		data["manageURL"] = m.manageReservationURL(reservation)
+	}
 
 	render.Template(w, r, "reservation-summary.page.html", &models.TemplateData{
 		Data: data,
 	})
 }
 
+// manageTokenPurpose binds reservation management tokens to the guest self-service pages
+const manageTokenPurpose = "reservation-manage"
+
+// manageReservationURL returns the signed link a guest uses to view or cancel a reservation.
+// The link stops working the day after departure.
+func (m *Repository) manageReservationURL(res models.Reservation) string {
+	return fmt.Sprintf("%s/reservations/manage/%s", m.App.BaseURL, m.manageReservationToken(res))
+}
+
+// manageReservationToken signs the token embedded in the guest's manage link
+func (m *Repository) manageReservationToken(res models.Reservation) string {
+	return tokens.Sign(m.App.SigningKey, manageTokenPurpose, res.ID, res.EndDate.AddDate(0, 0, 1))
+}
+
+// reservationFromToken loads the reservation referenced by the signed token in the URL
+func (m *Repository) reservationFromToken(r *http.Request) (models.Reservation, error) {
+	id, err := tokens.Verify(m.App.SigningKey, manageTokenPurpose, chi.URLParam(r, "token"), time.Now())
+	if err != nil {
+		return models.Reservation{}, err
+	}
+
+	return m.DB.GetReservationById(id)
+}
+
+// guestCanCancel reports whether a guest may still cancel a reservation
+func guestCanCancel(res models.Reservation) bool {
+	return lifecycle.Status(res.Status).CanTransition(lifecycle.Cancelled) && time.Now().Before(res.StartDate)
+}
+
+// ManageReservation handles the GET request for a guest viewing a reservation through a signed link
+func (m *Repository) ManageReservation(w http.ResponseWriter, r *http.Request) {
+	res, err := m.reservationFromToken(r)
+	if errors.Is(err, tokens.ErrExpiredToken) {
+		m.App.Session.Put(r.Context(), "error", "This link has expired")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	data := make(map[string]any)
+	data["reservation"] = res
+	data["token"] = chi.URLParam(r, "token")
+	data["canCancel"] = guestCanCancel(res)
+
+	render.Template(w, r, "manage-reservation.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// PostCancelReservation handles the POST request for a guest cancelling a reservation through a signed link
+func (m *Repository) PostCancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, err := m.reservationFromToken(r)
+	if errors.Is(err, tokens.ErrExpiredToken) {
+		m.App.Session.Put(r.Context(), "error", "This link has expired")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	manageURL := fmt.Sprintf("/reservations/manage/%s", chi.URLParam(r, "token"))
+
+	if !guestCanCancel(res) {
+		m.App.Session.Put(r.Context(), "error", "This reservation can no longer be cancelled")
+		http.Redirect(w, r, manageURL, http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.TransitionReservation(res.ID, lifecycle.Cancelled)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Error cancelling reservation")
+		http.Redirect(w, r, manageURL, http.StatusSeeOther)
+		return
+	}
+
+	data := m.reservationEmailData(res)
+
+	m.queueEmail(res.Email, emails.BookingCancelled, data)
+	m.notifyOwners(emails.OwnerCancellation, data)
+
+	m.App.Session.Put(r.Context(), "flash", "Your reservation has been cancelled")
+	http.Redirect(w, r, manageURL, http.StatusSeeOther)
+}
+
 // About handles the GET request for the about page
 func (m *Repository) About(w http.ResponseWriter, r *http.Request) {
 
@@ -467,25 +748,8 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
-func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
-	if !ok {
-		_ = m.App.Session.Destroy(r.Context())
-		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
-		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
-		return
-	}
-
-	data := make(map[string]any)
-	data["user"] = user
-
-	render.Template(w, r, "admin-dashboard.page.html", &models.TemplateData{
-		Data: data,
-	})
-}
-
 func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
+	user, ok := helpers.CurrentUser(r)
 	if !ok {
 		_ = m.App.Session.Destroy(r.Context())
 		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
@@ -493,23 +757,14 @@ func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	reservations, err := m.DB.AllNewReservations()
-	if err != nil {
-		helpers.ServerError(w, err)
-		return
-	}
-
 	data := make(map[string]any)
-	data["reservations"] = reservations
 	data["user"] = user
 
-	render.Template(w, r, "admin-new-reservations.page.html", &models.TemplateData{
-		Data: data,
-	})
+	m.renderReservationList(w, r, "admin-new-reservations.page.html", string(lifecycle.Pending), false, data)
 }
 
 func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
+	user, ok := helpers.CurrentUser(r)
 	if !ok {
 		_ = m.App.Session.Destroy(r.Context())
 		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
@@ -517,19 +772,11 @@ func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	reservations, err := m.DB.AllReservations(nil, nil)
-	if err != nil {
-		helpers.ServerError(w, err)
-		return
-	}
-
 	data := make(map[string]any)
-	data["reservations"] = reservations
 	data["user"] = user
+	data["export_columns"] = exportColumns
 
-	render.Template(w, r, "admin-all-reservations.page.html", &models.TemplateData{
-		Data: data,
-	})
+	m.renderReservationList(w, r, "admin-all-reservations.page.html", "", true, data)
 }
 
 func (m *Repository) JsonAdminCalendarReservations(w http.ResponseWriter, r *http.Request) {
@@ -574,24 +821,46 @@ func (m *Repository) JsonAdminCalendarReservations(w http.ResponseWriter, r *htt
 		return
 	}
 
+	blocks, err := m.DB.RoomBlocksBetween(start, end)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+
 	var calendarResponses []models.CalendarResponse
 
+	user, _ := helpers.CurrentUser(r)
+	canEdit := rbac.Can(user.AccessLevel, rbac.EditReservations)
+
 	for _, res := range reservations {
-		calendarResponse := models.CalendarResponse{
-			ID:       fmt.Sprintf("%d", res.ID),
-			Title:    fmt.Sprintf("%s room reservation", res.Room.RoomName),
-			Start:    res.StartDate,
-			End:      res.EndDate,
+		if lifecycle.Status(res.Status).ReleasesRoom() {
+			continue
+		}
+
+		calendarResponses = append(calendarResponses, reservationCalendarEvent(res, canEdit))
+	}
+
+	for _, block := range blocks {
+		calendarResponses = append(calendarResponses, models.CalendarResponse{
+			ID:       fmt.Sprintf("block-%d", block.ID),
+			Title:    fmt.Sprintf("%s blocked: %s", block.Room.RoomName, block.Reason),
+			Start:    block.StartDate,
+			End:      block.EndDate,
 			AllDay:   true,
-			Url:      fmt.Sprintf("/admin/reservations/details/%d", res.ID),
+			Url:      fmt.Sprintf("/admin/rooms/%d/blocks", block.RoomID),
 			Editable: false,
+			Color:    "#6c757d",
 			ExtendedProps: map[string]any{
-				"name":        fmt.Sprintf("%s %s", res.FirstName, res.LastName),
-				"room":        res.Room.RoomName,
-				"lastUpdated": res.UpdatedAt,
+				"type":        "block",
+				"room":        block.Room.RoomName,
+				"reason":      block.Reason,
+				"lastUpdated": block.UpdatedAt,
 			},
-		}
-		calendarResponses = append(calendarResponses, calendarResponse)
+		})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -601,8 +870,30 @@ func (m *Repository) JsonAdminCalendarReservations(w http.ResponseWriter, r *htt
 
 }
 
+// reservationCalendarEvent shows a reservation on the admin calendar. Users who may edit
+// reservations can drag the stays that haven't started to other dates.
+func reservationCalendarEvent(res models.Reservation, canEdit bool) models.CalendarResponse {
+	return models.CalendarResponse{
+		ID:       fmt.Sprintf("%d", res.ID),
+		Title:    fmt.Sprintf("%s room reservation", res.Room.RoomName),
+		Start:    res.StartDate,
+		End:      res.EndDate,
+		AllDay:   true,
+		Url:      fmt.Sprintf("/admin/reservations/details/%d", res.ID),
+		Editable: canEdit && lifecycle.CanReschedule(res.Status, res.StartDate, time.Now()),
+		ExtendedProps: map[string]any{
+			"type":        "reservation",
+			"name":        fmt.Sprintf("%s %s", res.FirstName, res.LastName),
+			"room":        res.Room.RoomName,
+			"roomId":      res.RoomID,
+			"status":      res.Status,
+			"lastUpdated": res.UpdatedAt,
+		},
+	}
+}
+
 func (m *Repository) AdminCalendarReservations(w http.ResponseWriter, r *http.Request) {
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
+	user, ok := helpers.CurrentUser(r)
 	if !ok {
 		_ = m.App.Session.Destroy(r.Context())
 		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
@@ -627,7 +918,7 @@ func (m *Repository) AdminReservationSummary(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
+	user, ok := helpers.CurrentUser(r)
 	if !ok {
 		_ = m.App.Session.Destroy(r.Context())
 		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
@@ -642,9 +933,26 @@ func (m *Repository) AdminReservationSummary(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	rooms, err := m.DB.ListRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	data := make(map[string]any)
 	data["reservation"] = res
 	data["user"] = user
+	data["rooms"] = rooms
+	data["canReschedule"] = lifecycle.CanReschedule(res.Status, res.StartDate, time.Now())
+
+	if res.GroupID != 0 {
+		group, err := m.DB.GetGroupReservations(res.GroupID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data["group"] = group
+	}
 
 	render.Template(w, r, "admin-reservations-summary.page.html", &models.TemplateData{
 		Data: data,
@@ -687,8 +995,15 @@ func (m *Repository) PostAdminReservationSummary(w http.ResponseWriter, r *http.
 	form.MinLength("last_name", 3)
 	form.IsEmail("email")
 
+	res.Adults, res.Children = validateGuests(form, res.Room.Capacity)
+
 	if !form.Valid() {
-		m.App.Session.Put(r.Context(), "error", "Invalid form values")
+		msg := "Invalid form values"
+		if guestsErr := form.Errors.Get("adults"); guestsErr != "" {
+			msg = guestsErr
+		}
+
+		m.App.Session.Put(r.Context(), "error", msg)
 		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/details/%d", resStr), http.StatusSeeOther)
 		return
 	}
@@ -707,36 +1022,50 @@ type payloadStatus struct {
 	ID int `json:"id"`
 }
 
+type payloadTransition struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+// PostJsonAdminChangeResStatus moves a reservation to the status in the payload
 func (m *Repository) PostJsonAdminChangeResStatus(w http.ResponseWriter, r *http.Request) {
-	var payload payloadStatus
+	var payload payloadTransition
+
+	resp := jsonResponse{
+		OK:      true,
+		Message: "Reservation status has been changed!",
+	}
 
 	err := json.NewDecoder(r.Body).Decode(&payload)
 	if err != nil {
-		resp := jsonResponse{
+		resp = jsonResponse{
 			OK:      false,
 			Message: "Internal server error",
 		}
-		out, _ := json.Marshal(resp)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
-		return
-	}
-
-	err = m.DB.UpdateProcessedForReservation(payload.ID, 1)
-	if err != nil {
-		resp := jsonResponse{
+	} else if to := lifecycle.Status(payload.Status); !to.Valid() {
+		resp = jsonResponse{
 			OK:      false,
-			Message: "Error updating database",
+			Message: "Unknown status",
+		}
+	} else {
+		err = m.DB.TransitionReservation(payload.ID, to)
+		switch {
+		case errors.Is(err, lifecycle.ErrTransition):
+			resp = jsonResponse{
+				OK:      false,
+				Message: fmt.Sprintf("This reservation can't be marked as %s", strings.ToLower(to.Name())),
+			}
+		case errors.Is(err, sql.ErrNoRows):
+			resp = jsonResponse{
+				OK:      false,
+				Message: "Reservation not found",
+			}
+		case err != nil:
+			resp = jsonResponse{
+				OK:      false,
+				Message: "Error updating database",
+			}
 		}
-		out, _ := json.Marshal(resp)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
-		return
-	}
-
-	resp := jsonResponse{
-		OK:      true,
-		Message: "Reservation status has been changed!",
 	}
 
 	out, _ := json.Marshal(resp)
@@ -814,7 +1143,12 @@ func (m *Repository) PostAdminCreateUser(w http.ResponseWriter, r *http.Request)
 	form.MinLength("last_name", 3)
 	form.MinLength("password", 8)
 	form.IsEmail("email")
-	form.IsInt("access_level")
+	if form.IsInt("access_level") {
+		level, _ := strconv.Atoi(accessLevel)
+		if !rbac.Role(level).Valid() {
+			form.Errors.Add("access_level", "Choose a valid role")
+		}
+	}
 
 	if !form.Valid() {
 		data := make(map[string]any)
@@ -840,14 +1174,14 @@ func (m *Repository) PostAdminCreateUser(w http.ResponseWriter, r *http.Request)
 }
 
 func (m *Repository) AdminListUsers(w http.ResponseWriter, r *http.Request) {
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
+	user, ok := helpers.CurrentUser(r)
 	if !ok {
 		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
 	}
 
-	if !helpers.HasPermission(user.AccessLevel, 3) {
+	if !rbac.Can(user.AccessLevel, rbac.ManageUsers) {
 		m.App.Session.Put(r.Context(), "error", "You don't have permission for this")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
@@ -869,14 +1203,14 @@ func (m *Repository) AdminListUsers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Repository) AdminUserSummary(w http.ResponseWriter, r *http.Request) {
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
+	user, ok := helpers.CurrentUser(r)
 	if !ok {
 		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
 	}
 
-	if !helpers.HasPermission(user.AccessLevel, 3) {
+	if !rbac.Can(user.AccessLevel, rbac.ManageUsers) {
 		m.App.Session.Put(r.Context(), "error", "You don't have permission for this")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
@@ -897,24 +1231,35 @@ func (m *Repository) AdminUserSummary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	apiTokens, err := m.DB.ListAPITokens(usrStr)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	data := make(map[string]any)
 	data["user"] = userData
+	data["apiTokens"] = apiTokens
+
+	stringMap := make(map[string]string)
+	stringMap["new_api_token"] = m.App.Session.PopString(r.Context(), "new_api_token")
 
 	render.Template(w, r, "admin-user-summary.page.html", &models.TemplateData{
-		Data: data,
-		Form: forms.New(nil),
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(nil),
 	})
 }
 
 func (m *Repository) PostAdminUserSummary(w http.ResponseWriter, r *http.Request) {
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
+	user, ok := helpers.CurrentUser(r)
 	if !ok {
 		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
 	}
 
-	if !helpers.HasPermission(user.AccessLevel, 3) {
+	if !rbac.Can(user.AccessLevel, rbac.ManageUsers) {
 		m.App.Session.Put(r.Context(), "error", "You don't have permission for this")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
@@ -950,7 +1295,12 @@ func (m *Repository) PostAdminUserSummary(w http.ResponseWriter, r *http.Request
 	form.MinLength("last_name", 3)
 	form.MinLength("password", 8)
 	form.IsEmail("email")
-	form.IsInt("access_level")
+	if form.IsInt("access_level") {
+		level, _ := strconv.Atoi(accessLevel)
+		if !rbac.Role(level).Valid() {
+			form.Errors.Add("access_level", "Choose a valid role")
+		}
+	}
 
 	if !form.Valid() {
 		m.App.Session.Put(r.Context(), "error", "Invalid form values")
@@ -971,7 +1321,7 @@ func (m *Repository) PostAdminUserSummary(w http.ResponseWriter, r *http.Request
 }
 
 func (m *Repository) PostJsonAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
+	user, ok := helpers.CurrentUser(r)
 	if !ok {
 		resp := jsonResponse{
 			OK:      false,
@@ -983,13 +1333,14 @@ func (m *Repository) PostJsonAdminDeleteUser(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if !helpers.HasPermission(user.AccessLevel, 3) {
+	if !rbac.Can(user.AccessLevel, rbac.ManageUsers) {
 		resp := jsonResponse{
 			OK:      false,
 			Message: "You don't have permission for this",
 		}
 		out, _ := json.Marshal(resp)
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
 		w.Write(out)
 		return
 	}
@@ -1029,3 +1380,214 @@ func (m *Repository) PostJsonAdminDeleteUser(w http.ResponseWriter, r *http.Requ
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(out)
 }
+
+// PostAdminCreateAPIToken creates a personal API token for a user. The token is shown once.
+func (m *Repository) PostAdminCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := helpers.CurrentUser(r)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	if !rbac.Can(user.AccessLevel, rbac.ManageUsers) {
+		m.App.Session.Put(r.Context(), "error", "You don't have permission for this")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid user id")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("token_name")
+	form.MinLength("token_name", 3)
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Token name must be at least 3 characters long")
+		http.Redirect(w, r, fmt.Sprintf("/admin/users/details/%d", userID), http.StatusSeeOther)
+		return
+	}
+
+	token, err := tokens.NewAPIToken()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = m.DB.CreateAPIToken(models.APIToken{
+		UserID:    userID,
+		Name:      r.Form.Get("token_name"),
+		TokenHash: tokens.HashAPIToken(token),
+	})
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Error creating API token")
+		http.Redirect(w, r, fmt.Sprintf("/admin/users/details/%d", userID), http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "new_api_token", token)
+	m.App.Session.Put(r.Context(), "flash", "API token created. Copy it now, it won't be shown again")
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/details/%d", userID), http.StatusSeeOther)
+}
+
+// PostAdminRevokeAPIToken deletes a personal API token of a user
+func (m *Repository) PostAdminRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := helpers.CurrentUser(r)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	if !rbac.Can(user.AccessLevel, rbac.ManageUsers) {
+		m.App.Session.Put(r.Context(), "error", "You don't have permission for this")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid user id")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	tokenID, err := strconv.Atoi(chi.URLParam(r, "tokenID"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid token id")
+		http.Redirect(w, r, fmt.Sprintf("/admin/users/details/%d", userID), http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.DeleteAPIToken(userID, tokenID)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "API token not found")
+		http.Redirect(w, r, fmt.Sprintf("/admin/users/details/%d", userID), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "API token revoked")
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/details/%d", userID), http.StatusSeeOther)
+}
+
+// outboxPageSize is the number of emails listed on the admin mail page
+const outboxPageSize = 200
+
+// AdminMailOutbox lists queued, sent and failed emails
+func (m *Repository) AdminMailOutbox(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.OutboxQueued, models.OutboxSent, models.OutboxFailed:
+	default:
+		status = ""
+	}
+
+	messages, err := m.DB.ListOutboxMessages(status, outboxPageSize)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["messages"] = messages
+
+	stringMap := make(map[string]string)
+	stringMap["status"] = status
+
+	render.Template(w, r, "admin-mail-outbox.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// PostAdminResendMail puts an email back in the outbox queue with a fresh attempt count
+func (m *Repository) PostAdminResendMail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid email id")
+		http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.RequeueOutboxMessage(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Email not found")
+		http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Outbox.Notify()
+
+	m.App.Session.Put(r.Context(), "flash", "Email queued for delivery")
+	http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+}
+
+// AdminMailTemplates lists the email templates with links to preview them
+func (m *Repository) AdminMailTemplates(w http.ResponseWriter, r *http.Request) {
+	sample := emails.SampleData(m.App.BaseURL)
+
+	subjects := make(map[string]string)
+	for _, name := range m.App.Emails.Names() {
+		msg, err := m.App.Emails.Render(name, sample)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		subjects[name] = msg.Subject
+	}
+
+	data := make(map[string]any)
+	data["templates"] = m.App.Emails.Names()
+	data["subjects"] = subjects
+
+	render.Template(w, r, "admin-mail-templates.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminPreviewMailTemplate renders an email template with sample data. The HTML part
+// is shown by default, ?format=text shows the plain-text alternative.
+func (m *Repository) AdminPreviewMailTemplate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !m.App.Emails.Has(name) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	msg, err := m.App.Emails.Render(name, emails.SampleData(m.App.BaseURL))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Subject: %s\n\n%s", msg.Subject, msg.Text)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, msg.HTML)
+}
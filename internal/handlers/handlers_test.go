@@ -17,6 +17,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/mlvieira/bookings/internal/driver"
 	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/tokens"
 )
 
 func mockDB() *driver.DB {
@@ -36,12 +37,16 @@ func getCtx(req *http.Request) context.Context {
 
 func createTestReservation(roomID int, roomName string) models.Reservation {
 	return models.Reservation{
-		RoomID: roomID,
+		RoomID:    roomID,
+		StartDate: time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC),
+		Adults:    1,
 		Room: models.Room{
 			ID:              roomID,
 			RoomName:        roomName,
 			RoomDescription: "Test",
 			RoomURL:         "test-url",
+			Capacity:        2,
 		},
 	}
 }
@@ -141,9 +146,11 @@ var testsData = []testsDataType{
 	{"Valid Room Page", "/rooms/majors-suite", http.StatusOK},
 	{"Valid Contact", "/contact", http.StatusOK},
 	{"Valid Availability GET", "/availability", http.StatusOK},
+	{"Empty cart", "/cart", http.StatusOK},
 	{"Valid login page GET", "/user/login", http.StatusOK},
 	{"Page not found", "/a", http.StatusNotFound},
 	{"Room not found", "/rooms/a", http.StatusNotFound},
+	{"Inactive room", "/rooms/closed-suite", http.StatusNotFound},
 }
 
 func TestHandlers(t *testing.T) {
@@ -229,6 +236,8 @@ func TestRepository_PostBooking(t *testing.T) {
 		form.Add("last_name", "Doe")
 		form.Add("email", "john@example.com")
 		form.Add("phone", "55555555")
+		form.Add("adults", "1")
+		form.Add("children", "0")
 		executePostBookingTest(t, true, true, http.StatusSeeOther, "/book/summary", form, createTestReservation(1, "test"))
 	})
 
@@ -246,26 +255,78 @@ func TestRepository_PostBooking(t *testing.T) {
 		form.Add("last_name", "Doe")
 		form.Add("email", "john@example")
 		form.Add("phone", "55555555")
+		form.Add("adults", "1")
+		form.Add("children", "0")
 		executePostBookingTest(t, true, true, http.StatusSeeOther, "", form, createTestReservation(1, "test"))
 	})
 
-	t.Run("Database error: InsertReservation", func(t *testing.T) {
+	t.Run("Database error: BookRoom", func(t *testing.T) {
 		form := url.Values{}
 		form.Add("first_name", "John")
 		form.Add("last_name", "Doe")
 		form.Add("email", "john@at.com")
 		form.Add("phone", "55555555")
+		form.Add("adults", "1")
+		form.Add("children", "0")
 		executePostBookingTest(t, true, true, http.StatusSeeOther, "/", form, createTestReservation(1, "test"))
 	})
 
-	t.Run("Database error: InsertRoomRestriction", func(t *testing.T) {
+	t.Run("Database error: BookRoom room", func(t *testing.T) {
 		form := url.Values{}
 		form.Add("first_name", "John")
 		form.Add("last_name", "Doe")
 		form.Add("email", "john@example.com")
 		form.Add("phone", "55555555")
+		form.Add("adults", "1")
+		form.Add("children", "0")
 		executePostBookingTest(t, true, true, http.StatusSeeOther, "/", form, createTestReservation(404, "test"))
 	})
+
+	t.Run("Room no longer available", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("first_name", "John")
+		form.Add("last_name", "Doe")
+		form.Add("email", "john@example.com")
+		form.Add("phone", "55555555")
+		form.Add("adults", "1")
+		form.Add("children", "0")
+		executePostBookingTest(t, true, true, http.StatusSeeOther, "/availability", form, createTestReservation(409, "test"))
+	})
+
+	t.Run("Stay rule", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("first_name", "John")
+		form.Add("last_name", "Doe")
+		form.Add("email", "john@example.com")
+		form.Add("phone", "55555555")
+		form.Add("adults", "1")
+		form.Add("children", "0")
+		executePostBookingTest(t, true, true, http.StatusSeeOther, "/availability", form, createTestReservation(423, "test"))
+	})
+
+	t.Run("Too many guests", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("first_name", "John")
+		form.Add("last_name", "Doe")
+		form.Add("email", "john@example.com")
+		form.Add("phone", "55555555")
+		form.Add("adults", "2")
+		form.Add("children", "1")
+		executePostBookingTest(t, true, true, http.StatusSeeOther, "", form, createTestReservation(1, "test"))
+	})
+
+	t.Run("Room sleeps fewer guests", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("first_name", "John")
+		form.Add("last_name", "Doe")
+		form.Add("email", "john@example.com")
+		form.Add("phone", "55555555")
+		form.Add("adults", "3")
+		form.Add("children", "0")
+		res := createTestReservation(1, "test")
+		res.Room.Capacity = 4
+		executePostBookingTest(t, true, true, http.StatusSeeOther, "/availability", form, res)
+	})
 }
 
 func TestRepository_AvailabilityJSON(t *testing.T) {
@@ -322,6 +383,46 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 	t.Run("Room Available", func(t *testing.T) {
 		executeAvailabilityJSONTest(t, true, true, "Available", "12-17-2050", "12-18-2050", "1")
 	})
+
+	t.Run("Departure before arrival", func(t *testing.T) {
+		executeAvailabilityJSONTest(t, true, false, "Departure must be after arrival", "12-18-2050", "12-17-2050", "1")
+	})
+
+	t.Run("Stay rule", func(t *testing.T) {
+		executeAvailabilityJSONTest(t, true, false, "The minimum stay is 3 nights", "12-17-2050", "12-18-2050", "3")
+	})
+}
+
+func TestRepository_AvailabilityJSONQuote(t *testing.T) {
+	form := url.Values{}
+	form.Add("start_date", "12-17-2050")
+	form.Add("end_date", "12-20-2050")
+	form.Add("room_id", "1")
+
+	req, err := http.NewRequest("POST", "/availability/json", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AvailabilityJSON).ServeHTTP(rr, req)
+
+	var j availabilityResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+		t.Fatal("failed parsing json")
+	}
+
+	if j.Quote == nil {
+		t.Fatal("expected a quote for an available room")
+	}
+
+	if len(j.Quote.Nights) != 3 || j.Quote.Total <= 0 {
+		t.Errorf("unexpected quote: %+v", j.Quote)
+	}
 }
 
 func TestRepository_PostAvailability(t *testing.T) {
@@ -385,11 +486,99 @@ func TestRepository_PostAvailability(t *testing.T) {
 	})
 
 	t.Run("No room available", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("start_date", "12-15-2050")
+		form.Add("end_date", "12-18-2050")
+		execPostAvailability(t, true, http.StatusSeeOther, "/availability", form)
+	})
+
+	t.Run("Zero nights", func(t *testing.T) {
 		form := url.Values{}
 		form.Add("start_date", "12-18-2050")
 		form.Add("end_date", "12-18-2050")
 		execPostAvailability(t, true, http.StatusSeeOther, "/availability", form)
 	})
+
+	t.Run("Party fits a room", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("start_date", "12-17-2049")
+		form.Add("end_date", "12-20-2049")
+		form.Add("adults", "1")
+		form.Add("children", "1")
+		execPostAvailability(t, true, http.StatusOK, "", form)
+	})
+
+	t.Run("No room sleeps the party", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("start_date", "12-17-2049")
+		form.Add("end_date", "12-20-2049")
+		form.Add("adults", "2")
+		form.Add("children", "1")
+		execPostAvailability(t, true, http.StatusSeeOther, "/availability", form)
+	})
+
+	t.Run("Not enough rooms free for the party", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("start_date", "12-17-2049")
+		form.Add("end_date", "12-20-2049")
+		form.Add("adults", "2")
+		form.Add("children", "1")
+		form.Add("rooms", "2")
+		execPostAvailability(t, true, http.StatusSeeOther, "/availability", form)
+	})
+
+	t.Run("Party in one of the rooms free", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("start_date", "12-17-2049")
+		form.Add("end_date", "12-20-2049")
+		form.Add("adults", "2")
+		form.Add("rooms", "1")
+		execPostAvailability(t, true, http.StatusOK, "", form)
+	})
+
+	t.Run("Invalid guests", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("start_date", "12-17-2049")
+		form.Add("end_date", "12-20-2049")
+		form.Add("adults", "0")
+		execPostAvailability(t, true, http.StatusSeeOther, "/availability", form)
+	})
+
+	t.Run("Departure before arrival", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("start_date", "12-20-2050")
+		form.Add("end_date", "12-15-2050")
+		execPostAvailability(t, true, http.StatusSeeOther, "/availability", form)
+	})
+}
+
+func TestRepository_PostAvailabilityStayRules(t *testing.T) {
+	form := url.Values{}
+	form.Add("start_date", "12-15-2050")
+	form.Add("end_date", "12-19-2050")
+
+	req, err := http.NewRequest("POST", "/availability", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.PostAvailability).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	body := rr.Body.String()
+	for _, expected := range []string{"No room can be booked for these dates", "Major&#39;s Suite", "The minimum stay is 3 nights"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected the page to contain %q", expected)
+		}
+	}
 }
 
 func TestRepository_ReservationSummary(t *testing.T) {
@@ -631,6 +820,15 @@ func TestRepository_AdminCalendarReservations(t *testing.T) {
 					"lastUpdated": time.Now(),
 				},
 			},
+			{
+				ID:     "block-7",
+				Title:  "Test blocked: Owner stay",
+				Start:  time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+				End:    time.Date(2024, 12, 3, 0, 0, 0, 0, time.UTC),
+				AllDay: true,
+				Url:    "/admin/rooms/1/blocks",
+				Color:  "#6c757d",
+			},
 		}
 
 		path := "/admin/reservations/calendar/json?start=2024-12-01T00:00:00Z&end=2024-12-08T00:00:00Z"
@@ -795,6 +993,19 @@ func TestRepository_PostAdminReservationSummary(t *testing.T) {
 		form.Add("last_name", "Doe")
 		form.Add("email", "john@example.com")
 		form.Add("phone", "555555555")
+		form.Add("adults", "1")
+		form.Add("children", "1")
+		execLogout(t, "1", "/admin/reservations/details/1", http.StatusSeeOther, true, true, form, models.User{}, http.HandlerFunc(Repo.PostAdminReservationSummary))
+	})
+
+	t.Run("POST - Reservation Summary - Too many guests", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("first_name", "John")
+		form.Add("last_name", "Doe")
+		form.Add("email", "john@example.com")
+		form.Add("phone", "555555555")
+		form.Add("adults", "2")
+		form.Add("children", "1")
 		execLogout(t, "1", "/admin/reservations/details/1", http.StatusSeeOther, true, true, form, models.User{}, http.HandlerFunc(Repo.PostAdminReservationSummary))
 	})
 
@@ -830,3 +1041,717 @@ func TestRepository_PostAdminReservationSummary(t *testing.T) {
 	})
 
 }
+
+func TestRepository_ManageReservation(t *testing.T) {
+	execManage := func(
+		t *testing.T,
+		method,
+		token string,
+		expectedCode int,
+		expectedLocation string,
+		handler http.HandlerFunc,
+	) {
+		req, err := http.NewRequest(method, fmt.Sprintf("/reservations/manage/%s", token), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", token)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		handleBookingRequest(t, req, false, expectedCode, expectedLocation, models.Reservation{}, handler)
+	}
+
+	validToken := func(id int) string {
+		return tokens.Sign(app.SigningKey, manageTokenPurpose, id, time.Now().Add(time.Hour))
+	}
+	expiredToken := tokens.Sign(app.SigningKey, manageTokenPurpose, 1, time.Now().Add(-time.Hour))
+
+	t.Run("GET - Valid token", func(t *testing.T) {
+		execManage(t, "GET", validToken(1), http.StatusOK, "", http.HandlerFunc(Repo.ManageReservation))
+	})
+
+	t.Run("GET - Invalid token", func(t *testing.T) {
+		execManage(t, "GET", "invalid", http.StatusNotFound, "", http.HandlerFunc(Repo.ManageReservation))
+	})
+
+	t.Run("GET - Expired token", func(t *testing.T) {
+		execManage(t, "GET", expiredToken, http.StatusSeeOther, "/", http.HandlerFunc(Repo.ManageReservation))
+	})
+
+	t.Run("GET - Reservation not found", func(t *testing.T) {
+		execManage(t, "GET", validToken(2), http.StatusNotFound, "", http.HandlerFunc(Repo.ManageReservation))
+	})
+
+	t.Run("POST - Cancel", func(t *testing.T) {
+		token := validToken(1)
+		execManage(t, "POST", token, http.StatusSeeOther, "/reservations/manage/"+token, http.HandlerFunc(Repo.PostCancelReservation))
+	})
+
+	t.Run("POST - Cancel already cancelled", func(t *testing.T) {
+		token := validToken(4)
+		execManage(t, "POST", token, http.StatusSeeOther, "/reservations/manage/"+token, http.HandlerFunc(Repo.PostCancelReservation))
+	})
+
+	t.Run("POST - Cancel DB error", func(t *testing.T) {
+		token := validToken(3)
+		execManage(t, "POST", token, http.StatusSeeOther, "/reservations/manage/"+token, http.HandlerFunc(Repo.PostCancelReservation))
+	})
+
+	t.Run("POST - Cancel invalid token", func(t *testing.T) {
+		execManage(t, "POST", "invalid", http.StatusNotFound, "", http.HandlerFunc(Repo.PostCancelReservation))
+	})
+
+	t.Run("POST - Cancel expired token", func(t *testing.T) {
+		execManage(t, "POST", expiredToken, http.StatusSeeOther, "/", http.HandlerFunc(Repo.PostCancelReservation))
+	})
+}
+
+func TestRepository_AdminAPITokens(t *testing.T) {
+	execTokens := func(
+		t *testing.T,
+		path string,
+		params map[string]string,
+		form url.Values,
+		user models.User,
+		expectedLocation string,
+		expectedFlash string,
+		handler http.HandlerFunc,
+	) {
+		req, err := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rctx := chi.NewRouteContext()
+		for k, v := range params {
+			rctx.URLParams.Add(k, v)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		app.Session.Put(ctx, "user", user)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("Handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+		}
+
+		if location := rr.Header().Get("Location"); location != expectedLocation {
+			t.Errorf("Handler redirected to wrong URL: got %s, wanted %s", location, expectedLocation)
+		}
+
+		if flash := app.Session.GetString(ctx, "flash"); flash != expectedFlash {
+			t.Errorf("unexpected flash %q, wanted %q", flash, expectedFlash)
+		}
+
+		if expectedFlash != "" && strings.HasPrefix(expectedFlash, "API token created") {
+			if token := app.Session.GetString(ctx, "new_api_token"); !strings.HasPrefix(token, tokens.APITokenPrefix) {
+				t.Errorf("expected the new token in the session, got %q", token)
+			}
+		}
+
+		app.Session.Destroy(ctx)
+	}
+
+	admin := createTestUser(1, 3)
+	named := url.Values{"token_name": {"Nightly export"}}
+
+	t.Run("Create", func(t *testing.T) {
+		execTokens(t, "/admin/users/details/1/tokens", map[string]string{"id": "1"}, named, admin,
+			"/admin/users/details/1", "API token created. Copy it now, it won't be shown again", Repo.PostAdminCreateAPIToken)
+	})
+
+	t.Run("Create without permission", func(t *testing.T) {
+		execTokens(t, "/admin/users/details/1/tokens", map[string]string{"id": "1"}, named, createTestUser(1, 1),
+			"/admin/dashboard", "", Repo.PostAdminCreateAPIToken)
+	})
+
+	t.Run("Create without name", func(t *testing.T) {
+		execTokens(t, "/admin/users/details/1/tokens", map[string]string{"id": "1"}, url.Values{}, admin,
+			"/admin/users/details/1", "", Repo.PostAdminCreateAPIToken)
+	})
+
+	t.Run("Create database error", func(t *testing.T) {
+		execTokens(t, "/admin/users/details/2/tokens", map[string]string{"id": "2"}, named, admin,
+			"/admin/users/details/2", "", Repo.PostAdminCreateAPIToken)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		execTokens(t, "/admin/users/details/1/tokens/1/revoke", map[string]string{"id": "1", "tokenID": "1"}, url.Values{}, admin,
+			"/admin/users/details/1", "API token revoked", Repo.PostAdminRevokeAPIToken)
+	})
+
+	t.Run("Revoke not found", func(t *testing.T) {
+		execTokens(t, "/admin/users/details/1/tokens/2/revoke", map[string]string{"id": "1", "tokenID": "2"}, url.Values{}, admin,
+			"/admin/users/details/1", "", Repo.PostAdminRevokeAPIToken)
+	})
+
+	t.Run("Revoke invalid id", func(t *testing.T) {
+		execTokens(t, "/admin/users/details/1/tokens/a/revoke", map[string]string{"id": "1", "tokenID": "a"}, url.Values{}, admin,
+			"/admin/users/details/1", "", Repo.PostAdminRevokeAPIToken)
+	})
+}
+
+func TestRepository_AdminMailOutbox(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+	}{
+		{"All", "/admin/mail", http.StatusOK},
+		{"Failed", "/admin/mail?status=failed", http.StatusOK},
+		{"Unknown status lists all", "/admin/mail?status=unknown", http.StatusOK},
+		{"Database error", "/admin/mail?status=sent", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handleAdminHandlers(t, req, true, tt.expectedCode, createTestUser(1, 3), http.HandlerFunc(Repo.AdminMailOutbox))
+		})
+	}
+}
+
+func TestRepository_PostAdminResendMail(t *testing.T) {
+	tests := []struct {
+		name          string
+		id            string
+		expectedFlash string
+		expectedError string
+	}{
+		{"Valid", "1", "Email queued for delivery", ""},
+		{"Not found", "2", "", "Email not found"},
+		{"Invalid id", "a", "", "Invalid email id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", fmt.Sprintf("/admin/mail/%s/resend", tt.id), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminResendMail).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/mail" {
+				t.Errorf("expected redirect to /admin/mail, got %d %s", rr.Code, rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_AdminMailTemplates(t *testing.T) {
+	req, err := http.NewRequest("GET", "/admin/mail/templates", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handleAdminHandlers(t, req, true, http.StatusOK, createTestUser(1, 3), http.HandlerFunc(Repo.AdminMailTemplates))
+}
+
+func TestRepository_AdminPreviewMailTemplate(t *testing.T) {
+	tests := []struct {
+		name                string
+		template            string
+		query               string
+		expectedCode        int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"HTML", "booking-confirmation", "", http.StatusOK, "text/html; charset=utf-8", "<title>Your Reservation is Confirmed! 🎉</title>"},
+		{"Plain text", "owner-booking", "?format=text", http.StatusOK, "text/plain; charset=utf-8", "Subject: Your room General's Quarters has been booked! 🎉"},
+		{"Unknown template", "missing", "", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/mail/templates/"+tt.template+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("name", tt.template)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.AdminPreviewMailTemplate).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedContentType != "" && rr.Header().Get("Content-Type") != tt.expectedContentType {
+				t.Errorf("unexpected content type %q", rr.Header().Get("Content-Type"))
+			}
+
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q:\n%s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRepository_AdminRooms(t *testing.T) {
+	req, err := http.NewRequest("GET", "/admin/rooms", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handleAdminHandlers(t, req, true, http.StatusOK, createTestUser(1, 3), http.HandlerFunc(Repo.AdminRooms))
+}
+
+func TestRepository_AdminRoomBlocks(t *testing.T) {
+	tests := []struct {
+		name             string
+		id               string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"Valid", "1", http.StatusOK, ""},
+		{"Invalid id", "a", http.StatusSeeOther, "/admin/rooms"},
+		{"Room not found", "3", http.StatusSeeOther, "/admin/rooms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", fmt.Sprintf("/admin/rooms/%s/blocks", tt.id), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.AdminRoomBlocks).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if rr.Header().Get("Location") != tt.expectedLocation {
+				t.Errorf("expected location %q, got %q", tt.expectedLocation, rr.Header().Get("Location"))
+			}
+
+			if tt.expectedCode == http.StatusOK && !strings.Contains(rr.Body.String(), "Painting") {
+				t.Error("expected the existing block to be listed")
+			}
+		})
+	}
+}
+
+func TestRepository_PostAdminRoomBlock(t *testing.T) {
+	tests := []struct {
+		name             string
+		id               string
+		form             url.Values
+		expectedCode     int
+		expectedLocation string
+		expectedBody     string
+	}{
+		{
+			"Valid",
+			"1",
+			url.Values{"start_date": {"2050-02-01"}, "end_date": {"2050-02-05"}, "reason": {"Repainting"}},
+			http.StatusSeeOther,
+			"/admin/rooms/1/blocks",
+			"",
+		},
+		{
+			"Missing reason",
+			"1",
+			url.Values{"start_date": {"2050-02-01"}, "end_date": {"2050-02-05"}},
+			http.StatusOK,
+			"",
+			"This field cannot be blank",
+		},
+		{
+			"Invalid date",
+			"1",
+			url.Values{"start_date": {"02-01-2050"}, "end_date": {"2050-02-05"}, "reason": {"Repainting"}},
+			http.StatusOK,
+			"",
+			"Invalid date",
+		},
+		{
+			"End before start",
+			"1",
+			url.Values{"start_date": {"2050-02-05"}, "end_date": {"2050-02-05"}, "reason": {"Repainting"}},
+			http.StatusOK,
+			"",
+			"The end date must be after the start date",
+		},
+		{
+			"Conflicts with a reservation",
+			"2",
+			url.Values{"start_date": {"2050-02-01"}, "end_date": {"2050-02-05"}, "reason": {"Repainting"}},
+			http.StatusOK,
+			"",
+			"reservation 1 by John Doe",
+		},
+		{
+			"Room not found",
+			"3",
+			url.Values{"start_date": {"2050-02-01"}, "end_date": {"2050-02-05"}, "reason": {"Repainting"}},
+			http.StatusSeeOther,
+			"/admin/rooms",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", fmt.Sprintf("/admin/rooms/%s/blocks", tt.id), strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminRoomBlock).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if rr.Header().Get("Location") != tt.expectedLocation {
+				t.Errorf("expected location %q, got %q", tt.expectedLocation, rr.Header().Get("Location"))
+			}
+
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q", tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestRepository_PostAdminDeleteRoomBlock(t *testing.T) {
+	tests := []struct {
+		name          string
+		blockID       string
+		expectedFlash string
+		expectedError string
+	}{
+		{"Valid", "1", "Block removed", ""},
+		{"Not found", "2", "", "Block not found"},
+		{"Invalid id", "a", "", "Invalid block id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", fmt.Sprintf("/admin/rooms/1/blocks/%s/delete", tt.blockID), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+			rctx.URLParams.Add("blockID", tt.blockID)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminDeleteRoomBlock).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/rooms/1/blocks" {
+				t.Errorf("expected redirect to /admin/rooms/1/blocks, got %d %s", rr.Code, rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_AdminRoomDetails(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		id           string
+		handler      http.HandlerFunc
+		expectedCode int
+	}{
+		{"New room", "/admin/rooms/new", "", Repo.AdminCreateRoom, http.StatusOK},
+		{"Edit room", "/admin/rooms/1", "1", Repo.AdminRoomDetails, http.StatusOK},
+		{"Room not found", "/admin/rooms/3", "3", Repo.AdminRoomDetails, http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRepository_PostAdminRoom(t *testing.T) {
+	valid := url.Values{
+		"room_name":        {"Garden Suite"},
+		"room_url":         {"garden-suite"},
+		"room_description": {"Ground floor"},
+		"capacity":         {"4"},
+		"base_rate":        {"140"},
+		"weekend_rate":     {"165.50"},
+		"active":           {"1"},
+	}
+
+	with := func(key, value string) url.Values {
+		form := url.Values{}
+		for k, v := range valid {
+			form[k] = v
+		}
+		form.Set(key, value)
+		return form
+	}
+
+	tests := []struct {
+		name             string
+		id               string
+		form             url.Values
+		handler          http.HandlerFunc
+		expectedCode     int
+		expectedLocation string
+		expectedBody     string
+	}{
+		{"Create", "", valid, Repo.PostAdminCreateRoom, http.StatusSeeOther, "/admin/rooms", ""},
+		{"Create invalid slug", "", with("room_url", "Garden Suite"), Repo.PostAdminCreateRoom, http.StatusOK, "", "Use only lowercase letters, numbers and dashes"},
+		{"Create capacity too large", "", with("capacity", "21"), Repo.PostAdminCreateRoom, http.StatusOK, "", "between 1 and 20"},
+		{"Create slug taken", "", with("room_url", "taken-room"), Repo.PostAdminCreateRoom, http.StatusOK, "", "Another room already uses this URL"},
+		{"Create missing rate", "", with("base_rate", ""), Repo.PostAdminCreateRoom, http.StatusOK, "", "This field cannot be blank"},
+		{"Create invalid rate", "", with("weekend_rate", "12.345"), Repo.PostAdminCreateRoom, http.StatusOK, "", "Enter an amount above zero"},
+		{"Update", "1", valid, Repo.PostAdminRoomDetails, http.StatusSeeOther, "/admin/rooms/1", ""},
+		{"Update missing name", "1", with("room_name", ""), Repo.PostAdminRoomDetails, http.StatusOK, "", "This field cannot be blank"},
+		{"Update slug taken", "1", with("room_url", "taken-room"), Repo.PostAdminRoomDetails, http.StatusOK, "", "Another room already uses this URL"},
+		{"Update room not found", "3", valid, Repo.PostAdminRoomDetails, http.StatusSeeOther, "/admin/rooms", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/admin/rooms", strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if rr.Header().Get("Location") != tt.expectedLocation {
+				t.Errorf("expected location %q, got %q", tt.expectedLocation, rr.Header().Get("Location"))
+			}
+
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q", tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestRepository_CreateRoomThenBook(t *testing.T) {
+	form := url.Values{
+		"room_name":    {"Orchard Room"},
+		"room_url":     {"orchard-room"},
+		"capacity":     {"3"},
+		"base_rate":    {"90"},
+		"weekend_rate": {"110"},
+		"active":       {"1"},
+	}
+
+	req, err := http.NewRequest("POST", "/admin/rooms/new", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAdminCreateRoom).ServeHTTP(rr, req)
+	app.Session.Destroy(ctx)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the room to be created, got status %d", rr.Code)
+	}
+
+	room, err := Repo.DB.GetRoomByUrl("orchard-room")
+	if err != nil {
+		t.Fatalf("created room not found: %v", err)
+	}
+
+	// Monday to Thursday, three weekday nights at the base rate
+	res := models.Reservation{
+		RoomID:    room.ID,
+		StartDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 6, 0, 0, 0, 0, time.UTC),
+		Adults:    2,
+	}
+
+	req, _ = http.NewRequest("GET", "/book", nil)
+	req = req.WithContext(getCtx(req))
+	app.Session.Put(req.Context(), "reservation", res)
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.Booking).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the booking form, got status %d", rr.Code)
+	}
+
+	booking, _ := app.Session.Get(req.Context(), "reservation").(models.Reservation)
+	app.Session.Destroy(req.Context())
+
+	if booking.Total != 27000 {
+		t.Errorf("expected the stay priced at the room's rates, got %d", booking.Total)
+	}
+
+	guest := url.Values{
+		"first_name": {"John"},
+		"last_name":  {"Doe"},
+		"email":      {"john@example.com"},
+		"phone":      {"55555555"},
+		"adults":     {"2"},
+		"children":   {"1"},
+	}
+
+	req, _ = http.NewRequest("POST", "/book", strings.NewReader(guest.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(getCtx(req))
+	app.Session.Put(req.Context(), "reservation", booking)
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostBooking).ServeHTTP(rr, req)
+	app.Session.Destroy(req.Context())
+
+	if location := rr.Header().Get("Location"); location != "/book/summary" {
+		t.Errorf("expected the new room to be booked, got redirect to %q", location)
+	}
+}
+
+func TestRepository_PostAdminDeleteRoom(t *testing.T) {
+	tests := []struct {
+		name             string
+		id               string
+		expectedLocation string
+		expectedFlash    string
+		expectedError    string
+	}{
+		{"Valid", "1", "/admin/rooms", "Room deleted", ""},
+		{"Has reservations", "2", "/admin/rooms/2", "", "This room has reservations and can't be deleted, deactivate it instead"},
+		{"Room not found", "3", "/admin/rooms", "", "Room not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", fmt.Sprintf("/admin/rooms/%s/delete", tt.id), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminDeleteRoom).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != tt.expectedLocation {
+				t.Errorf("expected redirect to %s, got %d %s", tt.expectedLocation, rr.Code, rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mlvieira/bookings/internal/forms"
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/render"
+)
+
+// AdminCalendarImports shows the external calendars of a room and the form to add one
+func (m *Repository) AdminCalendarImports(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	m.renderCalendarImports(w, r, room, forms.New(nil))
+}
+
+// renderCalendarImports renders the external calendars page with the form state
+func (m *Repository) renderCalendarImports(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form) {
+	imports, err := m.DB.GetCalendarImports(room.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["room"] = room
+	data["imports"] = imports
+
+	intMap := make(map[string]int)
+	intMap["max_file_size_mb"] = int(m.App.CalendarSync.MaxFeedSize() >> 20)
+
+	render.Template(w, r, "admin-calendar-imports.page.html", &models.TemplateData{
+		Form:   form,
+		Data:   data,
+		IntMap: intMap,
+	})
+}
+
+// PostAdminCalendarImport adds an external calendar to a room. Calendars with a URL
+// are synced straight away and then on every poll.
+func (m *Repository) PostAdminCalendarImport(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	form.MinLength("name", 3)
+
+	imp := models.CalendarImport{
+		RoomID: room.ID,
+		Name:   strings.TrimSpace(r.Form.Get("name")),
+		URL:    strings.TrimSpace(r.Form.Get("url")),
+	}
+
+	if len(imp.Name) > 100 {
+		form.Errors.Add("name", "The name must be at most 100 characters")
+	}
+
+	if imp.URL != "" && !validFeedURL(imp.URL) {
+		form.Errors.Add("url", "Enter an http, https or webcal URL")
+	} else if len(imp.URL) > 500 {
+		form.Errors.Add("url", "The URL must be at most 500 characters")
+	}
+
+	if !form.Valid() {
+		m.renderCalendarImports(w, r, room, form)
+		return
+	}
+
+	imp.ID, err = m.DB.CreateCalendarImport(imp)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if imp.URL == "" {
+		m.App.Session.Put(r.Context(), "flash", "Calendar added, upload its .ics file to import it")
+		http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/calendars", room.ID), http.StatusSeeOther)
+		return
+	}
+
+	result, err := m.App.CalendarSync.Sync(r.Context(), imp)
+	m.flashSyncResult(r, "Calendar added", result, err)
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/calendars", room.ID), http.StatusSeeOther)
+}
+
+// PostAdminSyncCalendarImport fetches an external calendar without waiting for the next poll
+func (m *Repository) PostAdminSyncCalendarImport(w http.ResponseWriter, r *http.Request) {
+	m.calendarImportAction(w, r, func(imp models.CalendarImport) {
+		if imp.URL == "" {
+			m.App.Session.Put(r.Context(), "error", "This calendar has no URL, upload its .ics file instead")
+			return
+		}
+
+		result, err := m.App.CalendarSync.Sync(r.Context(), imp)
+		m.flashSyncResult(r, "Calendar synced", result, err)
+	})
+}
+
+// CalendarUploadLimit is the largest request body PostAdminUploadCalendarImport accepts.
+// The routes enforce it before the form is read.
+func (m *Repository) CalendarUploadLimit() int64 {
+	return m.App.CalendarSync.MaxFeedSize() + uploadFormOverhead
+}
+
+// PostAdminUploadCalendarImport imports an uploaded .ics file into an external calendar,
+// replacing the blocks of its previous sync
+func (m *Repository) PostAdminUploadCalendarImport(w http.ResponseWriter, r *http.Request) {
+	m.calendarImportAction(w, r, func(imp models.CalendarImport) {
+		f, fh, err := r.FormFile("calendar")
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Choose an .ics file to upload")
+			return
+		}
+		defer f.Close()
+
+		if fh.Size > m.App.CalendarSync.MaxFeedSize() {
+			m.App.Session.Put(r.Context(), "error", "Calendar file is too large")
+			return
+		}
+
+		result, err := m.App.CalendarSync.Import(imp, f)
+		m.flashSyncResult(r, "Calendar imported", result, err)
+	})
+}
+
+// PostAdminDeleteCalendarImport removes an external calendar and the blocks imported from it
+func (m *Repository) PostAdminDeleteCalendarImport(w http.ResponseWriter, r *http.Request) {
+	m.calendarImportAction(w, r, func(imp models.CalendarImport) {
+		err := m.DB.DeleteCalendarImport(imp.RoomID, imp.ID)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			m.App.Session.Put(r.Context(), "error", "Error removing calendar")
+			return
+		}
+
+		m.App.Session.Put(r.Context(), "flash", "Calendar removed along with its blocks")
+	})
+}
+
+// calendarImportAction runs fn with the external calendar from the URL and redirects
+// back to the room's calendars
+func (m *Repository) calendarImportAction(w http.ResponseWriter, r *http.Request, fn func(imp models.CalendarImport)) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	calendarsURL := fmt.Sprintf("/admin/rooms/%d/calendars", room.ID)
+
+	importID, err := strconv.Atoi(chi.URLParam(r, "importID"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid calendar id")
+		http.Redirect(w, r, calendarsURL, http.StatusSeeOther)
+		return
+	}
+
+	imp, err := m.DB.GetCalendarImport(room.ID, importID)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Calendar not found")
+		http.Redirect(w, r, calendarsURL, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	fn(imp)
+
+	http.Redirect(w, r, calendarsURL, http.StatusSeeOther)
+}
+
+// flashSyncResult reports the outcome of a sync, warning about imported bookings that
+// overlap reservations or blocks of this site
+func (m *Repository) flashSyncResult(r *http.Request, success string, result models.CalendarSyncResult, err error) {
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Calendar could not be synced: %s", err))
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s: %d added, %d updated, %d removed",
+		success, result.Added, result.Updated, result.Removed))
+
+	if result.Conflicts > 0 {
+		m.App.Session.Put(r.Context(), "warning", fmt.Sprintf("%d imported booking(s) overlap reservations or blocks of this room", result.Conflicts))
+	}
+}
+
+// validFeedURL reports whether s is an absolute http, https or webcal URL
+func validFeedURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "http", "https", "webcal":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const externalCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:stay-1@channel.example.com\r\n" +
+	"DTSTART;VALUE=DATE:20501217\r\n" +
+	"DTEND;VALUE=DATE:20501220\r\n" +
+	"SUMMARY:Reserved\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestRepository_AdminCalendarImports(t *testing.T) {
+	req, err := http.NewRequest("GET", "/admin/rooms/1/calendars", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminCalendarImports).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	for _, expected := range []string{"https://channel.example.com/calendar.ics", "calendar feed returned 404 Not Found", "Uploaded files"} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected the page to contain %q", expected)
+		}
+	}
+}
+
+func TestRepository_PostAdminCalendarImport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, externalCalendar)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name          string
+		form          url.Values
+		expectedCode  int
+		expectedFlash string
+	}{
+		{"With URL", url.Values{"name": {"Channel"}, "url": {ts.URL + "/calendar.ics"}}, http.StatusSeeOther, "Calendar added: 1 added, 0 updated, 0 removed"},
+		{"Uploads only", url.Values{"name": {"Offline"}}, http.StatusSeeOther, "Calendar added, upload its .ics file to import it"},
+		{"Short name", url.Values{"name": {"ab"}}, http.StatusOK, ""},
+		{"Invalid URL", url.Values{"name": {"Channel"}, "url": {"ftp://channel.example.com/calendar.ics"}}, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/admin/rooms/1/calendars", strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminCalendarImport).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedCode == http.StatusSeeOther && rr.Header().Get("Location") != "/admin/rooms/1/calendars" {
+				t.Errorf("expected redirect to /admin/rooms/1/calendars, got %s", rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_CalendarImportActions(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"sync":   Repo.PostAdminSyncCalendarImport,
+		"upload": Repo.PostAdminUploadCalendarImport,
+		"delete": Repo.PostAdminDeleteCalendarImport,
+	}
+
+	tests := []struct {
+		name          string
+		action        string
+		importID      string
+		file          string
+		expectedFlash string
+		expectedError string
+	}{
+		{"Upload", "upload", "2", externalCalendar, "Calendar imported: 1 added, 0 updated, 0 removed", ""},
+		{"Upload not a calendar", "upload", "2", "not a calendar", "", "Calendar could not be synced: not an iCalendar file"},
+		{"Upload without file", "upload", "2", "", "", "Choose an .ics file to upload"},
+		{"Sync without URL", "sync", "2", "", "", "This calendar has no URL, upload its .ics file instead"},
+		{"Sync not found", "sync", "3", "", "", "Calendar not found"},
+		{"Delete", "delete", "1", "", "Calendar removed along with its blocks", ""},
+		{"Delete invalid id", "delete", "a", "", "", "Invalid calendar id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			if tt.file != "" {
+				fw, err := mw.CreateFormFile("calendar", "calendar.ics")
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.WriteString(fw, tt.file)
+			}
+			mw.Close()
+
+			req, err := http.NewRequest("POST", fmt.Sprintf("/admin/rooms/1/calendars/%s/%s", tt.importID, tt.action), &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+			rctx.URLParams.Add("importID", tt.importID)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			handlers[tt.action].ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/rooms/1/calendars" {
+				t.Errorf("expected redirect to /admin/rooms/1/calendars, got %d %s", rr.Code, rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/photos"
+	"github.com/mlvieira/bookings/internal/render"
+)
+
+// maxPhotosPerUpload caps how many files a single upload may contain
+const maxPhotosPerUpload = 20
+
+// uploadFormOverhead is the room left in an upload for the multipart headers and the
+// other form fields
+const uploadFormOverhead = 1 << 20
+
+// PhotoUploadLimit is the largest request body PostAdminRoomPhotos accepts. The routes
+// enforce it before the form is read.
+func (m *Repository) PhotoUploadLimit() int64 {
+	return maxPhotosPerUpload*m.App.Photos.MaxFileSize() + uploadFormOverhead
+}
+
+// AdminRoomPhotos shows the photo gallery of a room with the upload form
+func (m *Repository) AdminRoomPhotos(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	roomPhotos, err := m.DB.GetRoomPhotos(room.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["room"] = room
+	data["photos"] = roomPhotos
+
+	intMap := make(map[string]int)
+	intMap["max_file_size_mb"] = int(m.App.Photos.MaxFileSize() >> 20)
+	intMap["max_photos"] = maxPhotosPerUpload
+	intMap["last_photo"] = len(roomPhotos) - 1
+
+	render.Template(w, r, "admin-room-photos.page.html", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+	})
+}
+
+// PostAdminRoomPhotos stores the uploaded photos of a room. Files that fail
+// validation are skipped and reported while the others are kept.
+func (m *Repository) PostAdminRoomPhotos(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	photosURL := fmt.Sprintf("/admin/rooms/%d/photos", room.ID)
+
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Choose one or more photos to upload")
+		http.Redirect(w, r, photosURL, http.StatusSeeOther)
+		return
+	}
+
+	files := r.MultipartForm.File["photos"]
+	if len(files) == 0 {
+		m.App.Session.Put(r.Context(), "error", "Choose one or more photos to upload")
+		http.Redirect(w, r, photosURL, http.StatusSeeOther)
+		return
+	}
+
+	if len(files) > maxPhotosPerUpload {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Upload at most %d photos at a time", maxPhotosPerUpload))
+		http.Redirect(w, r, photosURL, http.StatusSeeOther)
+		return
+	}
+
+	var uploaded int
+	var problems []string
+
+	for _, fh := range files {
+		if fh.Size > m.App.Photos.MaxFileSize() {
+			problems = append(problems, fmt.Sprintf("%s: %s", fh.Filename, photos.ErrTooLarge))
+			continue
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		name, err := m.App.Photos.Save(fmt.Sprintf("room-%d", room.ID), f)
+		f.Close()
+		if errors.Is(err, photos.ErrTooLarge) || errors.Is(err, photos.ErrUnsupportedType) {
+			problems = append(problems, fmt.Sprintf("%s: %s", fh.Filename, err))
+			continue
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		_, err = m.DB.InsertRoomPhoto(models.RoomPhoto{RoomID: room.ID, FileName: name})
+		if err != nil {
+			m.App.Photos.Remove(name)
+			helpers.ServerError(w, err)
+			return
+		}
+
+		uploaded++
+	}
+
+	if uploaded > 0 {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%d photo(s) uploaded", uploaded))
+	}
+	if len(problems) > 0 {
+		m.App.Session.Put(r.Context(), "error", "Some photos were not uploaded. "+strings.Join(problems, "; "))
+	}
+
+	http.Redirect(w, r, photosURL, http.StatusSeeOther)
+}
+
+// roomPhotoAction runs fn with the room and photo ids from the URL and redirects back
+// to the gallery, flashing success on completion
+func (m *Repository) roomPhotoAction(w http.ResponseWriter, r *http.Request, success string, fn func(roomID, photoID int) error) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	photosURL := fmt.Sprintf("/admin/rooms/%d/photos", room.ID)
+
+	photoID, err := strconv.Atoi(chi.URLParam(r, "photoID"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid photo id")
+		http.Redirect(w, r, photosURL, http.StatusSeeOther)
+		return
+	}
+
+	err = fn(room.ID, photoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Photo not found")
+		http.Redirect(w, r, photosURL, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", success)
+	http.Redirect(w, r, photosURL, http.StatusSeeOther)
+}
+
+// PostAdminRoomPhotoCover makes a photo the cover of its room
+func (m *Repository) PostAdminRoomPhotoCover(w http.ResponseWriter, r *http.Request) {
+	m.roomPhotoAction(w, r, "Cover photo updated", m.DB.SetRoomCoverPhoto)
+}
+
+// PostAdminMoveRoomPhoto moves a photo one position up or down in the gallery
+func (m *Repository) PostAdminMoveRoomPhoto(w http.ResponseWriter, r *http.Request) {
+	offset := 1
+	if r.FormValue("direction") == "up" {
+		offset = -1
+	}
+
+	m.roomPhotoAction(w, r, "Photo moved", func(roomID, photoID int) error {
+		return m.DB.MoveRoomPhoto(roomID, photoID, offset)
+	})
+}
+
+// PostAdminDeleteRoomPhoto removes a photo and its files
+func (m *Repository) PostAdminDeleteRoomPhoto(w http.ResponseWriter, r *http.Request) {
+	m.roomPhotoAction(w, r, "Photo deleted", func(roomID, photoID int) error {
+		photo, err := m.DB.DeleteRoomPhoto(roomID, photoID)
+		if err != nil {
+			return err
+		}
+
+		m.removePhotoFiles(photo)
+
+		return nil
+	})
+}
+
+// removePhotoFiles deletes the stored files of photos that are gone from the
+// database. Failures are only logged since the rows are already removed.
+func (m *Repository) removePhotoFiles(roomPhotos ...models.RoomPhoto) {
+	for _, photo := range roomPhotos {
+		if err := m.App.Photos.Remove(photo.FileName); err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// multipartPhotos builds an upload request body with the given files
+func multipartPhotos(t *testing.T, files map[string][]byte) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for name, data := range files {
+		fw, err := mw.CreateFormFile("photos", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &body, mw.FormDataContentType()
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 800, 600))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRepository_AdminRoomPhotos(t *testing.T) {
+	req, err := http.NewRequest("GET", "/admin/rooms/2/photos", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "2")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminRoomPhotos).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if !strings.Contains(rr.Body.String(), "/photos/room-2-bathroom-thumb.jpg") {
+		t.Error("expected the room photos to be listed")
+	}
+}
+
+func TestRepository_PostAdminRoomPhotos(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string][]byte
+		expectedFlash string
+		expectedError string
+	}{
+		{"Valid", map[string][]byte{"room.png": testPNG(t)}, "1 photo(s) uploaded", ""},
+		{
+			"Some invalid",
+			map[string][]byte{"room.png": testPNG(t), "notes.txt": []byte("not a photo")},
+			"1 photo(s) uploaded",
+			"Some photos were not uploaded. notes.txt: photo must be a JPEG, PNG or GIF image",
+		},
+		{"No files", nil, "", "Choose one or more photos to upload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := multipartPhotos(t, tt.files)
+
+			req, err := http.NewRequest("POST", "/admin/rooms/1/photos", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminRoomPhotos).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/rooms/1/photos" {
+				t.Errorf("expected redirect to /admin/rooms/1/photos, got %d %s", rr.Code, rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_RoomPhotoActions(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"cover":  Repo.PostAdminRoomPhotoCover,
+		"move":   Repo.PostAdminMoveRoomPhoto,
+		"delete": Repo.PostAdminDeleteRoomPhoto,
+	}
+
+	tests := []struct {
+		name          string
+		action        string
+		photoID       string
+		expectedFlash string
+		expectedError string
+	}{
+		{"Cover", "cover", "1", "Cover photo updated", ""},
+		{"Cover not found", "cover", "3", "", "Photo not found"},
+		{"Move", "move", "2", "Photo moved", ""},
+		{"Move invalid id", "move", "a", "", "Invalid photo id"},
+		{"Delete", "delete", "2", "Photo deleted", ""},
+		{"Delete not found", "delete", "3", "", "Photo not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", fmt.Sprintf("/admin/rooms/2/photos/%s/%s", tt.photoID, tt.action), strings.NewReader("direction=up"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "2")
+			rctx.URLParams.Add("photoID", tt.photoID)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			handlers[tt.action].ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/rooms/2/photos" {
+				t.Errorf("expected redirect to /admin/rooms/2/photos, got %d %s", rr.Code, rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_RoomsPageGallery(t *testing.T) {
+	ts := httptest.NewTLSServer(getRoutes())
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/rooms/majors-suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+
+	if !strings.Contains(body.String(), "/photos/room-2-cover-display.jpg") {
+		t.Error("expected the cover photo in the room gallery")
+	}
+}
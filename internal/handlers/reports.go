@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/render"
+)
+
+// reportMaxDays bounds the range of a report
+const reportMaxDays = 3 * 366
+
+// reportFilter is the date range and room a report covers. The report counts the
+// nights from Start up to, but not including, End.
+type reportFilter struct {
+	Start  time.Time
+	End    time.Time
+	RoomID int
+}
+
+// defaultReportFilter covers every room over the last twelve months, this one included
+func defaultReportFilter(now time.Time) reportFilter {
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	return reportFilter{
+		Start: thisMonth.AddDate(0, -11, 0),
+		End:   thisMonth.AddDate(0, 1, 0),
+	}
+}
+
+// parseReportFilter reads the start, end (YYYY-MM-DD) and room_id query parameters,
+// falling back to the default filter for those left out
+func parseReportFilter(query url.Values, now time.Time) (reportFilter, error) {
+	filter := defaultReportFilter(now)
+
+	var err error
+
+	if s := query.Get("start"); s != "" {
+		filter.Start, err = time.Parse(apiDateLayout, s)
+		if err != nil {
+			return filter, errors.New("Invalid start date, use YYYY-MM-DD")
+		}
+	}
+
+	if s := query.Get("end"); s != "" {
+		filter.End, err = time.Parse(apiDateLayout, s)
+		if err != nil {
+			return filter, errors.New("Invalid end date, use YYYY-MM-DD")
+		}
+	}
+
+	if s := query.Get("room_id"); s != "" {
+		filter.RoomID, err = strconv.Atoi(s)
+		if err != nil || filter.RoomID < 1 {
+			return filter, errors.New("Invalid room id")
+		}
+	}
+
+	if !filter.End.After(filter.Start) {
+		return filter, errors.New("The end date must be after the start date")
+	}
+
+	if filter.End.After(filter.Start.AddDate(0, 0, reportMaxDays)) {
+		return filter, errors.New("Reports can cover at most three years")
+	}
+
+	return filter, nil
+}
+
+// AdminDashboard shows occupancy and revenue charts for a date range and room
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	user, ok := helpers.CurrentUser(r)
+	if !ok {
+		_ = m.App.Session.Destroy(r.Context())
+		m.App.Session.Put(r.Context(), "error", "Error getting user information from session")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	filter, err := parseReportFilter(r.URL.Query(), time.Now())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		filter = defaultReportFilter(time.Now())
+	}
+
+	report, err := m.DB.OccupancyReport(filter.Start, filter.End, filter.RoomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Room not found")
+		filter.RoomID = 0
+		report, err = m.DB.OccupancyReport(filter.Start, filter.End, 0)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.ListRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var maxRevenue int
+	for _, month := range report.Months {
+		maxRevenue = max(maxRevenue, month.Revenue)
+	}
+
+	data := make(map[string]any)
+	data["user"] = user
+	data["report"] = report
+	data["rooms"] = rooms
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = filter.Start.Format(apiDateLayout)
+	stringMap["end"] = filter.End.Format(apiDateLayout)
+
+	intMap := make(map[string]int)
+	intMap["room_id"] = filter.RoomID
+	intMap["max_month_revenue"] = maxRevenue
+
+	render.Template(w, r, "admin-dashboard.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
+	})
+}
+
+// JsonAdminReport returns the occupancy and revenue report for the start, end and
+// room_id query parameters
+func (m *Repository) JsonAdminReport(w http.ResponseWriter, r *http.Request) {
+	writeError := func(status int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": msg,
+		})
+	}
+
+	filter, err := parseReportFilter(r.URL.Query(), time.Now())
+	if err != nil {
+		writeError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := m.DB.OccupancyReport(filter.Start, filter.End, filter.RoomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(http.StatusNotFound, "Room not found")
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeError(http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
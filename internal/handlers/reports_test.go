@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+func TestParseReportFilter(t *testing.T) {
+	now := time.Date(2050, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	filter, err := parseReportFilter(url.Values{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !filter.Start.Equal(time.Date(2049, 4, 1, 0, 0, 0, 0, time.UTC)) || !filter.End.Equal(time.Date(2050, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the last twelve months by default, got %s to %s", filter.Start, filter.End)
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedError string
+	}{
+		{"Valid", "start=2050-01-01&end=2050-02-01&room_id=2", ""},
+		{"Bad start", "start=01-01-2050", "Invalid start date, use YYYY-MM-DD"},
+		{"Bad end", "end=2050-02-30", "Invalid end date, use YYYY-MM-DD"},
+		{"Bad room", "room_id=a", "Invalid room id"},
+		{"Reversed", "start=2050-02-01&end=2050-01-01", "The end date must be after the start date"},
+		{"Too long", "start=2040-01-01&end=2050-01-01", "Reports can cover at most three years"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+
+			_, err := parseReportFilter(query, now)
+			if tt.expectedError == "" && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if tt.expectedError != "" && (err == nil || err.Error() != tt.expectedError) {
+				t.Errorf("expected error %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestRepository_AdminDashboardReport(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expected      []string
+		expectedError string
+	}{
+		{"Default range", "", []string{"General&#39;s Quarters", "Major&#39;s Suite"}, ""},
+		{"One room", "?start=2050-01-01&end=2050-02-01&room_id=1", []string{"6.5%", "$250.00", "Booked 10 days ahead"}, ""},
+		{"Bad date", "?start=tomorrow", []string{"General&#39;s Quarters"}, "Invalid start date, use YYYY-MM-DD"},
+		{"Unknown room", "?room_id=3", []string{"Major&#39;s Suite"}, "Room not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/dashboard"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", createTestUser(1, 1))
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.AdminDashboard).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			for _, expected := range append(tt.expected, tt.expectedError) {
+				if !strings.Contains(rr.Body.String(), expected) {
+					t.Errorf("expected the page to contain %q", expected)
+				}
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_JsonAdminReport(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedCode  int
+		expectedError string
+	}{
+		{"Valid", "?start=2050-01-01&end=2050-03-01", http.StatusOK, ""},
+		{"One room", "?start=2050-01-01&end=2050-03-01&room_id=1", http.StatusOK, ""},
+		{"Bad date", "?start=2050-13-01", http.StatusBadRequest, "Invalid start date, use YYYY-MM-DD"},
+		{"Unknown room", "?room_id=3", http.StatusNotFound, "Room not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/reports/json"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.JsonAdminReport).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedError != "" {
+				var body map[string]string
+				if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+
+				if body["error"] != tt.expectedError {
+					t.Errorf("expected error %q, got %q", tt.expectedError, body["error"])
+				}
+				return
+			}
+
+			var report models.Report
+			if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Months) != 2 || report.Totals.NightsSold != 2 || report.Totals.Revenue != 25000 {
+				t.Errorf("unexpected report %+v", report.Totals)
+			}
+
+			if strings.Contains(tt.query, "room_id=1") && (len(report.Rooms) != 1 || report.RoomID != 1) {
+				t.Errorf("expected only room 1, got %+v", report.Rooms)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mlvieira/bookings/internal/dates"
+	"github.com/mlvieira/bookings/internal/emails"
+	"github.com/mlvieira/bookings/internal/forms"
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/lifecycle"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/repository"
+)
+
+var (
+	errRescheduleRoom     = errors.New("Room not found")
+	errRescheduleInactive = errors.New("This room is out of service")
+	errRescheduleDates    = errors.New("The departure must be after the arrival")
+	errReschedulePast     = errors.New("The new arrival can't be in the past")
+	errReschedulePrice    = errors.New("Could not price the new stay")
+)
+
+// rescheduleReservation moves res to the room and dates and emails the guest what
+// changed. The guest keeps the total they booked unless reprice is set, which prices
+// the new stay at the current rates. It returns the moved reservation.
+func (m *Repository) rescheduleReservation(res models.Reservation, roomID int, start, end time.Time, reprice bool) (models.Reservation, error) {
+	if !lifecycle.CanReschedule(res.Status, res.StartDate, time.Now()) {
+		return res, repository.ErrNotReschedulable
+	}
+
+	if !end.After(start) {
+		return res, errRescheduleDates
+	}
+
+	// compared by calendar day as the dates in the form have no time zone
+	if dates.DaysBetween(time.Now(), start) < 0 {
+		return res, errReschedulePast
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if err != nil {
+		return res, errRescheduleRoom
+	}
+
+	if room.Active == 0 {
+		return res, errRescheduleInactive
+	}
+
+	if res.Guests() > room.Capacity {
+		return res, &repository.OccupancyError{
+			RoomID:   room.ID,
+			Capacity: room.Capacity,
+			Guests:   res.Guests(),
+		}
+	}
+
+	moved := res
+	moved.RoomID = room.ID
+	moved.Room = room
+	moved.StartDate = start
+	moved.EndDate = end
+
+	if reprice {
+		quote, err := m.DB.QuoteStay(roomID, start, end)
+		if err != nil {
+			return res, errReschedulePrice
+		}
+
+		moved.Total = quote.Total
+	}
+
+	if err := m.DB.RescheduleReservation(moved); err != nil {
+		return res, err
+	}
+
+	moved.UpdatedAt = time.Now()
+
+	data := m.reservationEmailData(moved)
+	data.Previous = res
+
+	m.queueEmail(moved.Email, emails.BookingChanged, data)
+
+	return moved, nil
+}
+
+// rescheduleErrorMessage explains why a reservation couldn't be moved. It returns
+// false for unexpected errors.
+func rescheduleErrorMessage(err error) (string, bool) {
+	var unavailable *repository.RoomUnavailableError
+	var occupancyErr *repository.OccupancyError
+
+	switch {
+	case errors.As(err, &unavailable):
+		return "The room is not available for these dates", true
+	case errors.As(err, &occupancyErr):
+		return fmt.Sprintf("The room sleeps at most %d guests", occupancyErr.Capacity), true
+	case errors.Is(err, repository.ErrNotReschedulable):
+		return "This reservation can no longer be changed", true
+	case errors.Is(err, errRescheduleRoom), errors.Is(err, errRescheduleInactive),
+		errors.Is(err, errRescheduleDates), errors.Is(err, errReschedulePast),
+		errors.Is(err, errReschedulePrice):
+		return err.Error(), true
+	}
+
+	return "", false
+}
+
+// PostAdminRescheduleReservation moves a reservation to the room and dates in the form,
+// pricing the new stay again when the admin asks to, and emails the guest what changed
+func (m *Repository) PostAdminRescheduleReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid reservation id")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	res, err := m.DB.GetReservationById(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Reservation not found")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	detailsURL := fmt.Sprintf("/admin/reservations/details/%d", id)
+
+	fail := func(msg string) {
+		m.App.Session.Put(r.Context(), "error", msg)
+		http.Redirect(w, r, detailsURL, http.StatusSeeOther)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		fail("Invalid form")
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "start_date", "end_date")
+	if !form.Valid() {
+		fail("Choose a room and the new dates")
+		return
+	}
+
+	roomID, err := strconv.Atoi(form.Get("room_id"))
+	if err != nil {
+		fail("Invalid room")
+		return
+	}
+
+	start, err := time.Parse(apiDateLayout, form.Get("start_date"))
+	if err != nil {
+		fail("Invalid arrival date")
+		return
+	}
+
+	end, err := time.Parse(apiDateLayout, form.Get("end_date"))
+	if err != nil {
+		fail("Invalid departure date")
+		return
+	}
+
+	if roomID == res.RoomID && start.Equal(res.StartDate) && end.Equal(res.EndDate) {
+		m.App.Session.Put(r.Context(), "warning", "The reservation already has this room and these dates")
+		http.Redirect(w, r, detailsURL, http.StatusSeeOther)
+		return
+	}
+
+	_, err = m.rescheduleReservation(res, roomID, start, end, form.Has("reprice"))
+	if err != nil {
+		msg, ok := rescheduleErrorMessage(err)
+		if !ok {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		fail(msg)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation changed, the guest has been emailed the new details")
+	http.Redirect(w, r, detailsURL, http.StatusSeeOther)
+}
+
+// calendarMove is a reservation dragged or resized on the admin calendar. RoomID is
+// the room it was dropped on, or 0 to keep its room. The booked total is kept unless
+// Reprice is set.
+type calendarMove struct {
+	ID      int    `json:"id"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	RoomID  int    `json:"roomId"`
+	Reprice bool   `json:"reprice"`
+}
+
+// PostJsonAdminMoveCalendarReservation moves a reservation dropped on other dates or
+// another room of the admin calendar. It responds with the updated event, or with a
+// 409 Conflict when the room is taken so the calendar can put the event back.
+func (m *Repository) PostJsonAdminMoveCalendarReservation(w http.ResponseWriter, r *http.Request) {
+	writeError := func(status int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": msg,
+		})
+	}
+
+	var move calendarMove
+	if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+		writeError(http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	start, err := time.Parse(apiDateLayout, move.Start)
+	if err != nil {
+		writeError(http.StatusBadRequest, "Invalid start date, use YYYY-MM-DD")
+		return
+	}
+
+	end, err := time.Parse(apiDateLayout, move.End)
+	if err != nil {
+		writeError(http.StatusBadRequest, "Invalid end date, use YYYY-MM-DD")
+		return
+	}
+
+	res, err := m.DB.GetReservationById(move.ID)
+	if err != nil {
+		writeError(http.StatusNotFound, "Reservation not found")
+		return
+	}
+
+	if move.RoomID == 0 {
+		move.RoomID = res.RoomID
+	}
+
+	moved, err := m.rescheduleReservation(res, move.RoomID, start, end, move.Reprice)
+	if err != nil {
+		msg, ok := rescheduleErrorMessage(err)
+		if !ok {
+			m.App.ErrorLog.Println(err)
+			writeError(http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		var unavailable *repository.RoomUnavailableError
+		if errors.As(err, &unavailable) || errors.Is(err, repository.ErrNotReschedulable) {
+			writeError(http.StatusConflict, msg)
+			return
+		}
+
+		writeError(http.StatusUnprocessableEntity, msg)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservationCalendarEvent(moved, true))
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/lifecycle"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/render"
+)
+
+// parseReservationFilter reads the start, end (YYYY-MM-DD), room_id, status and q
+// query parameters
+func parseReservationFilter(query url.Values) (models.ReservationFilter, error) {
+	var filter models.ReservationFilter
+	var err error
+
+	if s := query.Get("start"); s != "" {
+		filter.Start, err = time.Parse(apiDateLayout, s)
+		if err != nil {
+			return filter, errors.New("Invalid start date")
+		}
+	}
+
+	if s := query.Get("end"); s != "" {
+		filter.End, err = time.Parse(apiDateLayout, s)
+		if err != nil {
+			return filter, errors.New("Invalid end date")
+		}
+	}
+
+	if !filter.Start.IsZero() && !filter.End.IsZero() && !filter.End.After(filter.Start) {
+		return filter, errors.New("The end date must be after the start date")
+	}
+
+	if s := query.Get("room_id"); s != "" {
+		filter.RoomID, err = strconv.Atoi(s)
+		if err != nil || filter.RoomID < 1 {
+			return filter, errors.New("Invalid room")
+		}
+	}
+
+	filter.Status = query.Get("status")
+	if filter.Status != "" && !lifecycle.Status(filter.Status).Valid() {
+		return filter, errors.New("Invalid status")
+	}
+
+	filter.Search = strings.TrimSpace(query.Get("q"))
+
+	return filter, nil
+}
+
+// parseReservationQuery reads a reservation filter along with the page, size, sort and
+// dir query parameters. Lists are sorted by arrival unless asked otherwise.
+func parseReservationQuery(query url.Values, desc bool) (models.ReservationQuery, error) {
+	q := models.ReservationQuery{
+		Page:     1,
+		PageSize: models.DefaultPageSize,
+		Sort:     "start_date",
+		Desc:     desc,
+	}
+
+	var err error
+
+	q.ReservationFilter, err = parseReservationFilter(query)
+	if err != nil {
+		return q, err
+	}
+
+	if s := query.Get("page"); s != "" {
+		q.Page, err = strconv.Atoi(s)
+		if err != nil || q.Page < 1 {
+			return q, errors.New("Invalid page")
+		}
+	}
+
+	if s := query.Get("size"); s != "" {
+		q.PageSize, err = strconv.Atoi(s)
+		if err != nil || !slices.Contains(models.PageSizes, q.PageSize) {
+			return q, errors.New("Invalid page size")
+		}
+	}
+
+	if s := query.Get("sort"); s != "" {
+		if !slices.Contains(models.ReservationSorts, s) {
+			return q, errors.New("Invalid sort")
+		}
+		q.Sort = s
+	}
+
+	switch query.Get("dir") {
+	case "":
+	case "asc":
+		q.Desc = false
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errors.New("Invalid sort direction")
+	}
+
+	return q, nil
+}
+
+// renderReservationList renders a page of an admin reservation list. When status is
+// set the list only shows reservations with that status and offers no status filter.
+func (m *Repository) renderReservationList(w http.ResponseWriter, r *http.Request, tmpl, status string, desc bool, data map[string]any) {
+	query, err := parseReservationQuery(r.URL.Query(), desc)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+
+	list := models.ReservationList{
+		Path:         r.URL.Path,
+		StatusFilter: status == "",
+	}
+
+	if status != "" {
+		query.Status = status
+	}
+
+	list.Query = query
+
+	list.Result, err = m.DB.SearchReservations(query)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	list.Rooms, err = m.DB.ListRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data["list"] = list
+
+	render.Template(w, r, tmpl, &models.TemplateData{
+		Data: data,
+	})
+}
@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/rbac"
+)
+
+func TestParseReservationQuery(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedError string
+	}{
+		{"Defaults", "", ""},
+		{"Everything", "q=doe&room_id=1&start=2050-01-01&end=2050-02-01&status=pending&page=3&size=50&sort=name&dir=asc", ""},
+		{"Bad page", "page=0", "Invalid page"},
+		{"Bad size", "size=7", "Invalid page size"},
+		{"Bad sort", "sort=password", "Invalid sort"},
+		{"Bad direction", "dir=up", "Invalid sort direction"},
+		{"Bad filter", "room_id=a", "Invalid room"},
+		{"Bad status", "status=processed", "Invalid status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+
+			q, err := parseReservationQuery(query, true)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.query == "" && (q.Page != 1 || q.PageSize != 25 || q.Sort != "start_date" || !q.Desc) {
+				t.Errorf("unexpected defaults %+v", q)
+			}
+
+			if tt.query != "" && (q.Page != 3 || q.PageSize != 50 || q.Sort != "name" || q.Desc || q.Search != "doe" || q.RoomID != 1 || q.Status != "pending") {
+				t.Errorf("unexpected query %+v", q)
+			}
+		})
+	}
+}
+
+func TestRepository_AdminReservationLists(t *testing.T) {
+	tests := []struct {
+		name             string
+		path             string
+		handler          http.HandlerFunc
+		expectedCode     int
+		expected         []string
+		unexpected       []string
+		expectedLocation string
+	}{
+		{
+			"All", "/admin/reservations/all", Repo.AdminAllReservations, http.StatusOK,
+			[]string{"John Doe", "Jane Roe", "Showing 1 to 2 of 2", `href="/admin/reservations/all?dir=asc&amp;sort=start_date"`}, nil, "",
+		},
+		{
+			"Filtered by room", "/admin/reservations/all?room_id=2", Repo.AdminAllReservations, http.StatusOK,
+			[]string{"Jane Roe", `name="room_id" value="2"`}, []string{"John Doe"}, "",
+		},
+		{
+			"Page size", "/admin/reservations/all?size=10&page=1&dir=asc", Repo.AdminAllReservations, http.StatusOK,
+			[]string{"John Doe", "Showing 1 to 2 of 2"}, nil, "",
+		},
+		{
+			"Page past the end", "/admin/reservations/all?page=9", Repo.AdminAllReservations, http.StatusOK,
+			[]string{"No reservations found"}, []string{"John Doe"}, "",
+		},
+		{
+			"Only new", "/admin/reservations/new?status=confirmed", Repo.AdminNewReservations, http.StatusOK,
+			[]string{"John Doe", "Pending"}, []string{"Jane Roe", `id="status"`}, "",
+		},
+		{
+			"Filtered by status", "/admin/reservations/all?status=confirmed", Repo.AdminAllReservations, http.StatusOK,
+			[]string{"Jane Roe", `value="confirmed" selected`}, []string{"John Doe"}, "",
+		},
+		{
+			"Bad sort", "/admin/reservations/all?sort=password", Repo.AdminAllReservations, http.StatusSeeOther,
+			nil, nil, "/admin/reservations/all",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedLocation != "" && rr.Header().Get("Location") != tt.expectedLocation {
+				t.Errorf("expected redirect to %s, got %s", tt.expectedLocation, rr.Header().Get("Location"))
+			}
+
+			for _, expected := range tt.expected {
+				if !strings.Contains(rr.Body.String(), expected) {
+					t.Errorf("expected the page to contain %q", expected)
+				}
+			}
+
+			for _, unexpected := range tt.unexpected {
+				if strings.Contains(rr.Body.String(), unexpected) {
+					t.Errorf("expected the page not to contain %q", unexpected)
+				}
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_PostJsonAdminChangeResStatus(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		expectedOK      bool
+		expectedMessage string
+	}{
+		{"Confirm", `{"id": 1, "status": "confirmed"}`, true, "Reservation status has been changed!"},
+		{"Cancel", `{"id": 1, "status": "cancelled"}`, true, "Reservation status has been changed!"},
+		{"Skip a step", `{"id": 1, "status": "checked_out"}`, false, "This reservation can't be marked as checked out"},
+		{"Reopen cancelled", `{"id": 4, "status": "confirmed"}`, false, "This reservation can't be marked as confirmed"},
+		{"Back to pending", `{"id": 1, "status": "pending"}`, false, "This reservation can't be marked as pending"},
+		{"Unknown status", `{"id": 1, "status": "processed"}`, false, "Unknown status"},
+		{"Database error", `{"id": 3, "status": "confirmed"}`, false, "Error updating database"},
+		{"Invalid JSON", `{"id": `, false, "Internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/admin/reservations/status", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req = req.WithContext(getCtx(req))
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostJsonAdminChangeResStatus).ServeHTTP(rr, req)
+
+			var resp jsonResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.OK != tt.expectedOK || resp.Message != tt.expectedMessage {
+				t.Errorf("expected %v %q, got %v %q", tt.expectedOK, tt.expectedMessage, resp.OK, resp.Message)
+			}
+		})
+	}
+}
+
+func TestRepository_PostAdminRescheduleReservation(t *testing.T) {
+	tests := []struct {
+		name          string
+		id            string
+		form          string
+		expectedPath  string
+		expectedFlash string
+		expectedError string
+	}{
+		{"Move", "1", "room_id=2&start_date=2050-12-18&end_date=2050-12-21", "/admin/reservations/details/1", "Reservation changed, the guest has been emailed the new details", ""},
+		{"Unchanged", "1", "room_id=1&start_date=2050-12-17&end_date=2050-12-20", "/admin/reservations/details/1", "", ""},
+		{"Missing dates", "1", "room_id=2", "/admin/reservations/details/1", "", "Choose a room and the new dates"},
+		{"Bad room", "1", "room_id=a&start_date=2050-12-18&end_date=2050-12-21", "/admin/reservations/details/1", "", "Invalid room"},
+		{"Bad arrival", "1", "room_id=2&start_date=18-12-2050&end_date=2050-12-21", "/admin/reservations/details/1", "", "Invalid arrival date"},
+		{"Reversed dates", "1", "room_id=2&start_date=2050-12-21&end_date=2050-12-18", "/admin/reservations/details/1", "", "The departure must be after the arrival"},
+		{"Past arrival", "1", "room_id=2&start_date=2020-12-18&end_date=2050-12-21", "/admin/reservations/details/1", "", "The new arrival can't be in the past"},
+		{"Move and reprice", "1", "room_id=2&start_date=2050-12-18&end_date=2050-12-21&reprice=1", "/admin/reservations/details/1", "Reservation changed, the guest has been emailed the new details", ""},
+		{"Unknown room", "1", "room_id=9&start_date=2050-12-18&end_date=2050-12-21", "/admin/reservations/details/1", "", "Room not found"},
+		{"Cancelled reservation", "4", "room_id=2&start_date=2050-12-18&end_date=2050-12-21", "/admin/reservations/details/4", "", "This reservation can no longer be changed"},
+		{"Room taken", "5", "room_id=2&start_date=2050-12-18&end_date=2050-12-21", "/admin/reservations/details/5", "", "The room is not available for these dates"},
+		{"Party too big", "8", "room_id=2&start_date=2050-12-18&end_date=2050-12-21", "/admin/reservations/details/8", "", "The room sleeps at most 2 guests"},
+		{"Unknown reservation", "2", "room_id=2&start_date=2050-12-18&end_date=2050-12-21", "/admin/dashboard", "", "Reservation not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/admin/reservations/details/"+tt.id+"/reschedule", strings.NewReader(tt.form))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminRescheduleReservation).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther {
+				t.Fatalf("expected status %d, got %d", http.StatusSeeOther, rr.Code)
+			}
+
+			if rr.Header().Get("Location") != tt.expectedPath {
+				t.Errorf("expected redirect to %s, got %s", tt.expectedPath, rr.Header().Get("Location"))
+			}
+
+			if msg := app.Session.GetString(ctx, "flash"); msg != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", msg)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_RescheduleReservationTotal(t *testing.T) {
+	res, err := Repo.DB.GetReservationById(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Total = 12345
+
+	start := time.Date(2050, 12, 18, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2050, 12, 21, 0, 0, 0, 0, time.UTC)
+
+	quote, err := Repo.DB.QuoteStay(2, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		reprice  bool
+		expected int
+	}{
+		{"Keeps the booked total", false, 12345},
+		{"Reprices at the current rates", true, quote.Total},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved, err := Repo.rescheduleReservation(res, 2, start, end, tt.reprice)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if moved.Total != tt.expected {
+				t.Errorf("expected total %d, got %d", tt.expected, moved.Total)
+			}
+		})
+	}
+}
+
+func TestRepository_JsonAdminCalendarEditable(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     models.User
+		start    string
+		expected bool
+	}{
+		{"Front desk", createTestUser(1, int(rbac.FrontDesk)), "2050-12-01", true},
+		{"No role", createTestUser(1, 0), "2050-12-01", false},
+		{"Stay already started", createTestUser(1, int(rbac.FrontDesk)), "2024-12-01", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/reservations/calendar/json?start="+tt.start+"T00:00:00Z&end=2050-12-08T00:00:00Z", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", tt.user)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.JsonAdminCalendarReservations).ServeHTTP(rr, req)
+
+			var events []models.CalendarResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, event := range events {
+				if event.ExtendedProps["type"] == "reservation" && event.Editable != tt.expected {
+					t.Errorf("expected editable %v for event %s", tt.expected, event.ID)
+				}
+				if event.ExtendedProps["type"] == "block" && event.Editable {
+					t.Errorf("expected block %s not to be editable", event.ID)
+				}
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
+
+func TestRepository_PostJsonAdminMoveCalendarReservation(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		expectedCode  int
+		expectedError string
+	}{
+		{"Move", `{"id": 1, "start": "2050-12-18", "end": "2050-12-21"}`, http.StatusOK, ""},
+		{"Move to another room", `{"id": 1, "start": "2050-12-18", "end": "2050-12-21", "roomId": 2}`, http.StatusOK, ""},
+		{"Room taken", `{"id": 5, "start": "2050-12-18", "end": "2050-12-21"}`, http.StatusConflict, "The room is not available for these dates"},
+		{"Cancelled reservation", `{"id": 4, "start": "2050-12-18", "end": "2050-12-21"}`, http.StatusConflict, "This reservation can no longer be changed"},
+		{"Reversed dates", `{"id": 1, "start": "2050-12-21", "end": "2050-12-18"}`, http.StatusUnprocessableEntity, "The departure must be after the arrival"},
+		{"Past dates", `{"id": 1, "start": "2020-12-18", "end": "2020-12-21"}`, http.StatusUnprocessableEntity, "The new arrival can't be in the past"},
+		{"Unknown room", `{"id": 1, "start": "2050-12-18", "end": "2050-12-21", "roomId": 9}`, http.StatusUnprocessableEntity, "Room not found"},
+		{"Bad date", `{"id": 1, "start": "12/18/2050", "end": "2050-12-21"}`, http.StatusBadRequest, "Invalid start date, use YYYY-MM-DD"},
+		{"Invalid JSON", `{"id": `, http.StatusBadRequest, "Invalid request body"},
+		{"Unknown reservation", `{"id": 2, "start": "2050-12-18", "end": "2050-12-21"}`, http.StatusNotFound, "Reservation not found"},
+		{"Database error", `{"id": 3, "start": "2050-12-18", "end": "2050-12-21"}`, http.StatusInternalServerError, "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/admin/reservations/calendar/move", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req = req.WithContext(getCtx(req))
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostJsonAdminMoveCalendarReservation).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedError != "" {
+				var resp map[string]string
+				if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+
+				if resp["error"] != tt.expectedError {
+					t.Errorf("expected error %q, got %q", tt.expectedError, resp["error"])
+				}
+				return
+			}
+
+			var event models.CalendarResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &event); err != nil {
+				t.Fatal(err)
+			}
+
+			if event.ID != "1" || !event.Start.Equal(time.Date(2050, 12, 18, 0, 0, 0, 0, time.UTC)) || !event.End.Equal(time.Date(2050, 12, 21, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("unexpected event %+v", event)
+			}
+		})
+	}
+}
+
+func TestRepository_AdminReservationSummaryGroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		expectGroup bool
+	}{
+		{"Booked alone", "1", false},
+		{"Booked together", "6", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/reservations/details/"+tt.id, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", createTestUser(1, int(rbac.FrontDesk)))
+			defer app.Session.Destroy(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.AdminReservationSummary).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rr.Code)
+			}
+
+			if got := strings.Contains(rr.Body.String(), `href="/admin/reservations/details/7"`); got != tt.expectGroup {
+				t.Errorf("expected a link to the other room of the group %v, got %v", tt.expectGroup, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mlvieira/bookings/internal/forms"
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/render"
+	"github.com/mlvieira/bookings/internal/repository"
+)
+
+// blockDateLayout is the format sent by the date inputs on the room blocks page
+const blockDateLayout = "2006-01-02"
+
+// maxRoomCapacity is the largest number of guests a room can be set up for
+const maxRoomCapacity = 20
+
+// AdminRooms lists every room, including inactive ones, with links to manage them
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.ListRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-rooms.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// roomFromURL loads the room referenced by the id in the URL. It redirects to the
+// rooms list and returns false when the room cannot be found.
+func (m *Repository) roomFromURL(w http.ResponseWriter, r *http.Request) (models.Room, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid room id")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return models.Room{}, false
+	}
+
+	room, err := m.DB.GetRoomByID(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Room not found")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return models.Room{}, false
+	}
+
+	room.ID = id
+
+	return room, true
+}
+
+// roomForm reads and validates the room fields and nightly rates posted by the room form
+func roomForm(r *http.Request) (models.Room, models.RoomRate, *forms.Form) {
+	form := forms.New(r.PostForm)
+
+	room := models.Room{
+		RoomName:        strings.TrimSpace(r.Form.Get("room_name")),
+		RoomDescription: strings.TrimSpace(r.Form.Get("room_description")),
+		RoomURL:         strings.TrimSpace(r.Form.Get("room_url")),
+	}
+
+	form.Required("room_name", "room_url", "capacity", "base_rate", "weekend_rate")
+	form.MinLength("room_name", 3)
+	if form.Has("room_url") {
+		form.IsSlug("room_url")
+	}
+	if form.IntBetween("capacity", 1, maxRoomCapacity) {
+		room.Capacity, _ = strconv.Atoi(r.Form.Get("capacity"))
+	}
+
+	var rate models.RoomRate
+	if form.Has("base_rate") {
+		rate.BaseRate, _ = form.Cents("base_rate")
+	}
+	if form.Has("weekend_rate") {
+		rate.WeekendRate, _ = form.Cents("weekend_rate")
+	}
+
+	if r.Form.Get("active") == "1" {
+		room.Active = 1
+	}
+
+	return room, rate, form
+}
+
+// renderRoom renders the create or edit room form. Rates are shown as entered when
+// the form was posted, in dollars otherwise.
+func renderRoom(w http.ResponseWriter, r *http.Request, room models.Room, rate models.RoomRate, form *forms.Form) {
+	stringMap := make(map[string]string)
+	for field, cents := range map[string]int{"base_rate": rate.BaseRate, "weekend_rate": rate.WeekendRate} {
+		switch {
+		case form.Has(field):
+			stringMap[field] = form.Get(field)
+		case cents > 0:
+			stringMap[field] = fmt.Sprintf("%d.%02d", cents/100, cents%100)
+		}
+	}
+
+	data := make(map[string]any)
+	data["room"] = room
+
+	render.Template(w, r, "admin-room.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Form:      form,
+		Data:      data,
+	})
+}
+
+// AdminCreateRoom shows the form to add a room
+func (m *Repository) AdminCreateRoom(w http.ResponseWriter, r *http.Request) {
+	renderRoom(w, r, models.Room{Capacity: 2, Active: 1}, models.RoomRate{}, forms.New(nil))
+}
+
+// PostAdminCreateRoom adds a room
+func (m *Repository) PostAdminCreateRoom(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room, rate, form := roomForm(r)
+
+	if !form.Valid() {
+		renderRoom(w, r, room, rate, form)
+		return
+	}
+
+	room.ID, err = m.DB.CreateRoom(room, rate)
+	if errors.Is(err, repository.ErrRoomURLTaken) {
+		form.Errors.Add("room_url", "Another room already uses this URL")
+		renderRoom(w, r, room, rate, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Room %s created successfully", room.RoomName))
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminRoomDetails shows the form to edit a room
+func (m *Repository) AdminRoomDetails(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// rooms added before rates could be set have none, the form asks for them
+	rate, err := m.DB.GetRoomRate(room.ID)
+	if err != nil && !errors.Is(err, repository.ErrNoRoomRates) {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	renderRoom(w, r, room, rate, forms.New(nil))
+}
+
+// PostAdminRoomDetails saves the changes to a room
+func (m *Repository) PostAdminRoomDetails(w http.ResponseWriter, r *http.Request) {
+	existing, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room, rate, form := roomForm(r)
+	room.ID = existing.ID
+
+	if !form.Valid() {
+		renderRoom(w, r, room, rate, form)
+		return
+	}
+
+	err = m.DB.UpdateRoom(room, rate)
+	if errors.Is(err, repository.ErrRoomURLTaken) {
+		form.Errors.Add("room_url", "Another room already uses this URL")
+		renderRoom(w, r, room, rate, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room updated successfully")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", room.ID), http.StatusSeeOther)
+}
+
+// PostAdminDeleteRoom deletes a room that was never booked, along with its photos
+func (m *Repository) PostAdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	roomPhotos, err := m.DB.GetRoomPhotos(room.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.DeleteRoom(room.ID)
+	if errors.Is(err, repository.ErrRoomHasReservations) {
+		m.App.Session.Put(r.Context(), "error", "This room has reservations and can't be deleted, deactivate it instead")
+		http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", room.ID), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.removePhotoFiles(roomPhotos...)
+
+	m.App.Session.Put(r.Context(), "flash", "Room deleted")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminRoomBlocks shows the owner blocks of a room and the form to add one
+func (m *Repository) AdminRoomBlocks(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	m.renderRoomBlocks(w, r, room, forms.New(nil), models.RoomRestriction{}, nil)
+}
+
+// renderRoomBlocks renders the room blocks page with the form state and any conflicts
+// found while adding a block
+func (m *Repository) renderRoomBlocks(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form, block models.RoomRestriction, conflicts []models.RoomRestriction) {
+	blocks, err := m.DB.GetRoomBlocks(room.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	if !block.StartDate.IsZero() {
+		stringMap["start_date"] = block.StartDate.Format(blockDateLayout)
+	}
+	if !block.EndDate.IsZero() {
+		stringMap["end_date"] = block.EndDate.Format(blockDateLayout)
+	}
+	stringMap["reason"] = block.Reason
+
+	data := make(map[string]any)
+	data["room"] = room
+	data["blocks"] = blocks
+	data["conflicts"] = conflicts
+
+	render.Template(w, r, "admin-room-blocks.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Form:      form,
+		Data:      data,
+	})
+}
+
+// PostAdminRoomBlock closes a room for the submitted dates. Blocks that overlap
+// reservations or other blocks are rejected and the conflicts are listed.
+func (m *Repository) PostAdminRoomBlock(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("start_date", "end_date", "reason")
+
+	block := models.RoomRestriction{
+		RoomID: room.ID,
+		Reason: r.Form.Get("reason"),
+	}
+
+	if form.Has("start_date") {
+		block.StartDate, err = time.Parse(blockDateLayout, r.Form.Get("start_date"))
+		if err != nil {
+			form.Errors.Add("start_date", "Invalid date")
+		}
+	}
+
+	if form.Has("end_date") {
+		block.EndDate, err = time.Parse(blockDateLayout, r.Form.Get("end_date"))
+		if err != nil {
+			form.Errors.Add("end_date", "Invalid date")
+		}
+	}
+
+	if !block.StartDate.IsZero() && !block.EndDate.IsZero() && !block.EndDate.After(block.StartDate) {
+		form.Errors.Add("end_date", "The end date must be after the start date")
+	}
+
+	if len(block.Reason) > 255 {
+		form.Errors.Add("reason", "The reason must be at most 255 characters")
+	}
+
+	if !form.Valid() {
+		m.renderRoomBlocks(w, r, room, form, block, nil)
+		return
+	}
+
+	_, err = m.DB.InsertRoomBlock(block)
+
+	var conflictErr *repository.DatesConflictError
+	if errors.As(err, &conflictErr) {
+		form.Errors.Add("start_date", "These dates overlap existing reservations or blocks")
+		m.renderRoomBlocks(w, r, room, form, block, conflictErr.Conflicts)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room blocked successfully")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/blocks", room.ID), http.StatusSeeOther)
+}
+
+// PostAdminDeleteRoomBlock reopens a room by removing one of its blocks
+func (m *Repository) PostAdminDeleteRoomBlock(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	blocksURL := fmt.Sprintf("/admin/rooms/%d/blocks", room.ID)
+
+	blockID, err := strconv.Atoi(chi.URLParam(r, "blockID"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid block id")
+		http.Redirect(w, r, blocksURL, http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.DeleteRoomBlock(room.ID, blockID)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Block not found")
+		http.Redirect(w, r, blocksURL, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Block removed")
+	http.Redirect(w, r, blocksURL, http.StatusSeeOther)
+}
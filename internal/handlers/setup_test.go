@@ -10,9 +10,14 @@ import (
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mlvieira/bookings/internal/calsync"
 	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/emails"
 	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/mailer"
 	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/outbox"
+	"github.com/mlvieira/bookings/internal/photos"
 	"github.com/mlvieira/bookings/internal/render"
 	dbrepo "github.com/mlvieira/bookings/internal/repository/dbRepo"
 )
@@ -25,13 +30,11 @@ func TestMain(m *testing.M) {
 	}
 
 	gob.Register(models.Reservation{})
+	gob.Register(models.Cart{})
+	gob.Register(models.ReservationGroup{})
 
 	app = *config.SetupAppConfig(false)
 
-	defer close(app.MailChan)
-
-	listenForMail()
-
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
 		log.Fatal(err)
@@ -40,13 +43,38 @@ func TestMain(m *testing.M) {
 	app.TemplateCache = tc
 	app.UseCache = app.InProduction
 	app.Port = ":8080"
+	app.BaseURL = "http://localhost:8080"
+	app.SigningKey = []byte("test-signing-key")
 
 	repo := newTestRepo(&app)
+	app.Mail = config.MailConfig{
+		Transport:   "memory",
+		From:        "noreply@bookings.com",
+		OwnerEmails: []string{"owner@bookings.com"},
+	}
+	app.Emails, err = emails.New("./email-templates")
+	if err != nil {
+		log.Fatal(err)
+	}
+	photoDir, err := os.MkdirTemp("", "bookings-photos")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app.Photos, err = photos.New(photoDir, photos.Options{MaxFileSize: 256 << 10})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the outbox worker is never started in tests
+	app.Outbox = outbox.New(repo.DB, mailer.NewMemory().Send, outbox.Options{})
+	app.CalendarSync = calsync.New(repo.DB, calsync.Options{})
 	NewHandlers(repo)
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
 
-	os.Exit(m.Run())
+	code := m.Run()
+	os.RemoveAll(photoDir)
+	os.Exit(code)
 }
 
 func getRoutes() http.Handler {
@@ -66,9 +94,28 @@ func getRoutes() http.Handler {
 	mux.Get("/book", Repo.Booking)
 	mux.Post("/book", Repo.PostBooking)
 	mux.Get("/book/summary", Repo.ReservationSummary)
+	mux.Get("/cart", Repo.Cart)
+	mux.Post("/cart", Repo.PostCart)
+	mux.Post("/cart/add", Repo.PostCartAdd)
+	mux.Post("/cart/remove", Repo.PostCartRemove)
+	mux.Get("/cart/summary", Repo.CartSummary)
+	mux.Get("/reservations/manage/{token}", Repo.ManageReservation)
+	mux.Post("/reservations/manage/{token}/cancel", Repo.PostCancelReservation)
 	mux.Get("/user/login", Repo.ShowLoginPage)
 	mux.Post("/user/login", Repo.PostShowLoginPage)
 	mux.Get("/user/logout", Repo.Logout)
+	mux.Get("/feeds/{token}.ics", Repo.CalendarFeed)
+
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.NotFound(Repo.ApiNotFound)
+		mux.MethodNotAllowed(Repo.ApiMethodNotAllowed)
+
+		mux.Get("/rooms", Repo.ApiListRooms)
+		mux.Get("/rooms/{room}", Repo.ApiGetRoom)
+		mux.Get("/availability", Repo.ApiSearchAvailability)
+		mux.Post("/reservations", Repo.ApiCreateReservation)
+		mux.Get("/reservations/{token}", Repo.ApiGetReservation)
+	})
 
 	mux.Route("/admin", func(mux chi.Router) {
 		mux.Use(auth(app.Session))
@@ -79,18 +126,54 @@ func getRoutes() http.Handler {
 		mux.Get("/dashboard", Repo.AdminDashboard)
 		mux.Get("/reservations/new", Repo.AdminNewReservations)
 		mux.Get("/reservations/all", Repo.AdminAllReservations)
+		mux.Get("/reservations/export", Repo.AdminExportReservations)
 		mux.Get("/reservations/calendar", Repo.AdminCalendarReservations)
 		mux.Get("/reservations/calendar/json", Repo.JsonAdminCalendarReservations)
+		mux.Get("/reservations/timeline/json", Repo.JsonAdminTimeline)
+		mux.Get("/reports/json", Repo.JsonAdminReport)
 		mux.Get("/reservations/details/{id}", Repo.AdminReservationSummary)
 		mux.Post("/reservations/details/{id}", Repo.PostAdminReservationSummary)
-		mux.Post("/reservations/processed", Repo.PostJsonAdminChangeResStatus)
+		mux.Post("/reservations/details/{id}/reschedule", Repo.PostAdminRescheduleReservation)
+		mux.Post("/reservations/status", Repo.PostJsonAdminChangeResStatus)
+		mux.Post("/reservations/calendar/move", Repo.PostJsonAdminMoveCalendarReservation)
 		mux.Post("/reservations/delete", Repo.PostJsonAdminDeleteRes)
 		mux.Get("/users", Repo.AdminListUsers)
 		mux.Get("/users/new", Repo.AdminCreateUser)
 		mux.Post("/users/new", Repo.PostAdminCreateUser)
 		mux.Get("/users/details/{id}", Repo.AdminUserSummary)
 		mux.Post("/users/details/{id}", Repo.PostAdminUserSummary)
+		mux.Post("/users/details/{id}/tokens", Repo.PostAdminCreateAPIToken)
+		mux.Post("/users/details/{id}/tokens/{tokenID}/revoke", Repo.PostAdminRevokeAPIToken)
 		mux.Post("/users/delete", Repo.PostJsonAdminDeleteUser)
+		mux.Get("/rooms", Repo.AdminRooms)
+		mux.Get("/rooms/new", Repo.AdminCreateRoom)
+		mux.Post("/rooms/new", Repo.PostAdminCreateRoom)
+		mux.Get("/rooms/{id}", Repo.AdminRoomDetails)
+		mux.Post("/rooms/{id}", Repo.PostAdminRoomDetails)
+		mux.Post("/rooms/{id}/delete", Repo.PostAdminDeleteRoom)
+		mux.Get("/rooms/{id}/photos", Repo.AdminRoomPhotos)
+		mux.Post("/rooms/{id}/photos", Repo.PostAdminRoomPhotos)
+		mux.Post("/rooms/{id}/photos/{photoID}/cover", Repo.PostAdminRoomPhotoCover)
+		mux.Post("/rooms/{id}/photos/{photoID}/move", Repo.PostAdminMoveRoomPhoto)
+		mux.Post("/rooms/{id}/photos/{photoID}/delete", Repo.PostAdminDeleteRoomPhoto)
+		mux.Get("/rooms/{id}/rules", Repo.AdminStayRules)
+		mux.Post("/rooms/{id}/rules", Repo.PostAdminStayRule)
+		mux.Post("/rooms/{id}/rules/{ruleID}/delete", Repo.PostAdminDeleteStayRule)
+		mux.Get("/rooms/{id}/blocks", Repo.AdminRoomBlocks)
+		mux.Post("/rooms/{id}/blocks", Repo.PostAdminRoomBlock)
+		mux.Post("/rooms/{id}/blocks/{blockID}/delete", Repo.PostAdminDeleteRoomBlock)
+		mux.Get("/rooms/{id}/calendars", Repo.AdminCalendarImports)
+		mux.Post("/rooms/{id}/calendars", Repo.PostAdminCalendarImport)
+		mux.Post("/rooms/{id}/calendars/{importID}/sync", Repo.PostAdminSyncCalendarImport)
+		mux.Post("/rooms/{id}/calendars/{importID}/upload", Repo.PostAdminUploadCalendarImport)
+		mux.Post("/rooms/{id}/calendars/{importID}/delete", Repo.PostAdminDeleteCalendarImport)
+		mux.Get("/feeds", Repo.AdminCalendarFeeds)
+		mux.Post("/feeds", Repo.PostAdminCreateCalendarFeed)
+		mux.Post("/feeds/{id}/delete", Repo.PostAdminDeleteCalendarFeed)
+		mux.Get("/mail", Repo.AdminMailOutbox)
+		mux.Post("/mail/{id}/resend", Repo.PostAdminResendMail)
+		mux.Get("/mail/templates", Repo.AdminMailTemplates)
+		mux.Get("/mail/templates/{name}", Repo.AdminPreviewMailTemplate)
 	})
 
 	fileServer := http.FileServer(http.Dir("./static"))
@@ -111,14 +194,6 @@ func newTestRepo(a *config.AppConfig) *Repository {
 	}
 }
 
-func listenForMail() {
-	go func() {
-		for {
-			_ = <-app.MailChan
-		}
-	}()
-}
-
 func auth(session *scs.SessionManager) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
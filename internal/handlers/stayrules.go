@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mlvieira/bookings/internal/forms"
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/render"
+)
+
+// stayRuleLimits are the largest values accepted for the numeric stay rule fields
+var stayRuleLimits = map[string]int{
+	"min_nights":   365,
+	"max_nights":   365,
+	"lead_days":    365,
+	"horizon_days": 1095,
+}
+
+// AdminStayRules shows the stay rules of a room and the form to add one
+func (m *Repository) AdminStayRules(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	m.renderStayRules(w, r, room, forms.New(nil))
+}
+
+// renderStayRules renders the stay rules page with the form state
+func (m *Repository) renderStayRules(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form) {
+	rules, err := m.DB.GetStayRules(room.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["room"] = room
+	data["rules"] = rules
+	data["weekdays"] = []time.Weekday{
+		time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday,
+	}
+
+	// keep the ticked days when the form is shown again with errors
+	intMap := make(map[string]int)
+	intMap["closed_to_arrival"] = weekdayMask(form.Values["closed_to_arrival"])
+	intMap["closed_to_departure"] = weekdayMask(form.Values["closed_to_departure"])
+
+	render.Template(w, r, "admin-stay-rules.page.html", &models.TemplateData{
+		Form:   form,
+		Data:   data,
+		IntMap: intMap,
+	})
+}
+
+// PostAdminStayRule adds a stay rule to a room. A rule without dates replaces the
+// room's default rule; a rule with dates applies to arrivals in that season.
+func (m *Repository) PostAdminStayRule(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	rule := models.StayRule{
+		RoomID:     room.ID,
+		SeasonName: strings.TrimSpace(r.Form.Get("season_name")),
+	}
+
+	for field, limit := range stayRuleLimits {
+		if form.Has(field) {
+			form.IntBetween(field, 0, limit)
+		}
+	}
+	rule.MinNights, _ = strconv.Atoi(r.Form.Get("min_nights"))
+	rule.MaxNights, _ = strconv.Atoi(r.Form.Get("max_nights"))
+	rule.LeadDays, _ = strconv.Atoi(r.Form.Get("lead_days"))
+	rule.HorizonDays, _ = strconv.Atoi(r.Form.Get("horizon_days"))
+
+	if rule.MinNights > 0 && rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+		form.Errors.Add("max_nights", "The maximum stay can't be shorter than the minimum stay")
+	}
+
+	rule.ClosedToArrival = weekdayMask(r.Form["closed_to_arrival"])
+	rule.ClosedToDeparture = weekdayMask(r.Form["closed_to_departure"])
+
+	if form.Has("start_date") || form.Has("end_date") {
+		form.Required("start_date", "end_date", "season_name")
+
+		if form.Has("start_date") {
+			rule.StartDate, err = time.Parse(blockDateLayout, r.Form.Get("start_date"))
+			if err != nil {
+				form.Errors.Add("start_date", "Invalid date")
+			}
+		}
+
+		if form.Has("end_date") {
+			rule.EndDate, err = time.Parse(blockDateLayout, r.Form.Get("end_date"))
+			if err != nil {
+				form.Errors.Add("end_date", "Invalid date")
+			}
+		}
+
+		if !rule.StartDate.IsZero() && !rule.EndDate.IsZero() && rule.EndDate.Before(rule.StartDate) {
+			form.Errors.Add("end_date", "The end date can't be before the start date")
+		}
+	} else if rule.SeasonName != "" {
+		form.Errors.Add("start_date", "Seasonal rules need a start and end date")
+	}
+
+	if !form.Valid() {
+		m.renderStayRules(w, r, room, form)
+		return
+	}
+
+	_, err = m.DB.SaveStayRule(rule)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/rules", room.ID), http.StatusSeeOther)
+}
+
+// PostAdminDeleteStayRule removes a stay rule from a room
+func (m *Repository) PostAdminDeleteStayRule(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	rulesURL := fmt.Sprintf("/admin/rooms/%d/rules", room.ID)
+
+	ruleID, err := strconv.Atoi(chi.URLParam(r, "ruleID"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid rule id")
+		http.Redirect(w, r, rulesURL, http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.DeleteStayRule(room.ID, ruleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Stay rule not found")
+		http.Redirect(w, r, rulesURL, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule removed")
+	http.Redirect(w, r, rulesURL, http.StatusSeeOther)
+}
+
+// weekdayMask turns the posted weekday numbers (0 for Sunday) into a bitmask
+func weekdayMask(values []string) int {
+	var mask int
+	for _, v := range values {
+		day, err := strconv.Atoi(v)
+		if err == nil && day >= 0 && day <= 6 {
+			mask |= 1 << day
+		}
+	}
+
+	return mask
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRepository_AdminStayRules(t *testing.T) {
+	req, err := http.NewRequest("GET", "/admin/rooms/1/rules", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminStayRules).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if !strings.Contains(rr.Body.String(), "Sun") {
+		t.Error("expected the closed to arrival days of the default rule to be listed")
+	}
+}
+
+func TestRepository_PostAdminStayRule(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         url.Values
+		expectedCode int
+	}{
+		{"Default rule", url.Values{"min_nights": {"2"}, "closed_to_arrival": {"0", "6"}}, http.StatusSeeOther},
+		{
+			"Seasonal rule",
+			url.Values{"season_name": {"Summer"}, "start_date": {"2050-07-01"}, "end_date": {"2050-08-31"}, "min_nights": {"7"}},
+			http.StatusSeeOther,
+		},
+		{"Maximum shorter than minimum", url.Values{"min_nights": {"5"}, "max_nights": {"3"}}, http.StatusOK},
+		{"Invalid number", url.Values{"min_nights": {"many"}}, http.StatusOK},
+		{"Season without dates", url.Values{"season_name": {"Summer"}}, http.StatusOK},
+		{"Dates without season", url.Values{"start_date": {"2050-07-01"}, "end_date": {"2050-08-31"}}, http.StatusOK},
+		{
+			"End before start",
+			url.Values{"season_name": {"Summer"}, "start_date": {"2050-08-31"}, "end_date": {"2050-07-01"}},
+			http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/admin/rooms/1/rules", strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+			app.Session.Put(ctx, "user", createTestUser(1, 3))
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminStayRule).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedCode == http.StatusSeeOther && rr.Header().Get("Location") != "/admin/rooms/1/rules" {
+				t.Errorf("expected redirect to /admin/rooms/1/rules, got %s", rr.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestRepository_PostAdminDeleteStayRule(t *testing.T) {
+	tests := []struct {
+		name          string
+		ruleID        string
+		expectedFlash string
+		expectedError string
+	}{
+		{"Delete", "1", "Stay rule removed", ""},
+		{"Not found", "2", "", "Stay rule not found"},
+		{"Invalid id", "a", "", "Invalid rule id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", fmt.Sprintf("/admin/rooms/1/rules/%s/delete", tt.ruleID), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+			rctx.URLParams.Add("ruleID", tt.ruleID)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			ctx := getCtx(req)
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.PostAdminDeleteStayRule).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/rooms/1/rules" {
+				t.Errorf("expected redirect to /admin/rooms/1/rules, got %d %s", rr.Code, rr.Header().Get("Location"))
+			}
+
+			if flash := app.Session.GetString(ctx, "flash"); flash != tt.expectedFlash {
+				t.Errorf("unexpected flash %q", flash)
+			}
+
+			if msg := app.Session.GetString(ctx, "error"); msg != tt.expectedError {
+				t.Errorf("unexpected error %q", msg)
+			}
+
+			app.Session.Destroy(ctx)
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/lifecycle"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/rbac"
+)
+
+const (
+	// timelineDefaultDays is how many days the timeline shows when no end is asked for
+	timelineDefaultDays = 14
+	// timelineMaxDays bounds the range one timeline request can cover
+	timelineMaxDays = 93
+)
+
+// timelineColors colors timeline events by reservation status or restriction type
+var timelineColors = map[string]string{
+	string(lifecycle.Pending):    "#ffc107",
+	string(lifecycle.Confirmed):  "#0d6efd",
+	string(lifecycle.CheckedIn):  "#198754",
+	string(lifecycle.CheckedOut): "#adb5bd",
+	"block":                      "#6c757d",
+	"external":                   "#6f42c1",
+}
+
+// timelineResource is a room row of the timeline
+type timelineResource struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Capacity int    `json:"capacity"`
+	Active   bool   `json:"active"`
+}
+
+// timelineEvent is a reservation, owner block or external booking in a room row.
+// End is the checkout day, which is not covered.
+type timelineEvent struct {
+	ID         string  `json:"id"`
+	ResourceID int     `json:"resourceId"`
+	Type       string  `json:"type"`
+	Title      string  `json:"title"`
+	Start      apiDate `json:"start"`
+	End        apiDate `json:"end"`
+	Status     string  `json:"status,omitempty"`
+	Color      string  `json:"color"`
+	URL        string  `json:"url"`
+	Editable   bool    `json:"editable"`
+}
+
+// timelineResponse holds the rooms and what occupies them between Start and End
+type timelineResponse struct {
+	Start     apiDate            `json:"start"`
+	End       apiDate            `json:"end"`
+	Resources []timelineResource `json:"resources"`
+	Events    []timelineEvent    `json:"events"`
+}
+
+// parseTimelineRange reads the start and end (YYYY-MM-DD) query parameters. The
+// timeline starts today and shows two weeks unless asked otherwise.
+func parseTimelineRange(query url.Values, now time.Time) (time.Time, time.Time, error) {
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var err error
+
+	if s := query.Get("start"); s != "" {
+		start, err = time.Parse(apiDateLayout, s)
+		if err != nil {
+			return start, start, errors.New("Invalid start date, use YYYY-MM-DD")
+		}
+	}
+
+	end := start.AddDate(0, 0, timelineDefaultDays)
+
+	if s := query.Get("end"); s != "" {
+		end, err = time.Parse(apiDateLayout, s)
+		if err != nil {
+			return start, end, errors.New("Invalid end date, use YYYY-MM-DD")
+		}
+	}
+
+	if !end.After(start) {
+		return start, end, errors.New("The end date must be after the start date")
+	}
+
+	if end.Sub(start) > timelineMaxDays*24*time.Hour {
+		return start, end, fmt.Errorf("The timeline can show at most %d days", timelineMaxDays)
+	}
+
+	return start, end, nil
+}
+
+// JsonAdminTimeline returns the rooms as resources and the reservations, owner blocks
+// and external bookings between the start and end query parameters as events keyed by
+// room, for the rooms-by-days grid of the admin calendar. Rooms out of service are
+// only included when something occupies them.
+func (m *Repository) JsonAdminTimeline(w http.ResponseWriter, r *http.Request) {
+	writeError := func(status int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": msg,
+		})
+	}
+
+	start, end, err := parseTimelineRange(r.URL.Query(), time.Now())
+	if err != nil {
+		writeError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rooms, err := m.DB.ListRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeError(http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	reservations, err := m.DB.AllReservations(&start, &end)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeError(http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	closures, err := m.DB.RoomClosuresBetween(start, end)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeError(http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	user, _ := helpers.CurrentUser(r)
+	canEdit := rbac.Can(user.AccessLevel, rbac.EditReservations)
+
+	timeline := timelineResponse{
+		Start:     apiDate(start),
+		End:       apiDate(end),
+		Resources: []timelineResource{},
+		Events:    []timelineEvent{},
+	}
+
+	occupied := make(map[int]bool)
+
+	for _, res := range reservations {
+		status := lifecycle.Status(res.Status)
+		if status.ReleasesRoom() {
+			continue
+		}
+
+		occupied[res.RoomID] = true
+		timeline.Events = append(timeline.Events, timelineEvent{
+			ID:         fmt.Sprintf("%d", res.ID),
+			ResourceID: res.RoomID,
+			Type:       "reservation",
+			Title:      fmt.Sprintf("%s %s", res.FirstName, res.LastName),
+			Start:      apiDate(res.StartDate),
+			End:        apiDate(res.EndDate),
+			Status:     res.Status,
+			Color:      timelineColors[res.Status],
+			URL:        fmt.Sprintf("/admin/reservations/details/%d", res.ID),
+			Editable:   canEdit && lifecycle.CanReschedule(res.Status, res.StartDate, time.Now()),
+		})
+	}
+
+	for _, closure := range closures {
+		event := timelineEvent{
+			ID:         fmt.Sprintf("block-%d", closure.ID),
+			ResourceID: closure.RoomID,
+			Type:       "block",
+			Title:      closure.Reason,
+			Start:      apiDate(closure.StartDate),
+			End:        apiDate(closure.EndDate),
+			Color:      timelineColors["block"],
+			URL:        fmt.Sprintf("/admin/rooms/%d/blocks", closure.RoomID),
+		}
+
+		if closure.RestrictionID == models.RestrictionExternal {
+			event.ID = fmt.Sprintf("external-%d", closure.ID)
+			event.Type = "external"
+			event.Color = timelineColors["external"]
+			event.URL = fmt.Sprintf("/admin/rooms/%d/calendars", closure.RoomID)
+		}
+
+		if event.Title == "" {
+			event.Title = "Blocked"
+		}
+
+		occupied[closure.RoomID] = true
+		timeline.Events = append(timeline.Events, event)
+	}
+
+	for _, room := range rooms {
+		if room.Active == 0 && !occupied[room.ID] {
+			continue
+		}
+
+		timeline.Resources = append(timeline.Resources, timelineResource{
+			ID:       room.ID,
+			Title:    room.RoomName,
+			Capacity: room.Capacity,
+			Active:   room.Active == 1,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(timeline); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
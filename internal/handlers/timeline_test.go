@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/rbac"
+)
+
+func TestParseTimelineRange(t *testing.T) {
+	now := time.Date(2050, 12, 18, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedStart string
+		expectedEnd   string
+		expectedError string
+	}{
+		{"Defaults", "", "2050-12-18", "2051-01-01", ""},
+		{"Start only", "start=2050-12-01", "2050-12-01", "2050-12-15", ""},
+		{"Start and end", "start=2050-12-01&end=2050-12-08", "2050-12-01", "2050-12-08", ""},
+		{"Bad start", "start=12/01/2050", "", "", "Invalid start date, use YYYY-MM-DD"},
+		{"Bad end", "end=tomorrow", "", "", "Invalid end date, use YYYY-MM-DD"},
+		{"Reversed", "start=2050-12-08&end=2050-12-01", "", "", "The end date must be after the start date"},
+		{"Too long", "start=2050-01-01&end=2050-06-01", "", "", "The timeline can show at most 93 days"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+
+			start, end, err := parseTimelineRange(query, now)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Fatalf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if got := start.Format(apiDateLayout); got != tt.expectedStart {
+				t.Errorf("expected start %s, got %s", tt.expectedStart, got)
+			}
+			if got := end.Format(apiDateLayout); got != tt.expectedEnd {
+				t.Errorf("expected end %s, got %s", tt.expectedEnd, got)
+			}
+		})
+	}
+}
+
+func TestRepository_JsonAdminTimeline(t *testing.T) {
+	req, err := http.NewRequest("GET", "/admin/reservations/timeline/json?start=2050-12-18&end=2050-12-25", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	app.Session.Put(ctx, "user", createTestUser(1, int(rbac.FrontDesk)))
+	defer app.Session.Destroy(ctx)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.JsonAdminTimeline).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var timeline struct {
+		Start     string             `json:"start"`
+		End       string             `json:"end"`
+		Resources []timelineResource `json:"resources"`
+		Events    []struct {
+			ID         string `json:"id"`
+			ResourceID int    `json:"resourceId"`
+			Type       string `json:"type"`
+			Status     string `json:"status"`
+			Color      string `json:"color"`
+			Editable   bool   `json:"editable"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &timeline); err != nil {
+		t.Fatal(err)
+	}
+
+	if timeline.Start != "2050-12-18" || timeline.End != "2050-12-25" {
+		t.Errorf("unexpected range %s to %s", timeline.Start, timeline.End)
+	}
+
+	// the inactive room has nothing booked, so only the active one is a row
+	if len(timeline.Resources) != 1 || timeline.Resources[0].ID != 1 {
+		t.Fatalf("expected only room 1 as a resource, got %+v", timeline.Resources)
+	}
+
+	types := make(map[string]int)
+	for _, event := range timeline.Events {
+		types[event.Type]++
+
+		switch event.Type {
+		case "reservation":
+			if event.Color != timelineColors[event.Status] {
+				t.Errorf("expected reservation %s colored %s, got %s", event.ID, timelineColors[event.Status], event.Color)
+			}
+			if !event.Editable {
+				t.Errorf("expected reservation %s to be editable", event.ID)
+			}
+		case "block", "external":
+			if event.Color != timelineColors[event.Type] {
+				t.Errorf("expected %s %s colored %s, got %s", event.Type, event.ID, timelineColors[event.Type], event.Color)
+			}
+			if event.Editable {
+				t.Errorf("expected %s %s not to be editable", event.Type, event.ID)
+			}
+		default:
+			t.Errorf("unexpected event type %q", event.Type)
+		}
+	}
+
+	if types["reservation"] == 0 || types["block"] == 0 || types["external"] == 0 {
+		t.Errorf("expected reservations, blocks and external bookings, got %v", types)
+	}
+}
+
+func TestRepository_JsonAdminTimelineErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedCode  int
+		expectedError string
+	}{
+		{"Bad date", "?start=12/18/2050", http.StatusBadRequest, "Invalid start date, use YYYY-MM-DD"},
+		{"Database error", "?start=0001-01-01", http.StatusInternalServerError, "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/reservations/timeline/json"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req = req.WithContext(getCtx(req))
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Repo.JsonAdminTimeline).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			var resp map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if resp["error"] != tt.expectedError {
+				t.Errorf("expected error %q, got %q", tt.expectedError, resp["error"])
+			}
+		})
+	}
+}
@@ -1,15 +1,22 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"runtime/debug"
 
 	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/models"
 )
 
 var app *config.AppConfig
 
+type contextKey string
+
+// userContextKey holds the user authenticated by a bearer token for the current request
+const userContextKey contextKey = "user"
+
 // NewHelpers sets up app config for helpers
 func NewHelpers(a *config.AppConfig) {
 	app = a
@@ -34,6 +41,21 @@ func IsAuthenticated(r *http.Request) bool {
 	return exists
 }
 
+// WithUser returns a copy of the request carrying a user authenticated without a session
+func WithUser(r *http.Request, user models.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+}
+
+// CurrentUser returns the user making the request, either from a bearer token or the session
+func CurrentUser(r *http.Request) (models.User, bool) {
+	if user, ok := r.Context().Value(userContextKey).(models.User); ok {
+		return user, true
+	}
+
+	user, ok := app.Session.Get(r.Context(), "user").(models.User)
+	return user, ok
+}
+
 func HasPermission(userAccessLevel, requiredAccessLevel int) bool {
 	return userAccessLevel >= requiredAccessLevel
 }
@@ -0,0 +1,125 @@
+// Package ical reads and writes RFC 5545 iCalendar feeds of all-day events, so
+// reservations and room blocks can be shared with calendar apps and other booking sites.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ProdID identifies this application as the producer of the feeds
+const ProdID = "-//mlvieira//bookings//EN"
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405Z"
+	// maxLineOctets is the longest content line allowed before folding, excluding the CRLF
+	maxLineOctets = 75
+)
+
+// Event is an all-day event. Start is its first day and End the day after its last
+// one, since DTEND is exclusive; for a stay that is the departure date.
+type Event struct {
+	// UID must stay the same every time the event is exported
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	// Status is the event STATUS, such as CONFIRMED or CANCELLED. It is left out when empty.
+	Status       string
+	Start        time.Time
+	End          time.Time
+	Created      time.Time
+	LastModified time.Time
+}
+
+// Calendar is a named list of events
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Write encodes the calendar as an iCalendar stream
+func Write(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:"+ProdID)
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	if cal.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(cal.Name))
+	}
+
+	for _, e := range cal.Events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+escapeText(e.UID))
+		// DTSTAMP follows the event rather than the request so unchanged events export identically
+		writeLine(bw, "DTSTAMP:"+formatDateTime(e.LastModified))
+		writeLine(bw, "DTSTART;VALUE=DATE:"+e.Start.Format(dateLayout))
+		writeLine(bw, "DTEND;VALUE=DATE:"+e.End.Format(dateLayout))
+		writeLine(bw, "SUMMARY:"+escapeText(e.Summary))
+		if e.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escapeText(e.Description))
+		}
+		if e.URL != "" {
+			writeLine(bw, "URL:"+e.URL)
+		}
+		if e.Status != "" {
+			writeLine(bw, "STATUS:"+e.Status)
+		}
+		if !e.Created.IsZero() {
+			writeLine(bw, "CREATED:"+formatDateTime(e.Created))
+		}
+		writeLine(bw, "LAST-MODIFIED:"+formatDateTime(e.LastModified))
+		writeLine(bw, "TRANSP:OPAQUE")
+		writeLine(bw, "END:VEVENT")
+	}
+
+	writeLine(bw, "END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+// writeLine writes a content line terminated by CRLF, folding it into 75 octet
+// chunks without splitting UTF-8 characters
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// continuation lines start with a space that counts towards the limit
+		limit = maxLineOctets - 1
+	}
+
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// escapeText escapes a TEXT property value
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format(dateTimeLayout)
+}
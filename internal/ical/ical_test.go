@@ -0,0 +1,96 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	modified := time.Date(2050, 1, 2, 15, 4, 5, 0, time.FixedZone("BRT", -3*3600))
+
+	cal := Calendar{
+		Name: "Major's Suite",
+		Events: []Event{
+			{
+				UID:          "reservation-1@bookings.example.com",
+				Summary:      "John Doe, Major's Suite; 2 guests",
+				Description:  "Line one\nLine two",
+				URL:          "https://bookings.example.com/admin/reservations/details/1",
+				Start:        time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC),
+				End:          time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC),
+				LastModified: modified,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, cal); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:Major's Suite\r\n",
+		"UID:reservation-1@bookings.example.com\r\n",
+		"DTSTART;VALUE=DATE:20501217\r\n",
+		"DTEND;VALUE=DATE:20501220\r\n",
+		`SUMMARY:John Doe\, Major's Suite\; 2 guests` + "\r\n",
+		`DESCRIPTION:Line one\nLine two` + "\r\n",
+		"LAST-MODIFIED:20500102T180405Z\r\n",
+		"DTSTAMP:20500102T180405Z\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out)
+		}
+	}
+
+	if strings.Contains(out, "CREATED:") {
+		t.Error("expected CREATED to be left out when unknown")
+	}
+}
+
+func TestWriteFoldsLongLines(t *testing.T) {
+	cal := Calendar{
+		Events: []Event{
+			{
+				UID:     "block-1@bookings.example.com",
+				Summary: strings.Repeat("é", 100),
+				Start:   time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC),
+				End:     time.Date(2050, 12, 18, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, cal); err != nil {
+		t.Fatal(err)
+	}
+
+	var summary strings.Builder
+	inSummary := false
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line longer than %d octets: %q", maxLineOctets, line)
+		}
+
+		switch {
+		case strings.HasPrefix(line, "SUMMARY:"):
+			inSummary = true
+			summary.WriteString(strings.TrimPrefix(line, "SUMMARY:"))
+		case inSummary && strings.HasPrefix(line, " "):
+			summary.WriteString(line[1:])
+		default:
+			inSummary = false
+		}
+	}
+
+	if summary.String() != strings.Repeat("é", 100) {
+		t.Errorf("expected the folded summary to unfold to the original text, got %q", summary.String())
+	}
+}
@@ -0,0 +1,202 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotCalendar is returned when the input has no VCALENDAR object
+var ErrNotCalendar = errors.New("not an iCalendar file")
+
+// maxLineLength bounds a single unfolded content line while parsing
+const maxLineLength = 1 << 20
+
+// Parse reads the VEVENTs of an iCalendar stream as all-day events. Times are
+// reduced to their date, so an event from 15:00 to 11:00 the next day covers one
+// night, and an event without DTEND lasts one day. Events without a UID or DTSTART
+// are skipped. Recurrence rules are not expanded.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	var components []string
+	var hasEnd, foundCalendar bool
+
+	for _, line := range lines {
+		name, params, value := splitProperty(line)
+
+		switch name {
+		case "BEGIN":
+			components = append(components, strings.ToUpper(value))
+			switch strings.ToUpper(value) {
+			case "VCALENDAR":
+				foundCalendar = true
+			case "VEVENT":
+				current = &Event{}
+				hasEnd = false
+			}
+			continue
+		case "END":
+			if len(components) > 0 {
+				components = components[:len(components)-1]
+			}
+			if strings.ToUpper(value) == "VEVENT" && current != nil {
+				if current.UID != "" && !current.Start.IsZero() {
+					if !hasEnd || !current.End.After(current.Start) {
+						current.End = current.Start.AddDate(0, 0, 1)
+					}
+					events = append(events, *current)
+				}
+				current = nil
+			}
+			continue
+		}
+
+		// properties of alarms and other components nested in the event are ignored
+		if current == nil || len(components) == 0 || components[len(components)-1] != "VEVENT" {
+			continue
+		}
+
+		switch name {
+		case "UID":
+			current.UID = value
+		case "SUMMARY":
+			current.Summary = unescapeText(value)
+		case "DESCRIPTION":
+			current.Description = unescapeText(value)
+		case "URL":
+			current.URL = value
+		case "STATUS":
+			current.Status = strings.ToUpper(value)
+		case "DTSTART":
+			current.Start, err = parseDate(value, params)
+			if err != nil {
+				return nil, err
+			}
+		case "DTEND":
+			current.End, err = parseDate(value, params)
+			if err != nil {
+				return nil, err
+			}
+			hasEnd = true
+		case "CREATED":
+			current.Created, _ = parseDateTime(value, params)
+		case "LAST-MODIFIED":
+			current.LastModified, _ = parseDateTime(value, params)
+		}
+	}
+
+	if !foundCalendar {
+		return nil, ErrNotCalendar
+	}
+
+	return events, nil
+}
+
+// unfold reads the content lines of the stream, joining folded continuation lines
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	var lines []string
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// splitProperty splits a content line into its upper-cased name, its parameters
+// and its value. Colons inside quoted parameter values are not separators.
+func splitProperty(line string) (string, map[string]string, string) {
+	inQuotes := false
+	colon := -1
+
+	for i, c := range line {
+		if c == '"' {
+			inQuotes = !inQuotes
+		} else if c == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+
+	for _, p := range parts[1:] {
+		key, value, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// parseDate returns the calendar date of a DATE or DATE-TIME value, as midnight UTC
+func parseDate(value string, params map[string]string) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		return time.Parse(dateLayout, value)
+	}
+
+	t, err := parseDateTime(value, params)
+	if err != nil {
+		return t, err
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// parseDateTime parses a UTC, TZID or floating DATE-TIME value. Unknown time zones
+// are read as UTC.
+func parseDateTime(value string, params map[string]string) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(dateTimeLayout, value)
+	}
+
+	loc := time.UTC
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	return time.ParseInLocation(strings.TrimSuffix(dateTimeLayout, "Z"), value, loc)
+}
+
+var textUnescaper = strings.NewReplacer(
+	`\\`, `\`,
+	`\;`, ";",
+	`\,`, ",",
+	`\n`, "\n",
+	`\N`, "\n",
+)
+
+// unescapeText reverses the escaping of a TEXT property value
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
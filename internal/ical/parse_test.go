@@ -0,0 +1,125 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const channelFeed = "BEGIN:VCALENDAR\r\n" +
+	"PRODID:-//Channel//Hosting Calendar//EN\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTAMP:20501201T120000Z\r\n" +
+	"DTSTART;VALUE=DATE:20501217\r\n" +
+	"DTEND;VALUE=DATE:20501220\r\n" +
+	"UID:1418fb94e984-a1b2c3@channel.example.com\r\n" +
+	"SUMMARY:Reserved\\, paid\r\n" +
+	"DESCRIPTION:Reservation URL: https://channel.example.com/\r\n" +
+	" reservations/123\\nPhone: 1234\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"DESCRIPTION:Reminder\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;TZID=America/Sao_Paulo:20501222T150000\r\n" +
+	"DTEND;TZID=America/Sao_Paulo:20501223T110000\r\n" +
+	"UID:timed@channel.example.com\r\n" +
+	"SUMMARY:Not available\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20501225\r\n" +
+	"UID:single-day@channel.example.com\r\n" +
+	"STATUS:cancelled\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20501226\r\n" +
+	"SUMMARY:No uid\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(channelFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	day := func(d int) time.Time {
+		return time.Date(2050, 12, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		uid    string
+		start  time.Time
+		end    time.Time
+		status string
+	}{
+		{"1418fb94e984-a1b2c3@channel.example.com", day(17), day(20), ""},
+		{"timed@channel.example.com", day(22), day(23), ""},
+		{"single-day@channel.example.com", day(25), day(26), "CANCELLED"},
+	}
+
+	for i, tt := range tests {
+		e := events[i]
+		if e.UID != tt.uid || !e.Start.Equal(tt.start) || !e.End.Equal(tt.end) || e.Status != tt.status {
+			t.Errorf("event %d: got %s %s-%s %q", i, e.UID, e.Start.Format(dateLayout), e.End.Format(dateLayout), e.Status)
+		}
+	}
+
+	if events[0].Summary != "Reserved, paid" {
+		t.Errorf("unexpected summary %q", events[0].Summary)
+	}
+
+	if events[0].Description != "Reservation URL: https://channel.example.com/reservations/123\nPhone: 1234" {
+		t.Errorf("expected the folded description without the alarm's, got %q", events[0].Description)
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	cal := Calendar{
+		Events: []Event{
+			{
+				UID:          "reservation-1@bookings.example.com",
+				Summary:      strings.Repeat("John Doe; Major's Suite, ", 5),
+				Start:        time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC),
+				End:          time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC),
+				LastModified: time.Date(2050, 1, 2, 15, 4, 5, 0, time.UTC),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, cal); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+
+	e := events[0]
+	if e.UID != cal.Events[0].UID || e.Summary != cal.Events[0].Summary ||
+		!e.Start.Equal(cal.Events[0].Start) || !e.End.Equal(cal.Events[0].End) ||
+		!e.LastModified.Equal(cal.Events[0].LastModified) {
+		t.Errorf("round trip changed the event: %+v", e)
+	}
+}
+
+func TestParseNotCalendar(t *testing.T) {
+	_, err := Parse(strings.NewReader("<html><body>Sign in</body></html>"))
+	if !errors.Is(err, ErrNotCalendar) {
+		t.Errorf("expected ErrNotCalendar, got %v", err)
+	}
+}
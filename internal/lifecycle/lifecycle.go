@@ -0,0 +1,119 @@
+// Package lifecycle holds the statuses a reservation moves through and the
+// transitions allowed between them.
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Status is the state of a reservation. The values match models.Reservation.Status.
+type Status string
+
+const (
+	Pending    Status = "pending"
+	Confirmed  Status = "confirmed"
+	CheckedIn  Status = "checked_in"
+	CheckedOut Status = "checked_out"
+	Cancelled  Status = "cancelled"
+	NoShow     Status = "no_show"
+)
+
+// ErrTransition is returned when a reservation can't move to the asked status
+var ErrTransition = errors.New("invalid status change")
+
+// transitions lists the statuses each status may move to. Checked out,
+// cancelled and no-show reservations are final.
+var transitions = map[Status][]Status{
+	Pending:    {Confirmed, Cancelled, NoShow},
+	Confirmed:  {CheckedIn, Cancelled, NoShow},
+	CheckedIn:  {CheckedOut},
+	CheckedOut: {},
+	Cancelled:  {},
+	NoShow:     {},
+}
+
+// Statuses returns every status in the order a stay goes through them
+func Statuses() []Status {
+	return []Status{Pending, Confirmed, CheckedIn, CheckedOut, Cancelled, NoShow}
+}
+
+// Name returns the display name of the status
+func (s Status) Name() string {
+	switch s {
+	case Pending:
+		return "Pending"
+	case Confirmed:
+		return "Confirmed"
+	case CheckedIn:
+		return "Checked in"
+	case CheckedOut:
+		return "Checked out"
+	case Cancelled:
+		return "Cancelled"
+	case NoShow:
+		return "No-show"
+	default:
+		return "Unknown"
+	}
+}
+
+// Valid reports whether s is a known status
+func (s Status) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// Next returns the statuses s may move to
+func (s Status) Next() []Status {
+	return transitions[s]
+}
+
+// CanTransition reports whether a reservation may move from s to the status
+func (s Status) CanTransition(to Status) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Transition checks the move from s to the status, wrapping ErrTransition when it isn't allowed
+func (s Status) Transition(to Status) error {
+	if !s.CanTransition(to) {
+		return fmt.Errorf("%w from %s to %s", ErrTransition, s, to)
+	}
+
+	return nil
+}
+
+// ReleasesRoom reports whether reservations in the status no longer hold their room
+func (s Status) ReleasesRoom() bool {
+	return s == Cancelled || s == NoShow
+}
+
+// Reschedulable reports whether reservations in the status may still move to other
+// dates or rooms, which is only before the guest arrives
+func (s Status) Reschedulable() bool {
+	return s == Pending || s == Confirmed
+}
+
+// CanReschedule reports whether a reservation in the status arriving on start may
+// still move at now. The stay must not have started, even when the guest hasn't
+// checked in yet.
+func CanReschedule(status string, start, now time.Time) bool {
+	return Status(status).Reschedulable() && now.Before(start)
+}
+
+// Name returns the display name of a stored status
+func Name(status string) string {
+	return Status(status).Name()
+}
+
+// Next returns the statuses a stored status may move to
+func Next(status string) []Status {
+	return Status(status).Next()
+}
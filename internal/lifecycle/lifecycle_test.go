@@ -0,0 +1,107 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     Status
+		to       Status
+		expected bool
+	}{
+		{"Confirm", Pending, Confirmed, true},
+		{"Cancel pending", Pending, Cancelled, true},
+		{"Pending no-show", Pending, NoShow, true},
+		{"Check in pending", Pending, CheckedIn, false},
+		{"Check in", Confirmed, CheckedIn, true},
+		{"Cancel confirmed", Confirmed, Cancelled, true},
+		{"Check out", CheckedIn, CheckedOut, true},
+		{"Cancel checked in", CheckedIn, Cancelled, false},
+		{"Reopen checked out", CheckedOut, CheckedIn, false},
+		{"Reopen cancelled", Cancelled, Pending, false},
+		{"Confirm no-show", NoShow, Confirmed, false},
+		{"Same status", Confirmed, Confirmed, false},
+		{"Unknown status", Status("lost"), Confirmed, false},
+		{"To unknown status", Pending, Status("lost"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.from.CanTransition(tt.to); got != tt.expected {
+				t.Errorf("%s.CanTransition(%s) = %v, want %v", tt.from, tt.to, got, tt.expected)
+			}
+
+			err := tt.from.Transition(tt.to)
+			if tt.expected && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if !tt.expected && !errors.Is(err, ErrTransition) {
+				t.Errorf("expected ErrTransition, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	for _, s := range Statuses() {
+		if !s.Valid() {
+			t.Errorf("status %q is not valid", s)
+		}
+
+		if s.Name() == "Unknown" {
+			t.Errorf("status %q has no name", s)
+		}
+
+		for _, next := range s.Next() {
+			if !next.Valid() {
+				t.Errorf("status %q moves to unknown status %q", s, next)
+			}
+		}
+	}
+
+	if Status("").Valid() {
+		t.Error("expected the empty status to be invalid")
+	}
+}
+
+func TestReleasesRoom(t *testing.T) {
+	for _, s := range Statuses() {
+		expected := s == Cancelled || s == NoShow
+		if got := s.ReleasesRoom(); got != expected {
+			t.Errorf("%s.ReleasesRoom() = %v, want %v", s, got, expected)
+		}
+
+		if s.ReleasesRoom() && s.Reschedulable() {
+			t.Errorf("%s releases its room but can be rescheduled", s)
+		}
+	}
+}
+
+func TestCanReschedule(t *testing.T) {
+	now := time.Date(2050, 12, 17, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		status   Status
+		start    time.Time
+		expected bool
+	}{
+		{"Confirmed, arriving tomorrow", Confirmed, now.AddDate(0, 0, 1), true},
+		{"Pending, arriving tomorrow", Pending, now.AddDate(0, 0, 1), true},
+		{"Confirmed, arriving today", Confirmed, time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC), false},
+		{"Confirmed, started yesterday", Confirmed, now.AddDate(0, 0, -1), false},
+		{"Cancelled, arriving tomorrow", Cancelled, now.AddDate(0, 0, 1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanReschedule(string(tt.status), tt.start, now); got != tt.expected {
+				t.Errorf("CanReschedule(%s, %s) = %v, want %v", tt.status, tt.start, got, tt.expected)
+			}
+		})
+	}
+}
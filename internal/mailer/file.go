@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// File writes every message as an .eml file in a directory instead of sending it
+type File struct {
+	cfg config.MailConfig
+	seq atomic.Int64
+}
+
+// NewFile returns a mailer that drops messages in cfg.DropDir
+func NewFile(cfg config.MailConfig) (*File, error) {
+	if cfg.DropDir == "" {
+		return nil, fmt.Errorf("a drop directory is required for the file mail transport")
+	}
+
+	if err := os.MkdirAll(cfg.DropDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &File{cfg: cfg}, nil
+}
+
+// Send writes msg to a new file in the drop directory
+func (f *File) Send(ctx context.Context, msg models.MailData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	email, err := compose(f.cfg, msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102-150405"), f.seq.Add(1))
+
+	return os.WriteFile(filepath.Join(f.cfg.DropDir, name), []byte(render(email)), 0o644)
+}
@@ -0,0 +1,81 @@
+// Package mailer delivers email messages. The SMTP implementation is used in
+// production, the file and memory implementations in development and tests.
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/toorop/go-dkim"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// Mailer delivers a single email, giving up when ctx is done
+type Mailer interface {
+	Send(ctx context.Context, msg models.MailData) error
+}
+
+// New returns the mailer selected by cfg.Transport
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Transport {
+	case "", "smtp":
+		return NewSMTP(cfg)
+	case "file":
+		return NewFile(cfg)
+	case "memory":
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.Transport)
+	}
+}
+
+// compose builds the MIME message for msg, falling back to the configured sender
+// and signing it when a DKIM key is configured
+func compose(cfg config.MailConfig, msg models.MailData) (*mail.Email, error) {
+	from := msg.From
+	if from == "" {
+		from = cfg.From
+	}
+
+	if from == "" {
+		return nil, fmt.Errorf("no sender for email to %s", msg.To)
+	}
+
+	email := mail.NewMSG()
+	email.SetFrom(from).AddTo(msg.To).SetSubject(msg.Subject)
+
+	if msg.PlainContent == "" {
+		email.SetBody(mail.TextHTML, msg.Content)
+	} else {
+		email.SetBody(mail.TextPlain, msg.PlainContent)
+		email.AddAlternative(mail.TextHTML, msg.Content)
+	}
+
+	if len(cfg.DKIMPrivateKey) > 0 {
+		options := dkim.NewSigOptions()
+		options.PrivateKey = cfg.DKIMPrivateKey
+		options.Domain = cfg.DKIMDomain
+		options.Selector = cfg.DKIMSelector
+		options.Canonicalization = "relaxed/relaxed"
+		options.Headers = []string{"from", "to", "subject", "date", "mime-version", "content-type"}
+
+		email.SetDkim(options)
+	}
+
+	if email.Error != nil {
+		return nil, email.Error
+	}
+
+	return email, nil
+}
+
+// render returns the raw message, including the DKIM signature when there is one
+func render(email *mail.Email) string {
+	if email.DkimMsg != "" {
+		return email.DkimMsg
+	}
+
+	return email.GetMessage()
+}
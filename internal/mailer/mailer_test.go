@@ -0,0 +1,199 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.MailConfig
+		wantErr bool
+	}{
+		{"SMTP", config.MailConfig{Host: "localhost", Port: 1025}, false},
+		{"SMTP STARTTLS", config.MailConfig{Host: "smtp.example.com", Port: 587, Encryption: "starttls"}, false},
+		{"SMTP implicit TLS", config.MailConfig{Transport: "smtp", Host: "smtp.example.com", Port: 465, Encryption: "tls"}, false},
+		{"SMTP without host", config.MailConfig{Port: 25}, true},
+		{"SMTP unknown encryption", config.MailConfig{Host: "localhost", Port: 25, Encryption: "ssl3"}, true},
+		{"SMTP DKIM without selector", config.MailConfig{Host: "localhost", Port: 25, DKIMPrivateKey: []byte("key")}, true},
+		{"File", config.MailConfig{Transport: "file", DropDir: t.TempDir()}, false},
+		{"File without directory", config.MailConfig{Transport: "file"}, true},
+		{"Memory", config.MailConfig{Transport: "memory"}, false},
+		{"Unknown transport", config.MailConfig{Transport: "pigeon"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+
+	if err := m.Send(context.Background(), models.MailData{To: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := m.Messages()
+	if len(msgs) != 1 || msgs[0].To != "a@example.com" {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+
+	m.Reset()
+	if len(m.Messages()) != 0 {
+		t.Error("expected no messages after Reset")
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := NewFile(config.MailConfig{DropDir: dir, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.Send(context.Background(), models.MailData{
+		To:      "guest@example.com",
+		Subject: "Hello",
+		Content: "<p>Hi there</p>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one message in the drop directory, got %d", len(files))
+	}
+
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"From: <noreply@example.com>", "To: <guest@example.com>", "Subject: Hello", "Hi there"} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("expected message to contain %q:\n%s", want, raw)
+		}
+	}
+}
+
+func TestComposeDKIM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	cfg := config.MailConfig{
+		From:           "noreply@example.com",
+		DKIMPrivateKey: pemKey,
+		DKIMDomain:     "example.com",
+		DKIMSelector:   "mail",
+	}
+
+	email, err := compose(cfg, models.MailData{To: "guest@example.com", Subject: "Signed", Content: "body"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := render(email); !strings.Contains(msg, "DKIM-Signature:") || !strings.Contains(msg, "d=example.com") {
+		t.Errorf("expected a DKIM signature for example.com:\n%s", msg)
+	}
+}
+
+func TestComposeRequiresSender(t *testing.T) {
+	if _, err := compose(config.MailConfig{}, models.MailData{To: "guest@example.com"}); err == nil {
+		t.Error("expected an error without a sender")
+	}
+}
+
+func TestComposePlainTextAlternative(t *testing.T) {
+	cfg := config.MailConfig{From: "noreply@example.com"}
+
+	email, err := compose(cfg, models.MailData{
+		To:           "guest@example.com",
+		Subject:      "Hello",
+		Content:      "<p>Hi there</p>",
+		PlainContent: "Hi there",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := render(email)
+	for _, want := range []string{"multipart/alternative", "Content-Type: text/plain", "Content-Type: text/html"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected message to contain %q:\n%s", want, msg)
+		}
+	}
+
+	if strings.Index(msg, "text/plain") > strings.Index(msg, "text/html") {
+		t.Error("expected the text/plain part before the preferred text/html part")
+	}
+}
+
+func TestSMTP_SendStopsWithContext(t *testing.T) {
+	// a server that accepts connections but never greets the client
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	s, err := NewSMTP(config.MailConfig{Host: "127.0.0.1", Port: addr.Port, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Send(ctx, models.MailData{To: "guest@example.com", Subject: "Hello", Content: "Hi"})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected an error from a server that never answers")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Send did not return once the context was done")
+	}
+}
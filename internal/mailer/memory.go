@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// Memory keeps sent messages in memory so tests can inspect them
+type Memory struct {
+	mu       sync.Mutex
+	messages []models.MailData
+}
+
+// NewMemory returns an empty in-memory mailer
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Send records msg
+func (m *Memory) Send(_ context.Context, msg models.MailData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of the recorded messages
+func (m *Memory) Messages() []models.MailData {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.MailData(nil), m.messages...)
+}
+
+// Reset forgets the recorded messages
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+}
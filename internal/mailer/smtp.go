@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/models"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// SMTP delivers mail through an SMTP server
+type SMTP struct {
+	cfg        config.MailConfig
+	encryption mail.Encryption
+}
+
+// NewSMTP validates cfg and returns an SMTP mailer
+func NewSMTP(cfg config.MailConfig) (*SMTP, error) {
+	if cfg.Host == "" || cfg.Port == 0 {
+		return nil, fmt.Errorf("smtp host and port are required")
+	}
+
+	var encryption mail.Encryption
+
+	switch cfg.Encryption {
+	case "", "none":
+		encryption = mail.EncryptionNone
+	case "starttls":
+		encryption = mail.EncryptionSTARTTLS
+	case "tls":
+		encryption = mail.EncryptionSSLTLS
+	default:
+		return nil, fmt.Errorf("unknown smtp encryption %q", cfg.Encryption)
+	}
+
+	if len(cfg.DKIMPrivateKey) > 0 && (cfg.DKIMDomain == "" || cfg.DKIMSelector == "") {
+		return nil, fmt.Errorf("dkim domain and selector are required when a dkim key is set")
+	}
+
+	return &SMTP{cfg: cfg, encryption: encryption}, nil
+}
+
+// smtpTimeout bounds a whole delivery, from dialling the server to the end of the message
+const smtpTimeout = 30 * time.Second
+
+// Send connects to the server and delivers msg. The connection is closed as soon as
+// ctx is done so a stalled server can't hold up shutdown.
+func (s *SMTP) Send(ctx context.Context, msg models.MailData) error {
+	email, err := compose(s.cfg, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	// the deadline on the connection replaces the client timeouts, which leave the
+	// connection open when they expire
+	server := mail.NewSMTPClient()
+	server.Host = s.cfg.Host
+	server.Port = s.cfg.Port
+	server.Encryption = s.encryption
+	server.KeepAlive = false
+	server.CustomConn = conn
+	server.ConnectTimeout = 0
+	server.SendTimeout = 0
+
+	if s.cfg.Username != "" {
+		server.Username = s.cfg.Username
+		server.Password = s.cfg.Password
+		server.Authentication = mail.AuthAuto
+	} else {
+		server.Authentication = mail.AuthNone
+	}
+
+	client, err := server.Connect()
+	if err != nil {
+		return err
+	}
+
+	return email.Send(client)
+}
+
+// dial opens the connection to the server, negotiating TLS straight away when the
+// server expects it. STARTTLS is left to the client.
+func (s *SMTP) dial(ctx context.Context) (net.Conn, error) {
+	address := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+
+	if s.encryption == mail.EncryptionSSLTLS {
+		dialer := tls.Dialer{Config: &tls.Config{ServerName: s.cfg.Host}}
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", address)
+}
@@ -16,14 +16,57 @@ type User struct {
 	UpdatedAt   time.Time
 }
 
+// APIToken is a personal token a user can send as a bearer token instead of a session cookie.
+// Only the SHA-256 hash of the token is stored.
+type APIToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	TokenHash  string
+	LastUsedAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// CalendarFeed is a secret iCalendar feed URL of the reservations and blocks of one
+// room, or of every room when RoomID is 0. Only the SHA-256 hash of the secret is stored.
+type CalendarFeed struct {
+	ID         int
+	RoomID     int
+	Name       string
+	TokenHash  string
+	LastUsedAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Room       Room
+}
+
 // Room create struct for handling room data
 type Room struct {
 	ID              int
 	RoomName        string
 	RoomDescription string
 	RoomURL         string
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	// Capacity is the maximum number of guests the room sleeps
+	Capacity int
+	// Active is 0 for rooms taken out of service; they are hidden from guests
+	Active int
+	// CoverPhoto is the name of the room's cover photo, empty when it has no photos
+	CoverPhoto string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// RoomPhoto is an uploaded room photo. FileName identifies the stored
+// thumbnail and display versions.
+type RoomPhoto struct {
+	ID        int
+	RoomID    int
+	FileName  string
+	SortOrder int
+	IsCover   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // Restriction create struct for handling restriction data
@@ -47,9 +90,103 @@ type Reservation struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Room      Room
-	Processed int
+	Total     int
+	// Status is one of the lifecycle statuses; each change to it is timestamped
+	// below, with zero times for the statuses the reservation never reached
+	Status       string
+	ConfirmedAt  time.Time
+	CheckedInAt  time.Time
+	CheckedOutAt time.Time
+	CancelledAt  time.Time
+	NoShowAt     time.Time
+	// GroupID is the group of a reservation booked with other rooms in one checkout, 0 otherwise
+	GroupID int
+	// Adults and Children are the size of the party, which must fit the room's Capacity
+	Adults   int
+	Children int
 }
 
+// Guests returns how many people stay in the room
+func (r Reservation) Guests() int {
+	return r.Adults + r.Children
+}
+
+// ReservationGroup ties together the reservations of several rooms booked in one
+// checkout. Total is the sum of their totals.
+type ReservationGroup struct {
+	ID           int
+	Total        int
+	Reservations []Reservation
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Cart holds the stays a guest has picked but not booked yet. Each item is a
+// reservation with only its room, dates, guests and total set.
+type Cart struct {
+	Items []Reservation
+	// Adults and Children are the party of the last search, which the rooms of each
+	// stay must sleep between them
+	Adults   int
+	Children int
+}
+
+// Total returns the sum of the totals of the items
+func (c Cart) Total() int {
+	total := 0
+	for _, item := range c.Items {
+		total += item.Total
+	}
+
+	return total
+}
+
+// ReservationFilter selects reservations for the admin lists and exports. Zero
+// values don't filter.
+type ReservationFilter struct {
+	// Start and End keep the reservations whose stay overlaps the dates
+	Start  time.Time
+	End    time.Time
+	RoomID int
+	// Status is one of the lifecycle statuses, or empty for all of them
+	Status string
+	// Search matches the guest's name, email or phone, or the reservation id
+	Search string
+}
+
+// DefaultPageSize is the number of rows of a list page when none is asked for
+const DefaultPageSize = 25
+
+// ReservationSorts are the columns reservation lists can be sorted by
+var ReservationSorts = []string{"id", "name", "room", "start_date", "end_date", "created_at"}
+
+// ReservationQuery asks for one page of the reservations matching a filter
+type ReservationQuery struct {
+	ReservationFilter
+	// Page starts at 1
+	Page     int
+	PageSize int
+	// Sort is one of ReservationSorts; Desc reverses it
+	Sort string
+	Desc bool
+}
+
+// ReservationPage is one page of reservations and how many match in total
+type ReservationPage struct {
+	Reservations []Reservation
+	Total        int
+	Page         int
+	PageSize     int
+}
+
+// Restriction types, matching the seeded restrictions table
+const (
+	RestrictionReservation = 1
+	RestrictionOwnerBlock  = 2
+	// RestrictionExternal marks bookings imported from another site's calendar
+	RestrictionExternal = 3
+)
+
 // RoomRestriction create struct for handling room restriction data
 type RoomRestriction struct {
 	ID            int
@@ -58,22 +195,189 @@ type RoomRestriction struct {
 	RoomID        int
 	ReservationID int
 	RestrictionID int
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Room          Room
-	Reservation   Reservation
-	Restriction   Restriction
+	// Reason explains why an owner block closes the room
+	Reason string
+	// CalendarImportID and UID identify the event an external restriction was imported from
+	CalendarImportID int
+	UID              string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Room             Room
+	Reservation      Reservation
+	Restriction      Restriction
+}
+
+// CalendarImport is another booking site's iCalendar feed of a room. Its events
+// are kept in sync as External room restrictions. Imports without a URL are only
+// updated from uploaded files.
+type CalendarImport struct {
+	ID           int
+	RoomID       int
+	Name         string
+	URL          string
+	LastSyncedAt time.Time
+	// LastError is why the last sync failed, empty when it succeeded
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CalendarSyncResult counts what a calendar import sync changed. Conflicts is the
+// number of upcoming imported events overlapping reservations or other blocks.
+type CalendarSyncResult struct {
+	Added     int
+	Updated   int
+	Removed   int
+	Unchanged int
+	Conflicts int
+}
+
+// RoomRate holds the default nightly prices of a room, in cents
+type RoomRate struct {
+	ID          int
+	RoomID      int
+	BaseRate    int
+	WeekendRate int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SeasonalRate overrides the nightly prices of a room between two dates (inclusive), in cents
+type SeasonalRate struct {
+	ID          int
+	RoomID      int
+	SeasonName  string
+	StartDate   time.Time
+	EndDate     time.Time
+	BaseRate    int
+	WeekendRate int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// StayRule limits the stays guests can book in a room. A room has at most one
+// default rule, without dates; seasonal rules apply instead to arrivals between
+// their start and end dates (inclusive). Zero limits are not enforced.
+type StayRule struct {
+	ID         int
+	RoomID     int
+	SeasonName string
+	StartDate  time.Time
+	EndDate    time.Time
+	MinNights  int
+	MaxNights  int
+	// ClosedToArrival and ClosedToDeparture are weekday bitmasks, 1<<time.Weekday per closed day
+	ClosedToArrival   int
+	ClosedToDeparture int
+	// LeadDays is how many days before arrival a stay must be booked at the latest
+	LeadDays int
+	// HorizonDays is how many days ahead of arrival a stay can be booked at the earliest
+	HorizonDays int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// StayRuleViolation explains which stay rule keeps a room from being booked
+type StayRuleViolation struct {
+	RoomID   int    `json:"roomId"`
+	RoomName string `json:"roomName,omitempty"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// NightlyPrice holds the price of a single night of a stay
+type NightlyPrice struct {
+	Date    time.Time `json:"date"`
+	Rate    int       `json:"rate"`
+	Weekend bool      `json:"weekend"`
+	Season  string    `json:"season,omitempty"`
+}
+
+// Quote holds the price breakdown of a stay
+type Quote struct {
+	RoomID    int            `json:"roomId"`
+	StartDate time.Time      `json:"startDate"`
+	EndDate   time.Time      `json:"endDate"`
+	Nights    []NightlyPrice `json:"nights"`
+	Total     int            `json:"total"`
+}
+
+// Report holds occupancy and revenue figures for a date range, in total, per room
+// and per calendar month. Nights are counted inside the range only.
+type Report struct {
+	StartDate time.Time     `json:"startDate"`
+	EndDate   time.Time     `json:"endDate"`
+	RoomID    int           `json:"roomId,omitempty"`
+	Totals    ReportFigures `json:"totals"`
+	Rooms     []RoomReport  `json:"rooms"`
+	Months    []MonthReport `json:"months"`
+}
+
+// ReportFigures are the figures of a report row. Amounts are in cents.
+type ReportFigures struct {
+	// AvailableNights is the number of room nights open for sale, owner blocks excluded
+	AvailableNights int `json:"availableNights"`
+	NightsSold      int `json:"nightsSold"`
+	// ExternalNights are nights sold on other sites and imported from their calendars
+	ExternalNights int `json:"externalNights"`
+	BlockedNights  int `json:"blockedNights"`
+	// Occupancy is the share of available nights sold here or elsewhere, from 0 to 1
+	Occupancy float64 `json:"occupancy"`
+	// Arrivals, AverageStay and AverageLeadDays describe the reservations arriving in the period
+	Arrivals        int     `json:"arrivals"`
+	AverageStay     float64 `json:"averageLengthOfStay"`
+	AverageLeadDays float64 `json:"averageLeadTimeDays"`
+	Revenue         int     `json:"revenue"`
+	// ADR is the average daily rate, the revenue per night sold with a price
+	ADR int `json:"adr"`
+}
+
+// RoomReport holds the report figures of one room
+type RoomReport struct {
+	RoomID   int    `json:"roomId"`
+	RoomName string `json:"roomName"`
+	ReportFigures
+}
+
+// MonthReport holds the report figures of one calendar month
+type MonthReport struct {
+	Month time.Time `json:"month"`
+	ReportFigures
 }
 
 // MailData holds an email message
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Content  string
+	To      string
+	From    string
+	Subject string
+	// Content is the HTML body
+	Content string
+	// PlainContent is the text/plain alternative, left out of the message when empty
+	PlainContent string
+	// Template is the name of the email template the message was rendered from
 	Template string
 }
 
+// Outbox message states
+const (
+	OutboxQueued = "queued"
+	OutboxSent   = "sent"
+	OutboxFailed = "failed"
+)
+
+// OutboxMessage is an email waiting in, or delivered from, the mail outbox
+type OutboxMessage struct {
+	ID            int
+	Mail          MailData
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	SentAt        time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
 type CalendarResponse struct {
 	ID            string         `json:"id"`
 	Title         string         `json:"title"`
@@ -83,5 +387,6 @@ type CalendarResponse struct {
 	Url           string         `json:"url"`
 	LastUpdated   time.Time      `json:"lastUpdated"`
 	Editable      bool           `json:"editable"`
+	Color         string         `json:"color,omitempty"`
 	ExtendedProps map[string]any `json:"extendedProps"`
 }
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// PageSizes are the page sizes the admin lists offer
+var PageSizes = []int{10, 25, 50, 100}
+
+// listDateLayout is how dates are written in list query strings
+const listDateLayout = "2006-01-02"
+
+// ReservationList is a page of an admin reservation list along with what the template
+// needs to link to other pages and sorts with the same filters
+type ReservationList struct {
+	Path   string
+	Query  ReservationQuery
+	Result ReservationPage
+	Rooms  []Room
+	// StatusFilter is false on lists showing only one status
+	StatusFilter bool
+}
+
+// values returns the query parameters of the list, without the page
+func (l ReservationList) values() url.Values {
+	v := url.Values{}
+	f := l.Query.ReservationFilter
+
+	if f.Search != "" {
+		v.Set("q", f.Search)
+	}
+	if f.RoomID != 0 {
+		v.Set("room_id", strconv.Itoa(f.RoomID))
+	}
+	if !f.Start.IsZero() {
+		v.Set("start", f.Start.Format(listDateLayout))
+	}
+	if !f.End.IsZero() {
+		v.Set("end", f.End.Format(listDateLayout))
+	}
+	if l.StatusFilter && f.Status != "" {
+		v.Set("status", f.Status)
+	}
+	if l.Query.PageSize != DefaultPageSize {
+		v.Set("size", strconv.Itoa(l.Query.PageSize))
+	}
+
+	v.Set("sort", l.Query.Sort)
+	v.Set("dir", "asc")
+	if l.Query.Desc {
+		v.Set("dir", "desc")
+	}
+
+	return v
+}
+
+// Get returns a query parameter of the list, to fill in the filter form
+func (l ReservationList) Get(key string) string {
+	return l.values().Get(key)
+}
+
+// Filters returns the filter parameters of the list, to carry them into other forms
+func (l ReservationList) Filters() url.Values {
+	v := l.values()
+	v.Del("size")
+	v.Del("sort")
+	v.Del("dir")
+
+	if !l.StatusFilter && l.Query.Status != "" {
+		v.Set("status", l.Query.Status)
+	}
+
+	return v
+}
+
+// PageURL links to page n of the list
+func (l ReservationList) PageURL(n int) string {
+	v := l.values()
+	if n > 1 {
+		v.Set("page", strconv.Itoa(n))
+	}
+
+	return l.Path + "?" + v.Encode()
+}
+
+// SortURL links to the first page sorted by key, reversing the direction when the
+// list is already sorted by it
+func (l ReservationList) SortURL(key string) string {
+	v := l.values()
+	v.Set("sort", key)
+	v.Set("dir", "asc")
+	if key == l.Query.Sort && !l.Query.Desc {
+		v.Set("dir", "desc")
+	}
+
+	return l.Path + "?" + v.Encode()
+}
+
+// SortIcon returns the Font Awesome icon showing how the list is sorted by key
+func (l ReservationList) SortIcon(key string) string {
+	switch {
+	case key != l.Query.Sort:
+		return "fa-sort"
+	case l.Query.Desc:
+		return "fa-sort-down"
+	default:
+		return "fa-sort-up"
+	}
+}
+
+// Pages returns the number of pages
+func (l ReservationList) Pages() int {
+	return max((l.Result.Total+l.Result.PageSize-1)/l.Result.PageSize, 1)
+}
+
+// PageNumbers returns the pages linked around the current one
+func (l ReservationList) PageNumbers() []int {
+	var pages []int
+	for n := max(l.Result.Page-2, 1); n <= min(l.Result.Page+2, l.Pages()); n++ {
+		pages = append(pages, n)
+	}
+
+	return pages
+}
+
+// PrevPage and NextPage return the pages before and after the current one, staying
+// within the list
+func (l ReservationList) PrevPage() int {
+	return max(l.Result.Page-1, 1)
+}
+
+func (l ReservationList) NextPage() int {
+	return min(l.Result.Page+1, l.Pages())
+}
+
+// First and Last return the positions of the first and last rows of the page
+func (l ReservationList) First() int {
+	if len(l.Result.Reservations) == 0 {
+		return 0
+	}
+	return (l.Result.Page-1)*l.Result.PageSize + 1
+}
+
+func (l ReservationList) Last() int {
+	return (l.Result.Page-1)*l.Result.PageSize + len(l.Result.Reservations)
+}
+
+// PageSizes returns the page sizes to choose from
+func (l ReservationList) PageSizes() []int {
+	return PageSizes
+}
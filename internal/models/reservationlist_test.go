@@ -0,0 +1,54 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReservationList(t *testing.T) {
+	list := ReservationList{
+		Path: "/admin/reservations/all",
+		Query: ReservationQuery{
+			ReservationFilter: ReservationFilter{
+				Start:  time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+				RoomID: 2,
+				Search: "doe & co",
+			},
+			Page:     4,
+			PageSize: 10,
+			Sort:     "name",
+		},
+		Result: ReservationPage{
+			Reservations: make([]Reservation, 10),
+			Total:        95,
+			Page:         4,
+			PageSize:     10,
+		},
+		StatusFilter: true,
+	}
+
+	if got := list.PageURL(5); got != "/admin/reservations/all?dir=asc&page=5&q=doe+%26+co&room_id=2&size=10&sort=name&start=2050-01-01" {
+		t.Errorf("unexpected page URL %s", got)
+	}
+
+	if got := list.SortURL("name"); got != "/admin/reservations/all?dir=desc&q=doe+%26+co&room_id=2&size=10&sort=name&start=2050-01-01" {
+		t.Errorf("expected sorting by the same column to reverse it, got %s", got)
+	}
+
+	if list.SortIcon("name") != "fa-sort-up" || list.SortIcon("id") != "fa-sort" {
+		t.Error("unexpected sort icons")
+	}
+
+	if list.Pages() != 10 || list.First() != 31 || list.Last() != 40 || list.PrevPage() != 3 || list.NextPage() != 5 {
+		t.Errorf("unexpected paging %d %d %d", list.Pages(), list.First(), list.Last())
+	}
+
+	if got := list.PageNumbers(); !reflect.DeepEqual(got, []int{2, 3, 4, 5, 6}) {
+		t.Errorf("unexpected page numbers %v", got)
+	}
+
+	if got := list.Filters().Encode(); got != "q=doe+%26+co&room_id=2&start=2050-01-01" {
+		t.Errorf("unexpected filters %s", got)
+	}
+}
@@ -14,4 +14,7 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	AccessLevel     int
+	// CartItems is the number of rooms in the guest's cart
+	CartItems int
 }
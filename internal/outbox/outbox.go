@@ -0,0 +1,241 @@
+// Package outbox delivers emails that handlers queue in the database. A
+// background worker retries failed deliveries with exponential backoff and
+// gives up on a message after a maximum number of attempts.
+package outbox
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// Store is the part of the database repository the outbox needs
+type Store interface {
+	EnqueueMail(msg models.MailData) (int, error)
+	DueOutboxMessages(now time.Time, limit int) ([]models.OutboxMessage, error)
+	UpdateOutboxMessage(msg models.OutboxMessage) error
+}
+
+// SendFunc delivers a single email, giving up when ctx is done
+type SendFunc func(ctx context.Context, msg models.MailData) error
+
+// Options tunes the worker. Zero values fall back to the defaults below.
+type Options struct {
+	// PollInterval is how often the worker looks for due messages when it is not woken up
+	PollInterval time.Duration
+	// BaseDelay is the wait before the first retry, doubled on every following attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between retries
+	MaxDelay time.Duration
+	// MaxAttempts is the number of failed deliveries after which a message is marked failed
+	MaxAttempts int
+	// BatchSize is how many due messages are loaded at once
+	BatchSize int
+	// DrainTimeout bounds how long the worker keeps sending after shutdown was requested
+	DrainTimeout time.Duration
+	ErrorLog     *log.Logger
+	InfoLog      *log.Logger
+}
+
+const (
+	defaultPollInterval = 30 * time.Second
+	defaultBaseDelay    = time.Minute
+	defaultMaxDelay     = 6 * time.Hour
+	defaultMaxAttempts  = 8
+	defaultBatchSize    = 20
+	defaultDrainTimeout = 15 * time.Second
+)
+
+// Outbox queues emails and runs the delivery worker
+type Outbox struct {
+	store Store
+	send  SendFunc
+	opts  Options
+	now   func() time.Time
+	wake  chan struct{}
+
+	// mu serialises delivery passes so a message is never sent twice concurrently
+	mu sync.Mutex
+}
+
+// New creates an outbox backed by store that delivers messages with send
+func New(store Store, send SendFunc, opts Options) *Outbox {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = defaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = defaultDrainTimeout
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = log.Default()
+	}
+	if opts.InfoLog == nil {
+		opts.InfoLog = log.Default()
+	}
+
+	return &Outbox{
+		store: store,
+		send:  send,
+		opts:  opts,
+		now:   time.Now,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Enqueue stores msg for delivery and wakes the worker. It never blocks on the mail server.
+func (o *Outbox) Enqueue(msg models.MailData) error {
+	if _, err := o.store.EnqueueMail(msg); err != nil {
+		return err
+	}
+
+	o.Notify()
+	return nil
+}
+
+// Notify wakes the worker so it delivers due messages without waiting for the next poll
+func (o *Outbox) Notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due messages until ctx is cancelled, then drains what is still due
+// for up to DrainTimeout before returning.
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.opts.PollInterval)
+	defer ticker.Stop()
+
+	o.Process(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			o.drain()
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+
+		o.Process(ctx)
+	}
+}
+
+// drain keeps sending due messages after shutdown was requested until none are left
+// or the drain timeout expires
+func (o *Outbox) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), o.opts.DrainTimeout)
+	defer cancel()
+
+	o.opts.InfoLog.Println("Draining mail outbox")
+	o.Process(ctx)
+}
+
+// Process delivers due messages in batches until none are left or ctx is done.
+// It returns the number of messages sent.
+func (o *Outbox) Process(ctx context.Context) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	sent := 0
+
+	for ctx.Err() == nil {
+		messages, err := o.store.DueOutboxMessages(o.now(), o.opts.BatchSize)
+		if err != nil {
+			o.opts.ErrorLog.Println("loading outbox:", err)
+			return sent
+		}
+
+		if len(messages) == 0 {
+			return sent
+		}
+
+		for _, msg := range messages {
+			if ctx.Err() != nil {
+				return sent
+			}
+
+			ok, err := o.deliver(ctx, msg)
+			if err != nil {
+				// without the update the message would be picked up again straight away
+				o.opts.ErrorLog.Println("updating outbox:", err)
+				return sent
+			}
+
+			if ok {
+				sent++
+			}
+		}
+
+		if len(messages) < o.opts.BatchSize {
+			return sent
+		}
+	}
+
+	return sent
+}
+
+// deliver attempts to send one message and records the outcome. Messages that keep
+// failing are retried later or, after MaxAttempts, marked failed. The error is only
+// set when the outcome could not be saved. A send cut short by ctx is not counted
+// as an attempt and stays due, so the drain on shutdown picks it up again.
+func (o *Outbox) deliver(ctx context.Context, msg models.OutboxMessage) (bool, error) {
+	err := o.send(ctx, msg.Mail)
+	if err != nil && ctx.Err() != nil {
+		return false, nil
+	}
+
+	now := o.now()
+
+	msg.Attempts++
+
+	if err == nil {
+		msg.Status = models.OutboxSent
+		msg.SentAt = now
+		msg.LastError = ""
+	} else {
+		msg.LastError = err.Error()
+
+		if msg.Attempts >= o.opts.MaxAttempts {
+			msg.Status = models.OutboxFailed
+			o.opts.ErrorLog.Printf("giving up on email %d to %s after %d attempts: %v", msg.ID, msg.Mail.To, msg.Attempts, err)
+		} else {
+			msg.NextAttemptAt = now.Add(o.Backoff(msg.Attempts))
+			o.opts.ErrorLog.Printf("email %d to %s failed, retrying at %s: %v", msg.ID, msg.Mail.To, msg.NextAttemptAt.Format(time.RFC3339), err)
+		}
+	}
+
+	if uerr := o.store.UpdateOutboxMessage(msg); uerr != nil {
+		return false, uerr
+	}
+
+	return err == nil, nil
+}
+
+// Backoff returns the wait before the next attempt after the given number of failures
+func (o *Outbox) Backoff(attempts int) time.Duration {
+	delay := o.opts.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= o.opts.MaxDelay {
+			return o.opts.MaxDelay
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,281 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// memoryStore is an in-memory Store
+type memoryStore struct {
+	mu       sync.Mutex
+	messages map[int]models.OutboxMessage
+	nextID   int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{messages: map[int]models.OutboxMessage{}}
+}
+
+func (s *memoryStore) EnqueueMail(msg models.MailData) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	s.messages[s.nextID] = models.OutboxMessage{
+		ID:     s.nextID,
+		Mail:   msg,
+		Status: models.OutboxQueued,
+	}
+
+	return s.nextID, nil
+}
+
+func (s *memoryStore) DueOutboxMessages(now time.Time, limit int) ([]models.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []models.OutboxMessage
+	for id := 1; id <= s.nextID && len(due) < limit; id++ {
+		msg, ok := s.messages[id]
+		if ok && msg.Status == models.OutboxQueued && !msg.NextAttemptAt.After(now) {
+			due = append(due, msg)
+		}
+	}
+
+	return due, nil
+}
+
+func (s *memoryStore) UpdateOutboxMessage(msg models.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages[msg.ID] = msg
+	return nil
+}
+
+func (s *memoryStore) get(id int) models.OutboxMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.messages[id]
+}
+
+func testOptions() Options {
+	discard := log.New(io.Discard, "", 0)
+
+	return Options{
+		BaseDelay:   time.Minute,
+		MaxDelay:    10 * time.Minute,
+		MaxAttempts: 3,
+		BatchSize:   2,
+		ErrorLog:    discard,
+		InfoLog:     discard,
+	}
+}
+
+func TestOutbox_ProcessSends(t *testing.T) {
+	store := newMemoryStore()
+
+	var sent []string
+	o := New(store, func(_ context.Context, msg models.MailData) error {
+		sent = append(sent, msg.To)
+		return nil
+	}, testOptions())
+
+	for _, to := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if err := o.Enqueue(models.MailData{To: to}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := o.Process(context.Background()); n != 3 {
+		t.Fatalf("expected 3 messages sent across batches, got %d", n)
+	}
+
+	if len(sent) != 3 {
+		t.Errorf("expected 3 deliveries, got %v", sent)
+	}
+
+	msg := store.get(1)
+	if msg.Status != models.OutboxSent || msg.Attempts != 1 || msg.SentAt.IsZero() {
+		t.Errorf("unexpected message state: %+v", msg)
+	}
+
+	if n := o.Process(context.Background()); n != 0 {
+		t.Errorf("expected nothing left to send, got %d", n)
+	}
+}
+
+func TestOutbox_RetriesWithBackoffThenFails(t *testing.T) {
+	store := newMemoryStore()
+
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	o := New(store, func(_ context.Context, msg models.MailData) error {
+		return errors.New("connection refused")
+	}, testOptions())
+	o.now = func() time.Time { return now }
+
+	if err := o.Enqueue(models.MailData{To: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Process(context.Background())
+
+	msg := store.get(1)
+	if msg.Status != models.OutboxQueued || msg.Attempts != 1 || msg.LastError != "connection refused" {
+		t.Fatalf("unexpected state after first failure: %+v", msg)
+	}
+
+	if !msg.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected retry after one minute, got %s", msg.NextAttemptAt)
+	}
+
+	// not due yet
+	o.Process(context.Background())
+	if store.get(1).Attempts != 1 {
+		t.Error("expected the message to wait for its backoff")
+	}
+
+	now = now.Add(time.Minute)
+	o.Process(context.Background())
+
+	msg = store.get(1)
+	if msg.Attempts != 2 || !msg.NextAttemptAt.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("expected a doubled backoff, got %+v", msg)
+	}
+
+	now = now.Add(2 * time.Minute)
+	o.Process(context.Background())
+
+	msg = store.get(1)
+	if msg.Status != models.OutboxFailed || msg.Attempts != 3 {
+		t.Errorf("expected the message to be marked failed after 3 attempts, got %+v", msg)
+	}
+}
+
+func TestOutbox_Backoff(t *testing.T) {
+	o := New(newMemoryStore(), nil, testOptions())
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := o.Backoff(tt.attempts); got != tt.expected {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.expected)
+		}
+	}
+}
+
+func TestOutbox_RunDrainsOnShutdown(t *testing.T) {
+	store := newMemoryStore()
+
+	opts := testOptions()
+	opts.PollInterval = time.Hour
+
+	delivered := make(chan string, 10)
+	o := New(store, func(_ context.Context, msg models.MailData) error {
+		delivered <- msg.To
+		return nil
+	}, opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+
+	if err := o.Enqueue(models.MailData{To: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("expected Enqueue to wake the worker")
+	}
+
+	// queued straight into the store so only the drain can pick it up
+	if _, err := store.EnqueueMail(models.MailData{To: "b@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop")
+	}
+
+	if store.get(2).Status != models.OutboxSent {
+		t.Errorf("expected the queued message to be drained on shutdown, got %+v", store.get(2))
+	}
+}
+
+func TestOutbox_RunCancelsBlockedSend(t *testing.T) {
+	store := newMemoryStore()
+
+	opts := testOptions()
+	opts.PollInterval = time.Hour
+
+	var mu sync.Mutex
+	calls := 0
+	started := make(chan struct{}, 1)
+
+	// the first send hangs like an unresponsive mail server until its context is done
+	o := New(store, func(ctx context.Context, msg models.MailData) error {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+
+		if !first {
+			return nil
+		}
+
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}, opts)
+
+	if _, err := store.EnqueueMail(models.MailData{To: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop while a send was blocked")
+	}
+
+	msg := store.get(1)
+	if msg.Status != models.OutboxSent || msg.Attempts != 1 {
+		t.Errorf("expected the interrupted message to be sent by the drain, got %+v", msg)
+	}
+}
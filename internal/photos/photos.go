@@ -0,0 +1,254 @@
+// Package photos stores uploaded room photos on the local filesystem. Every
+// upload is validated, decoded and saved as a thumbnail and a display sized
+// JPEG; the original file is not kept.
+package photos
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Sizes of the stored versions of a photo
+const (
+	Thumbnail = "thumb"
+	Display   = "display"
+)
+
+// Options tunes the store. Zero values fall back to the defaults below.
+type Options struct {
+	// MaxFileSize is the largest upload accepted, in bytes
+	MaxFileSize int64
+	// MaxPixels bounds the decoded image size to keep memory use predictable
+	MaxPixels int
+	// Quality is the JPEG quality of the stored files
+	Quality int
+}
+
+const (
+	defaultMaxFileSize = 10 << 20
+	defaultMaxPixels   = 40_000_000
+	defaultQuality     = 85
+)
+
+// bounds is the box each version is scaled to fit in. Images are never enlarged.
+var bounds = map[string]image.Point{
+	Thumbnail: {X: 480, Y: 360},
+	Display:   {X: 1600, Y: 1200},
+}
+
+// allowedTypes are the content types accepted for uploads
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+var (
+	// ErrTooLarge is returned for uploads over MaxFileSize or MaxPixels
+	ErrTooLarge = errors.New("photo is too large")
+	// ErrUnsupportedType is returned for files that are not JPEG, PNG or GIF images
+	ErrUnsupportedType = errors.New("photo must be a JPEG, PNG or GIF image")
+)
+
+// nameRe matches the names generated by Save
+var nameRe = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Store saves photos under a directory
+type Store struct {
+	dir  string
+	opts Options
+}
+
+// New creates a store writing to dir, creating it when needed
+func New(dir string, opts Options) (*Store, error) {
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = defaultMaxFileSize
+	}
+	if opts.MaxPixels <= 0 {
+		opts.MaxPixels = defaultMaxPixels
+	}
+	if opts.Quality <= 0 {
+		opts.Quality = defaultQuality
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Store{dir: dir, opts: opts}, nil
+}
+
+// Dir returns the directory the photos are written to
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// MaxFileSize returns the largest upload accepted, in bytes
+func (s *Store) MaxFileSize() int64 {
+	return s.opts.MaxFileSize
+}
+
+// FileName returns the file name of one size of a stored photo
+func FileName(name, size string) string {
+	return fmt.Sprintf("%s-%s.jpg", name, size)
+}
+
+// Save validates the image read from r and writes its thumbnail and display
+// versions. It returns the name identifying the photo, prefixed with prefix.
+func (s *Store) Save(prefix string, r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, s.opts.MaxFileSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if int64(len(data)) > s.opts.MaxFileSize {
+		return "", ErrTooLarge
+	}
+
+	if !allowedTypes[http.DetectContentType(data)] {
+		return "", ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupportedType
+	}
+
+	if cfg.Width*cfg.Height > s.opts.MaxPixels {
+		return "", ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupportedType
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	name := prefix + "-" + hex.EncodeToString(suffix)
+
+	src := toRGBA(img)
+
+	for _, size := range []string{Thumbnail, Display} {
+		err := s.write(FileName(name, size), Fit(src, bounds[size]))
+		if err != nil {
+			s.Remove(name)
+			return "", err
+		}
+	}
+
+	return name, nil
+}
+
+// write encodes img as a JPEG, writing to a temporary file first so a partial
+// file is never served
+func (s *Store) write(fileName string, img image.Image) error {
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := jpeg.Encode(tmp, img, &jpeg.Options{Quality: s.opts.Quality}); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, fileName))
+}
+
+// Remove deletes every stored version of a photo. Missing files are ignored.
+func (s *Store) Remove(name string) error {
+	if !nameRe.MatchString(name) {
+		return fmt.Errorf("invalid photo name %q", name)
+	}
+
+	for size := range bounds {
+		err := os.Remove(filepath.Join(s.dir, FileName(name, size)))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// toRGBA converts img to an RGBA image with its origin at 0,0
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+
+	return dst
+}
+
+// Fit scales src down to fit within box, keeping its aspect ratio. Each
+// destination pixel is the average of the source pixels it covers, which
+// gives smooth results when shrinking without any external dependency.
+func Fit(src *image.RGBA, box image.Point) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= box.X && sh <= box.Y {
+		return src
+	}
+
+	dw, dh := box.X, sh*box.X/sw
+	if dh > box.Y {
+		dw, dh = sw*box.Y/sh, box.Y
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,131 @@
+package photos
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestStore_Save(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := New(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := s.Save("room-1", bytes.NewReader(testPNG(t, 2000, 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(name, "room-1-") {
+		t.Errorf("expected name prefixed with room-1-, got %q", name)
+	}
+
+	expected := map[string]image.Point{
+		Thumbnail: {X: 480, Y: 240},
+		Display:   {X: 1600, Y: 800},
+	}
+
+	for size, dims := range expected {
+		f, err := os.Open(filepath.Join(dir, FileName(name, size)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := jpeg.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.Width != dims.X || cfg.Height != dims.Y {
+			t.Errorf("%s: expected %dx%d, got %dx%d", size, dims.X, dims.Y, cfg.Width, cfg.Height)
+		}
+	}
+
+	if err := s.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected no files after removing the photo, found %d", len(entries))
+	}
+}
+
+func TestStore_SaveRejects(t *testing.T) {
+	s, err := New(t.TempDir(), Options{MaxFileSize: 64 << 10, MaxPixels: 1000 * 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"Not an image", []byte("<html><body>hello</body></html>"), ErrUnsupportedType},
+		{"Truncated image", testPNG(t, 10, 10)[:40], ErrUnsupportedType},
+		{"Too many bytes", bytes.Repeat([]byte{0}, 65<<10), ErrTooLarge},
+		{"Too many pixels", testPNG(t, 1200, 1000), ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Save("room-1", bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	small := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	if Fit(small, image.Point{X: 480, Y: 360}) != small {
+		t.Error("expected small images to be left as is")
+	}
+
+	tall := image.NewRGBA(image.Rect(0, 0, 300, 900))
+	if b := Fit(tall, image.Point{X: 480, Y: 360}).Bounds(); b.Dx() != 120 || b.Dy() != 360 {
+		t.Errorf("expected 120x360, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestStore_RemoveInvalidName(t *testing.T) {
+	s, err := New(t.TempDir(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Remove("../etc/passwd"); err == nil {
+		t.Error("expected an error for a name outside the store")
+	}
+}
@@ -0,0 +1,78 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/dates"
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// ErrInvalidStay is returned when the departure is not after the arrival
+var ErrInvalidStay = errors.New("departure must be after arrival")
+
+// Quote prices every night between start and end using the room rate and any seasonal overrides.
+// Friday and Saturday nights use the weekend rate when one is set.
+func Quote(rate models.RoomRate, seasons []models.SeasonalRate, start, end time.Time) (models.Quote, error) {
+	quote := models.Quote{
+		RoomID:    rate.RoomID,
+		StartDate: start,
+		EndDate:   end,
+	}
+
+	start = dates.TruncateDay(start)
+	end = dates.TruncateDay(end)
+
+	if !end.After(start) {
+		return quote, ErrInvalidStay
+	}
+
+	for night := start; night.Before(end); night = night.AddDate(0, 0, 1) {
+		price := models.NightlyPrice{
+			Date:    night,
+			Weekend: IsWeekendNight(night),
+		}
+
+		base, weekend := rate.BaseRate, rate.WeekendRate
+
+		for _, season := range seasons {
+			if inSeason(season, night) {
+				base, weekend = season.BaseRate, season.WeekendRate
+				price.Season = season.SeasonName
+				break
+			}
+		}
+
+		price.Rate = base
+		if price.Weekend && weekend > 0 {
+			price.Rate = weekend
+		}
+
+		quote.Nights = append(quote.Nights, price)
+		quote.Total += price.Rate
+	}
+
+	return quote, nil
+}
+
+// IsWeekendNight reports whether the night starting on t is a Friday or Saturday night
+func IsWeekendNight(t time.Time) bool {
+	return t.Weekday() == time.Friday || t.Weekday() == time.Saturday
+}
+
+// FormatCents formats an amount in cents as dollars
+func FormatCents(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	return fmt.Sprintf("%s$%d.%02d", sign, cents/100, cents%100)
+}
+
+// inSeason reports whether night falls between the season start and end dates
+func inSeason(season models.SeasonalRate, night time.Time) bool {
+	return !night.Before(dates.TruncateDay(season.StartDate)) && !night.After(dates.TruncateDay(season.EndDate))
+}
@@ -0,0 +1,85 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestQuote(t *testing.T) {
+	rate := models.RoomRate{
+		RoomID:      1,
+		BaseRate:    10000,
+		WeekendRate: 15000,
+	}
+
+	seasons := []models.SeasonalRate{
+		{
+			RoomID:      1,
+			SeasonName:  "Holidays",
+			StartDate:   date(2050, 12, 20),
+			EndDate:     date(2050, 12, 31),
+			BaseRate:    20000,
+			WeekendRate: 0,
+		},
+	}
+
+	tests := []struct {
+		name        string
+		start, end  time.Time
+		nights      int
+		total       int
+		expectError bool
+	}{
+		// 2050-12-05 is a Monday
+		{"Weekdays only", date(2050, 12, 5), date(2050, 12, 8), 3, 30000, false},
+		{"Weekend differential", date(2050, 12, 8), date(2050, 12, 11), 3, 10000 + 15000 + 15000, false},
+		{"Season override without weekend rate", date(2050, 12, 19), date(2050, 12, 22), 3, 10000 + 20000 + 20000, false},
+		{"Zero nights", date(2050, 12, 5), date(2050, 12, 5), 0, 0, true},
+		{"Reversed dates", date(2050, 12, 8), date(2050, 12, 5), 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quote, err := Quote(rate, seasons, test.start, test.end)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(quote.Nights) != test.nights {
+				t.Errorf("expected %d nights, got %d", test.nights, len(quote.Nights))
+			}
+
+			if quote.Total != test.total {
+				t.Errorf("expected total %d, got %d", test.total, quote.Total)
+			}
+		})
+	}
+}
+
+func TestFormatCents(t *testing.T) {
+	tests := map[int]string{
+		0:      "$0.00",
+		5:      "$0.05",
+		12345:  "$123.45",
+		-12345: "-$123.45",
+	}
+
+	for cents, expected := range tests {
+		if got := FormatCents(cents); got != expected {
+			t.Errorf("FormatCents(%d) = %s, want %s", cents, got, expected)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package rbac maps the access level stored on a user to a named role and the
+// permissions that role grants in the admin area.
+package rbac
+
+// Role is a named access level. The values match models.User.AccessLevel.
+type Role int
+
+const (
+	FrontDesk Role = iota + 1
+	Manager
+	Owner
+)
+
+// Permission names an action in the admin area
+type Permission string
+
+const (
+	ViewReservations   Permission = "reservations.view"
+	EditReservations   Permission = "reservations.edit"
+	DeleteReservations Permission = "reservations.delete"
+	ManageUsers        Permission = "users.manage"
+	ManageMail         Permission = "mail.manage"
+	ManageRooms        Permission = "rooms.manage"
+)
+
+// rolePermissions lists what each role may do. Higher roles repeat the
+// permissions of lower ones so the table can be read on its own.
+var rolePermissions = map[Role][]Permission{
+	FrontDesk: {
+		ViewReservations,
+		EditReservations,
+	},
+	Manager: {
+		ViewReservations,
+		EditReservations,
+		DeleteReservations,
+		ManageMail,
+		ManageRooms,
+	},
+	Owner: {
+		ViewReservations,
+		EditReservations,
+		DeleteReservations,
+		ManageUsers,
+		ManageMail,
+		ManageRooms,
+	},
+}
+
+// Roles returns every role from least to most privileged
+func Roles() []Role {
+	return []Role{FrontDesk, Manager, Owner}
+}
+
+// String returns the display name of the role
+func (r Role) String() string {
+	switch r {
+	case FrontDesk:
+		return "Front desk"
+	case Manager:
+		return "Manager"
+	case Owner:
+		return "Owner"
+	default:
+		return "No role"
+	}
+}
+
+// Level returns the access level stored for the role
+func (r Role) Level() int {
+	return int(r)
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// roleFor returns the role of an access level. Levels above Owner were full admins
+// before roles existed and keep that access.
+func roleFor(accessLevel int) Role {
+	return Role(min(accessLevel, int(Owner)))
+}
+
+// Can reports whether a user with the given access level holds the permission
+func Can(accessLevel int, p Permission) bool {
+	for _, granted := range rolePermissions[roleFor(accessLevel)] {
+		if granted == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RoleName returns the display name of the role for an access level
+func RoleName(accessLevel int) string {
+	return roleFor(accessLevel).String()
+}
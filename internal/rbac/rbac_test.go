@@ -0,0 +1,56 @@
+package rbac
+
+import "testing"
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessLevel int
+		permission  Permission
+		expected    bool
+	}{
+		{"Front desk views reservations", int(FrontDesk), ViewReservations, true},
+		{"Front desk edits reservations", int(FrontDesk), EditReservations, true},
+		{"Front desk deletes reservations", int(FrontDesk), DeleteReservations, false},
+		{"Front desk manages users", int(FrontDesk), ManageUsers, false},
+		{"Manager deletes reservations", int(Manager), DeleteReservations, true},
+		{"Manager manages users", int(Manager), ManageUsers, false},
+		{"Owner manages users", int(Owner), ManageUsers, true},
+		{"Front desk manages mail", int(FrontDesk), ManageMail, false},
+		{"Manager manages mail", int(Manager), ManageMail, true},
+		{"Front desk manages rooms", int(FrontDesk), ManageRooms, false},
+		{"Manager manages rooms", int(Manager), ManageRooms, true},
+		{"Unknown level", 0, ViewReservations, false},
+		{"Level above owner manages users", 4, ManageUsers, true},
+		{"Level above owner manages rooms", 4, ManageRooms, true},
+		{"Unknown permission", int(Owner), Permission("unknown"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Can(tt.accessLevel, tt.permission); got != tt.expected {
+				t.Errorf("Can(%d, %q) = %v, want %v", tt.accessLevel, tt.permission, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRoles(t *testing.T) {
+	for _, r := range Roles() {
+		if !r.Valid() {
+			t.Errorf("role %d is not valid", r)
+		}
+
+		if r.String() == "No role" {
+			t.Errorf("role %d has no name", r)
+		}
+	}
+
+	if Role(42).Valid() {
+		t.Error("expected role 42 to be invalid")
+	}
+
+	if RoleName(3) != "Owner" {
+		t.Errorf("expected Owner, got %s", RoleName(3))
+	}
+}
@@ -2,16 +2,22 @@ package render
 
 import (
 	"bytes"
-	"errors"
-	"log"
+	"fmt"
+	"html/template"
 	"net/http"
+	"os"
 	"path/filepath"
-	"text/template"
+	"strconv"
 	"time"
 
 	"github.com/justinas/nosurf"
 	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/lifecycle"
 	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/photos"
+	"github.com/mlvieira/bookings/internal/pricing"
+	"github.com/mlvieira/bookings/internal/rbac"
+	"github.com/mlvieira/bookings/internal/stayrules"
 )
 
 var app *config.AppConfig
@@ -27,25 +33,35 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.CSRFToken = nosurf.Token(r)
-	if app.Session.Exists(r.Context(), "user") {
+	if user, ok := app.Session.Get(r.Context(), "user").(models.User); ok {
 		td.IsAuthenticated = 1
+		td.AccessLevel = user.AccessLevel
+	}
+	if cart, ok := app.Session.Get(r.Context(), "cart").(models.Cart); ok {
+		td.CartItems = len(cart.Items)
 	}
 	return td
 }
 
-// Template render a view
+// Template render a view. The page is rendered into a buffer first so a failing
+// template results in a 500 instead of a half written page.
 func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.TemplateData) error {
-	var tc map[string]*template.Template
+	tc := app.TemplateCache
 
-	if app.UseCache {
-		tc = app.TemplateCache
-	} else {
-		tc, _ = CreateTemplateCache()
+	if !app.UseCache {
+		var err error
+		tc, err = CreateTemplateCache()
+		if err != nil {
+			serverError(w, err)
+			return err
+		}
 	}
 
 	t, ok := tc[tmpl]
 	if !ok {
-		return errors.New("cant get template from cache")
+		err := fmt.Errorf("cant get template %s from cache", tmpl)
+		serverError(w, err)
+		return err
 	}
 
 	buf := new(bytes.Buffer)
@@ -54,18 +70,25 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 
 	err := t.Execute(buf, td)
 	if err != nil {
-		log.Fatal(err)
+		serverError(w, err)
+		return err
 	}
 
 	_, err = buf.WriteTo(w)
 	if err != nil {
-		log.Println(err)
+		app.ErrorLog.Println(err)
 		return err
 	}
 
 	return nil
 }
 
+// serverError logs err and sends a generic 500 response
+func serverError(w http.ResponseWriter, err error) {
+	app.ErrorLog.Println(err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
 // CreateTemplateCache creates cache for the templates
 func CreateTemplateCache() (map[string]*template.Template, error) {
 	templates := map[string]*template.Template{}
@@ -81,10 +104,23 @@ func CreateTemplateCache() (map[string]*template.Template, error) {
 	}
 
 	funcMap := template.FuncMap{
-		"humanDate": humanDate,
-		"dict":      dict,
-		"concat":    concat,
-		"seq":       seq,
+		"humanDate":    humanDate,
+		"dict":         dict,
+		"concat":       concat,
+		"seq":          seq,
+		"money":        pricing.FormatCents,
+		"can":          can,
+		"roles":        rbac.Roles,
+		"roleName":     rbac.RoleName,
+		"photoURL":     photoURL,
+		"roomImage":    roomImage,
+		"dayNames":     stayrules.DayNames,
+		"isClosed":     stayrules.IsClosed,
+		"percent":      percent,
+		"share":        share,
+		"statuses":     lifecycle.Statuses,
+		"statusName":   lifecycle.Name,
+		"nextStatuses": lifecycle.Next,
 	}
 
 	for _, page := range pages {
@@ -101,6 +137,11 @@ func CreateTemplateCache() (map[string]*template.Template, error) {
 	return templates, nil
 }
 
+// can reports whether an access level holds the named permission
+func can(accessLevel int, permission string) bool {
+	return rbac.Can(accessLevel, rbac.Permission(permission))
+}
+
 // dict creates a map from a variadic list of key-value pairs.
 func dict(values ...any) map[string]any {
 	m := make(map[string]any)
@@ -117,11 +158,40 @@ func humanDate(t time.Time) string {
 	return t.Format("01-02-2006")
 }
 
+// photoURL returns the URL of one size ("thumb" or "display") of a stored room photo
+func photoURL(name, size string) string {
+	return "/photos/" + photos.FileName(name, size)
+}
+
+// roomImage returns the static image of a room without a photo gallery, named after its
+// URL, or a placeholder when the room has none
+func roomImage(roomURL string) string {
+	name := filepath.Base(roomURL) + ".png"
+	if _, err := os.Stat(filepath.Join("./static/images", name)); err != nil {
+		return "/static/images/room-placeholder.svg"
+	}
+
+	return "/static/images/" + name
+}
+
 // concat Concat two strings
 func concat(x, y string) string {
 	return x + " " + y
 }
 
+// percent formats a ratio from 0 to 1 as a percentage with one decimal
+func percent(ratio float64) string {
+	return strconv.FormatFloat(ratio*100, 'f', 1, 64) + "%"
+}
+
+// share returns part as a ratio of whole, or 0 when whole is not positive
+func share(part, whole int) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
+
 // seq generates a slice of integers from start to end (inclusive).
 func seq(start, end int) []int {
 	s := make([]int, end-start+1)
@@ -1,12 +1,15 @@
 package render
 
 import (
+	"html/template"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/mlvieira/bookings/internal/forms"
 	"github.com/mlvieira/bookings/internal/models"
 )
 
@@ -27,10 +30,6 @@ func TestDefaultData(t *testing.T) {
 }
 
 func TestRenderTemplate(t *testing.T) {
-	if err := os.Chdir("../.."); err != nil {
-		t.Fatal("Could not change working directory:", err)
-	}
-
 	tc, err := CreateTemplateCache()
 	if err != nil {
 		t.Error(err)
@@ -50,10 +49,119 @@ func TestRenderTemplate(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	rr = httptest.NewRecorder()
+
 	err = Template(rr, r, "notexist.page.html", &models.TemplateData{})
 	if err == nil {
 		t.Fatal("rendered non existant template")
 	}
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500 for a missing template, got %d", rr.Code)
+	}
+}
+
+func TestRenderTemplate_ExecutionError(t *testing.T) {
+	app.TemplateCache = map[string]*template.Template{
+		"broken.page.html": template.Must(template.New("broken.page.html").Parse(`<p>{{.Missing.Field}}</p>`)),
+	}
+	defer func() { app.TemplateCache = nil }()
+
+	r, err := getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	if err := Template(rr, r, "broken.page.html", &models.TemplateData{}); err == nil {
+		t.Fatal("expected an error executing a broken template")
+	}
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rr.Code)
+	}
+
+	if strings.Contains(rr.Body.String(), "<p>") {
+		t.Error("expected no partial page output")
+	}
+}
+
+func TestRenderTemplate_EscapesReservationFields(t *testing.T) {
+	tc, err := CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.TemplateCache = tc
+
+	const payload = `<script>alert("xss")</script>`
+
+	hostile := models.Reservation{
+		ID:        1,
+		FirstName: payload,
+		LastName:  `"><img src=x onerror=alert(1)>`,
+		Email:     `x@example.com"><script>alert(2)</script>`,
+		Phone:     payload,
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Room:      models.Room{ID: 1, RoomName: payload},
+	}
+
+	hostileList := models.ReservationList{
+		Path:   "/admin/reservations/all",
+		Query:  models.ReservationQuery{Page: 1, PageSize: models.DefaultPageSize, Sort: "start_date"},
+		Result: models.ReservationPage{Reservations: []models.Reservation{hostile}, Total: 1, Page: 1, PageSize: models.DefaultPageSize},
+	}
+
+	tests := []struct {
+		name string
+		page string
+		data map[string]any
+	}{
+		{"Admin reservation summary", "admin-reservations-summary.page.html", map[string]any{"reservation": hostile, "canReschedule": true, "rooms": []models.Room{hostile.Room}}},
+		{"Admin all reservations", "admin-all-reservations.page.html", map[string]any{"list": hostileList}},
+		{"Admin new reservations", "admin-new-reservations.page.html", map[string]any{"list": hostileList}},
+		{"Guest reservation summary", "reservation-summary.page.html", map[string]any{"reservation": hostile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := getSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			session.Put(r.Context(), "flash", `<b onmouseover="alert(3)">Saved</b>`)
+			session.Put(r.Context(), "user", models.User{ID: 1, AccessLevel: 3})
+
+			rr := httptest.NewRecorder()
+
+			err = Template(rr, r, tt.page, &models.TemplateData{
+				Data: tt.data,
+				Form: forms.New(nil),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body := rr.Body.String()
+
+			for _, raw := range []string{payload, "<img src=x", "<script>alert(2)", "<b onmouseover"} {
+				if strings.Contains(body, raw) {
+					t.Errorf("expected %q to be escaped", raw)
+				}
+			}
+
+			if !strings.Contains(body, "&lt;script&gt;") {
+				t.Error("expected the escaped reservation fields in the page")
+			}
+
+			if !strings.Contains(body, "&lt;b onmouseover=") {
+				t.Error("expected the escaped flash message in the page")
+			}
+		})
+	}
 }
 
 func TestNewTemplates(t *testing.T) {
@@ -61,14 +169,14 @@ func TestNewTemplates(t *testing.T) {
 }
 
 func TestCreateTemplateCache(t *testing.T) {
-	if err := os.Chdir("../.."); err != nil {
-		t.Fatal("Could not change working directory:", err)
-	}
-
-	_, err := CreateTemplateCache()
+	tc, err := CreateTemplateCache()
 	if err != nil {
 		t.Error(err)
 	}
+
+	if _, ok := tc["home.page.html"]; !ok {
+		t.Error("expected home.page.html in the template cache")
+	}
 }
 
 func getSession() (*http.Request, error) {
@@ -106,3 +214,35 @@ func TestDict(t *testing.T) {
 	}()
 	_ = dict("name")
 }
+
+func TestRoomImage(t *testing.T) {
+	tests := map[string]string{
+		"generals-quarters": "/static/images/generals-quarters.png",
+		"new-room":          "/static/images/room-placeholder.svg",
+		"../../go":          "/static/images/room-placeholder.svg",
+	}
+
+	for roomURL, expected := range tests {
+		if got := roomImage(roomURL); got != expected {
+			t.Errorf("roomImage(%q) = %q, want %q", roomURL, got, expected)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := map[float64]string{0: "0.0%", 0.1019: "10.2%", 1: "100.0%"}
+
+	for ratio, expected := range tests {
+		if got := percent(ratio); got != expected {
+			t.Errorf("percent(%v) = %q, want %q", ratio, got, expected)
+		}
+	}
+
+	if got := share(25, 100); got != 0.25 {
+		t.Errorf("share(25, 100) = %v, want 0.25", got)
+	}
+
+	if got := share(25, 0); got != 0 {
+		t.Errorf("share(25, 0) = %v, want 0", got)
+	}
+}
@@ -2,6 +2,8 @@ package render
 
 import (
 	"encoding/gob"
+	"io"
+	"log"
 	"net/http"
 	"os"
 	"testing"
@@ -16,10 +18,15 @@ var session *scs.SessionManager
 var testApp config.AppConfig
 
 func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		log.Fatal("Could not change working directory:", err)
+	}
 
 	gob.Register(models.Reservation{})
 
 	testApp.InProduction = true
+	testApp.InfoLog = log.New(io.Discard, "", 0)
+	testApp.ErrorLog = log.New(io.Discard, "", 0)
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -0,0 +1,254 @@
+// Package reports computes occupancy and revenue figures from reservations and
+// room restrictions. It does no I/O; the repository loads the rows and hands
+// them to Build.
+package reports
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/dates"
+	"github.com/mlvieira/bookings/internal/lifecycle"
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// ErrInvalidRange is returned when the report ends before it starts
+var ErrInvalidRange = errors.New("report end must be after its start")
+
+// night states, from the weakest to the strongest claim on a room night
+const (
+	nightOpen = iota
+	nightBlocked
+	nightExternal
+	nightSold
+)
+
+// night is what happened to one room on one night of the report
+type night struct {
+	state   int
+	revenue int
+	priced  bool
+}
+
+// tally accumulates the figures of a report row along with the sums its averages need
+type tally struct {
+	figures      models.ReportFigures
+	stayNights   int
+	leadDays     int
+	pricedNights int
+}
+
+// Build reports on the nights from start up to, but not including, end.
+//
+// A room night is sold when a reservation covers it, external when a booking imported
+// from another site covers it and blocked when an owner block covers it. Blocked nights
+// are not available for sale, so they don't lower the occupancy. Cancelled and no-show
+// reservations are ignored. A reservation's total is spread evenly over its nights, so a stay that
+// crosses the edge of the report only counts the revenue of the nights inside it.
+//
+// Inactive rooms are left out unless something was sold or imported for them in the period.
+func Build(start, end time.Time, rooms []models.Room, reservations []models.Reservation, restrictions []models.RoomRestriction) (models.Report, error) {
+	start = dates.TruncateDay(start)
+	end = dates.TruncateDay(end)
+
+	report := models.Report{
+		StartDate: start,
+		EndDate:   end,
+	}
+
+	if !end.After(start) {
+		return report, ErrInvalidRange
+	}
+
+	days := dates.DaysBetween(start, end)
+
+	nights := make(map[int][]night, len(rooms))
+	for _, room := range rooms {
+		nights[room.ID] = make([]night, days)
+	}
+
+	mark := func(roomID int, from, to time.Time, state int, fn func(i int, n *night)) {
+		roomNights, ok := nights[roomID]
+		if !ok {
+			return
+		}
+
+		from, to = dates.TruncateDay(from), dates.TruncateDay(to)
+		first, last := max(dates.DaysBetween(start, from), 0), min(dates.DaysBetween(start, to), days)
+
+		for i := first; i < last; i++ {
+			if roomNights[i].state < state {
+				roomNights[i].state = state
+			}
+			if fn != nil {
+				fn(i, &roomNights[i])
+			}
+		}
+	}
+
+	for _, rr := range restrictions {
+		switch rr.RestrictionID {
+		case models.RestrictionOwnerBlock:
+			mark(rr.RoomID, rr.StartDate, rr.EndDate, nightBlocked, nil)
+		case models.RestrictionExternal:
+			mark(rr.RoomID, rr.StartDate, rr.EndDate, nightExternal, nil)
+		}
+	}
+
+	roomIndex := make(map[int]int, len(rooms))
+	roomTallies := make([]tally, len(rooms))
+	for i, room := range rooms {
+		roomIndex[room.ID] = i
+	}
+
+	months := monthsBetween(start, end)
+	monthTallies := make([]tally, len(months))
+
+	var total tally
+
+	for _, res := range reservations {
+		if lifecycle.Status(res.Status).ReleasesRoom() {
+			continue
+		}
+
+		ri, ok := roomIndex[res.RoomID]
+		if !ok {
+			continue
+		}
+
+		arrival, departure := dates.TruncateDay(res.StartDate), dates.TruncateDay(res.EndDate)
+		stay := dates.DaysBetween(arrival, departure)
+		if stay <= 0 {
+			continue
+		}
+
+		perNight, remainder := res.Total/stay, res.Total%stay
+		offset := dates.DaysBetween(arrival, start)
+
+		mark(res.RoomID, arrival, departure, nightSold, func(i int, n *night) {
+			// the first nights of the stay take the cents that don't split evenly
+			n.revenue += perNight
+			if i+offset < remainder {
+				n.revenue++
+			}
+			n.priced = n.priced || res.Total > 0
+		})
+
+		if arrival.Before(start) || !arrival.Before(end) {
+			continue
+		}
+
+		lead := max(dates.DaysBetween(dates.TruncateDay(res.CreatedAt), arrival), 0)
+		mi := monthIndex(months, arrival)
+
+		for _, t := range []*tally{&total, &roomTallies[ri], &monthTallies[mi]} {
+			t.figures.Arrivals++
+			t.stayNights += stay
+			t.leadDays += lead
+		}
+	}
+
+	for i, room := range rooms {
+		t := &roomTallies[i]
+		for _, n := range nights[room.ID] {
+			t.add(n)
+		}
+
+		if room.Active != 1 && t.figures.NightsSold == 0 && t.figures.ExternalNights == 0 {
+			continue
+		}
+
+		for day, n := range nights[room.ID] {
+			monthTallies[monthIndex(months, start.AddDate(0, 0, day))].add(n)
+		}
+
+		total.figures.AvailableNights += t.figures.AvailableNights
+		total.figures.NightsSold += t.figures.NightsSold
+		total.figures.ExternalNights += t.figures.ExternalNights
+		total.figures.BlockedNights += t.figures.BlockedNights
+		total.figures.Revenue += t.figures.Revenue
+		total.pricedNights += t.pricedNights
+
+		report.Rooms = append(report.Rooms, models.RoomReport{
+			RoomID:        room.ID,
+			RoomName:      room.RoomName,
+			ReportFigures: t.finish(),
+		})
+	}
+
+	for i, month := range months {
+		report.Months = append(report.Months, models.MonthReport{
+			Month:         month,
+			ReportFigures: monthTallies[i].finish(),
+		})
+	}
+
+	report.Totals = total.finish()
+
+	return report, nil
+}
+
+// add counts one room night
+func (t *tally) add(n night) {
+	switch n.state {
+	case nightBlocked:
+		t.figures.BlockedNights++
+		return
+	case nightExternal:
+		t.figures.ExternalNights++
+	case nightSold:
+		t.figures.NightsSold++
+		t.figures.Revenue += n.revenue
+		if n.priced {
+			t.pricedNights++
+		}
+	}
+
+	t.figures.AvailableNights++
+}
+
+// finish works out the rates and averages of the tally
+func (t tally) finish() models.ReportFigures {
+	f := t.figures
+
+	if f.AvailableNights > 0 {
+		f.Occupancy = round(float64(f.NightsSold+f.ExternalNights)/float64(f.AvailableNights), 4)
+	}
+
+	if f.Arrivals > 0 {
+		f.AverageStay = round(float64(t.stayNights)/float64(f.Arrivals), 1)
+		f.AverageLeadDays = round(float64(t.leadDays)/float64(f.Arrivals), 1)
+	}
+
+	if t.pricedNights > 0 {
+		f.ADR = int(math.Round(float64(f.Revenue) / float64(t.pricedNights)))
+	}
+
+	return f
+}
+
+// monthsBetween returns the first day of every month with a night in the range
+func monthsBetween(start, end time.Time) []time.Time {
+	var months []time.Time
+
+	month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+	for month.Before(end) {
+		months = append(months, month)
+		month = month.AddDate(0, 1, 0)
+	}
+
+	return months
+}
+
+// monthIndex returns the position of the month of day in months
+func monthIndex(months []time.Time, day time.Time) int {
+	first := months[0]
+	return (day.Year()-first.Year())*12 + int(day.Month()) - int(first.Month())
+}
+
+// round rounds f to the given number of decimal places
+func round(f float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(f*p) / p
+}
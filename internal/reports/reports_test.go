@@ -0,0 +1,118 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/lifecycle"
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBuild(t *testing.T) {
+	rooms := []models.Room{
+		{ID: 1, RoomName: "General's Quarters", Active: 1},
+		{ID: 2, RoomName: "Major's Suite", Active: 1},
+		{ID: 3, RoomName: "Closed Room", Active: 0},
+	}
+
+	reservations := []models.Reservation{
+		// crosses the start of the report; only two of its four nights are counted
+		{ID: 1, RoomID: 1, StartDate: date(2049, 12, 30), EndDate: date(2050, 1, 3), Total: 10001, CreatedAt: date(2049, 12, 1)},
+		{ID: 2, RoomID: 1, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 13), Total: 30000, CreatedAt: date(2050, 1, 5)},
+		// unpriced and crossing the end of the report
+		{ID: 3, RoomID: 2, StartDate: date(2050, 2, 27), EndDate: date(2050, 3, 2), CreatedAt: date(2050, 2, 27)},
+		{ID: 4, RoomID: 2, StartDate: date(2050, 1, 5), EndDate: date(2050, 1, 8), Total: 9999, Status: string(lifecycle.Cancelled)},
+	}
+
+	restrictions := []models.RoomRestriction{
+		{RoomID: 2, RestrictionID: models.RestrictionOwnerBlock, StartDate: date(2050, 1, 20), EndDate: date(2050, 1, 30)},
+		{RoomID: 1, RestrictionID: models.RestrictionExternal, StartDate: date(2050, 2, 1), EndDate: date(2050, 2, 5)},
+		// the reservations' own restrictions don't count twice
+		{RoomID: 1, RestrictionID: models.RestrictionReservation, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 13)},
+	}
+
+	report, err := Build(date(2050, 1, 1), date(2050, 3, 1), rooms, reservations, restrictions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Rooms) != 2 {
+		t.Fatalf("expected the inactive room to be left out, got %d rooms", len(report.Rooms))
+	}
+
+	if len(report.Months) != 2 {
+		t.Fatalf("expected 2 months, got %d", len(report.Months))
+	}
+
+	tests := []struct {
+		name     string
+		got      models.ReportFigures
+		expected models.ReportFigures
+	}{
+		{"Totals", report.Totals, models.ReportFigures{
+			AvailableNights: 108, NightsSold: 7, ExternalNights: 4, BlockedNights: 10, Occupancy: 0.1019,
+			Arrivals: 2, AverageStay: 3, AverageLeadDays: 2.5, Revenue: 35000, ADR: 7000,
+		}},
+		{"Room 1", report.Rooms[0].ReportFigures, models.ReportFigures{
+			AvailableNights: 59, NightsSold: 5, ExternalNights: 4, Occupancy: 0.1525,
+			Arrivals: 1, AverageStay: 3, AverageLeadDays: 5, Revenue: 35000, ADR: 7000,
+		}},
+		{"Room 2", report.Rooms[1].ReportFigures, models.ReportFigures{
+			AvailableNights: 49, NightsSold: 2, BlockedNights: 10, Occupancy: 0.0408,
+			Arrivals: 1, AverageStay: 3,
+		}},
+		{"January", report.Months[0].ReportFigures, models.ReportFigures{
+			AvailableNights: 52, NightsSold: 5, BlockedNights: 10, Occupancy: 0.0962,
+			Arrivals: 1, AverageStay: 3, AverageLeadDays: 5, Revenue: 35000, ADR: 7000,
+		}},
+		{"February", report.Months[1].ReportFigures, models.ReportFigures{
+			AvailableNights: 56, NightsSold: 2, ExternalNights: 4, Occupancy: 0.1071,
+			Arrivals: 1, AverageStay: 3,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, tt.got)
+			}
+		})
+	}
+
+	if !report.Months[1].Month.Equal(date(2050, 2, 1)) {
+		t.Errorf("unexpected month %s", report.Months[1].Month)
+	}
+}
+
+func TestBuildRevenueRemainder(t *testing.T) {
+	rooms := []models.Room{{ID: 1, Active: 1}}
+	reservations := []models.Reservation{
+		{RoomID: 1, StartDate: date(2050, 1, 1), EndDate: date(2050, 1, 4), Total: 10001},
+	}
+
+	// the first two nights take the cents that do not split evenly
+	first, err := Build(date(2050, 1, 1), date(2050, 1, 2), rooms, reservations, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rest, err := Build(date(2050, 1, 2), date(2050, 1, 4), rooms, reservations, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Totals.Revenue != 3334 || rest.Totals.Revenue != 6667 {
+		t.Errorf("expected 3334 and 6667, got %d and %d", first.Totals.Revenue, rest.Totals.Revenue)
+	}
+}
+
+func TestBuildInvalidRange(t *testing.T) {
+	_, err := Build(date(2050, 1, 2), date(2050, 1, 2), nil, nil, nil)
+	if err != ErrInvalidRange {
+		t.Errorf("expected ErrInvalidRange, got %v", err)
+	}
+}
@@ -2,8 +2,10 @@ package dbrepo
 
 import (
 	"database/sql"
+	"sync"
 
 	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/models"
 	"github.com/mlvieira/bookings/internal/repository"
 )
 
@@ -15,6 +17,16 @@ type mysqlDBRepo struct {
 type testDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
+
+	// created holds the rooms added with CreateRoom, so tests can book them
+	mu      sync.Mutex
+	created map[int]createdRoom
+}
+
+// createdRoom is a room added to the test repository with its rates
+type createdRoom struct {
+	room models.Room
+	rate models.RoomRate
 }
 
 func NewMysqlRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
@@ -26,6 +38,7 @@ func NewMysqlRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
 
 func NewTestRepo(a *config.AppConfig) repository.DatabaseRepo {
 	return &testDBRepo{
-		App: a,
+		App:     a,
+		created: make(map[int]createdRoom),
 	}
 }
@@ -1,11 +1,18 @@
 package dbrepo
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
+	"github.com/mlvieira/bookings/internal/lifecycle"
 	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/pricing"
+	"github.com/mlvieira/bookings/internal/reports"
+	"github.com/mlvieira/bookings/internal/repository"
+	"github.com/mlvieira/bookings/internal/tokens"
 )
 
 // InsertReservation inserts a reservation into the database
@@ -25,54 +32,169 @@ func (m *testDBRepo) InsertRoomRestriction(res models.RoomRestriction) error {
 	return nil
 }
 
+// BookRoom inserts a reservation and its room restriction in a single transaction
+func (m *testDBRepo) BookRoom(res models.Reservation) (int, error) {
+	if res.Email == "john@at.com" || res.RoomID == 404 {
+		return 0, errors.New("err")
+	}
+
+	if res.RoomID == 423 {
+		return 0, &repository.StayRuleError{Violation: models.StayRuleViolation{
+			RoomID:  res.RoomID,
+			Rule:    "min_nights",
+			Message: "The minimum stay is 3 nights",
+		}}
+	}
+
+	if res.RoomID == 409 {
+		return 0, &repository.RoomUnavailableError{
+			RoomID:    res.RoomID,
+			StartDate: res.StartDate,
+			EndDate:   res.EndDate,
+		}
+	}
+
+	capacity := 2
+	if created, ok := m.createdRoom(res.RoomID); ok {
+		capacity = created.room.Capacity
+	}
+
+	if res.Guests() > capacity {
+		return 0, &repository.OccupancyError{
+			RoomID:   res.RoomID,
+			Capacity: capacity,
+			Guests:   res.Guests(),
+		}
+	}
+
+	return 1, nil
+}
+
+// BookGroup books the reservations one after the other like BookRoom, failing the
+// whole group with the first error
+func (m *testDBRepo) BookGroup(group models.ReservationGroup) (models.ReservationGroup, error) {
+	group.ID = 1
+	group.Total = 0
+
+	reservations := make([]models.Reservation, len(group.Reservations))
+	for i, res := range group.Reservations {
+		if _, err := m.BookRoom(res); err != nil {
+			return models.ReservationGroup{}, err
+		}
+
+		res.ID = i + 1
+		res.GroupID = group.ID
+		reservations[i] = res
+		group.Total += res.Total
+	}
+
+	group.Reservations = reservations
+
+	return group, nil
+}
+
 // SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false if no availability
 func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
 	if roomID == 404 {
 		return false, errors.New("err")
 	}
 
+	if roomID == 3 {
+		return false, &repository.StayRuleError{Violation: models.StayRuleViolation{
+			RoomID:  roomID,
+			Rule:    "min_nights",
+			Message: "The minimum stay is 3 nights",
+		}}
+	}
+
 	t := time.Date(2050, 12, 17, 0, 0, 0, 0, &time.Location{})
 
 	return t.Equal(start), nil
 }
 
-// SearchAvailabilityForAllRooms return a slice of available rooms, if any, for given date range
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+// SearchAvailabilityForAllRooms return a slice of available rooms, if any, for given date range.
+// Searches ending on 2050-12-19 find no room, one being excluded by a stay rule.
+func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time, guests int) ([]models.Room, []models.StayRuleViolation, error) {
 	var rooms []models.Room
 
 	ta := time.Date(2050, 12, 17, 0, 0, 0, 0, &time.Location{})
 	if ta.Equal(start) {
-		return rooms, errors.New("err")
+		return rooms, nil, errors.New("err")
 	}
 
 	te := time.Date(2050, 12, 18, 0, 0, 0, 0, &time.Location{})
 	if te.Equal(end) {
-		return rooms, nil
+		return rooms, nil, nil
+	}
+
+	tr := time.Date(2050, 12, 19, 0, 0, 0, 0, &time.Location{})
+	if tr.Equal(end) {
+		return rooms, []models.StayRuleViolation{{
+			RoomID:   2,
+			RoomName: "Major's Suite",
+			Rule:     "min_nights",
+			Message:  "The minimum stay is 3 nights",
+		}}, nil
+	}
+
+	// the only room sleeps two guests
+	if guests > 2 {
+		return rooms, nil, nil
 	}
 
 	room := models.Room{
-		ID: 1,
+		ID:       1,
+		Capacity: 2,
 	}
 	rooms = append(rooms, room)
 
-	return rooms, nil
+	return rooms, nil, nil
 }
 
 // GetRoomByID gets a room by id
 func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+	if created, ok := m.createdRoom(id); ok {
+		return created.room, nil
+	}
+
 	var room models.Room
 	if id > 2 {
 		return room, errors.New("err")
 	}
+
+	room = models.Room{
+		ID:       id,
+		RoomURL:  fmt.Sprintf("room-%d", id),
+		Capacity: 2,
+		Active:   1,
+	}
+
 	return room, nil
 }
 
 // GetRoomByURL gets a room by url path
 func (m *testDBRepo) GetRoomByUrl(url string) (models.Room, error) {
+	m.mu.Lock()
+	for _, created := range m.created {
+		if created.room.RoomURL == url {
+			m.mu.Unlock()
+			return created.room, nil
+		}
+	}
+	m.mu.Unlock()
+
 	var room models.Room
-	if url != "majors-suite" {
+	if url == "db-error" {
 		return room, errors.New("err")
 	}
+	if url == "closed-suite" {
+		return models.Room{ID: 3, RoomName: "Closed Suite", RoomURL: url, Capacity: 2}, nil
+	}
+	if url != "majors-suite" {
+		return room, sql.ErrNoRows
+	}
+
+	room = models.Room{ID: 2, RoomName: "Major's Suite", RoomURL: url, Capacity: 2, Active: 1, CoverPhoto: "room-2-cover"}
 
 	return room, nil
 }
@@ -126,10 +248,12 @@ func (m *testDBRepo) AllReservations(start, end *time.Time) ([]models.Reservatio
 			Phone:     "123-456-7890",
 			StartDate: *start,
 			EndDate:   *end,
+			RoomID:    1,
 			Room: models.Room{
 				ID:       1,
 				RoomName: "Test",
 			},
+			Status:    string(lifecycle.Pending),
 			UpdatedAt: time.Now(),
 		},
 	}
@@ -137,10 +261,37 @@ func (m *testDBRepo) AllReservations(start, end *time.Time) ([]models.Reservatio
 	return reservations, nil
 }
 
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
+// SearchReservations pages through the reservations of EachReservation. Searching
+// for "error" fails.
+func (m *testDBRepo) SearchReservations(query models.ReservationQuery) (models.ReservationPage, error) {
+	page := models.ReservationPage{
+		Page:     max(query.Page, 1),
+		PageSize: query.PageSize,
+	}
 
-	return reservations, nil
+	if page.PageSize <= 0 {
+		page.PageSize = models.DefaultPageSize
+	}
+
+	var matches []models.Reservation
+	err := m.EachReservation(query.ReservationFilter, func(res models.Reservation) error {
+		matches = append(matches, res)
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+
+	if query.Desc {
+		slices.Reverse(matches)
+	}
+
+	page.Total = len(matches)
+
+	from := min((page.Page-1)*page.PageSize, len(matches))
+	page.Reservations = matches[from:min(from+page.PageSize, len(matches))]
+
+	return page, nil
 }
 
 func (m *testDBRepo) GetReservationById(id int) (models.Reservation, error) {
@@ -150,9 +301,75 @@ func (m *testDBRepo) GetReservationById(id int) (models.Reservation, error) {
 		return reservation, errors.New("err")
 	}
 
+	reservation = models.Reservation{
+		ID:        id,
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "john@example.com",
+		StartDate: time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC),
+		RoomID:    1,
+		Adults:    2,
+		Room: models.Room{
+			ID:       1,
+			RoomName: "Test",
+			Capacity: 2,
+		},
+	}
+
+	reservation.Status = string(lifecycle.Pending)
+
+	if id == 4 {
+		reservation.Status = string(lifecycle.Cancelled)
+		reservation.CancelledAt = time.Date(2050, 12, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	if id == 6 {
+		reservation.GroupID = 1
+	}
+
+	if id == 8 {
+		reservation.Children = 1
+	}
+
 	return reservation, nil
 }
 
+// GetGroupReservations returns reservation 6 and another room booked with it for
+// group 1, and an error for any other group
+func (m *testDBRepo) GetGroupReservations(groupID int) ([]models.Reservation, error) {
+	if groupID != 1 {
+		return nil, errors.New("err")
+	}
+
+	start := time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC)
+
+	return []models.Reservation{
+		{
+			ID:        6,
+			FirstName: "John",
+			LastName:  "Doe",
+			StartDate: start,
+			EndDate:   start.AddDate(0, 0, 3),
+			RoomID:    1,
+			Room:      models.Room{ID: 1, RoomName: "Test"},
+			Status:    string(lifecycle.Pending),
+			GroupID:   1,
+		},
+		{
+			ID:        7,
+			FirstName: "John",
+			LastName:  "Doe",
+			StartDate: start,
+			EndDate:   start.AddDate(0, 0, 3),
+			RoomID:    2,
+			Room:      models.Room{ID: 2, RoomName: "Major's Suite"},
+			Status:    string(lifecycle.Pending),
+			GroupID:   1,
+		},
+	}, nil
+}
+
 func (m *testDBRepo) UpdateReservation(res models.Reservation) error {
 	if res.RoomID == 3 {
 		return errors.New("err")
@@ -165,7 +382,37 @@ func (m *testDBRepo) DeleteReservation(id int) error {
 	return nil
 }
 
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+// TransitionReservation fails for reservation 3 and checks the move from the
+// status GetReservationById returns
+func (m *testDBRepo) TransitionReservation(id int, to lifecycle.Status) error {
+	if id == 3 {
+		return errors.New("err")
+	}
+
+	res, err := m.GetReservationById(id)
+	if err != nil {
+		return err
+	}
+
+	return lifecycle.Status(res.Status).Transition(to)
+}
+
+// RescheduleReservation fails for reservation 3, refuses to move the cancelled
+// reservation 4 and finds the room taken for reservation 5
+func (m *testDBRepo) RescheduleReservation(res models.Reservation) error {
+	switch res.ID {
+	case 3:
+		return errors.New("err")
+	case 4:
+		return repository.ErrNotReschedulable
+	case 5:
+		return &repository.RoomUnavailableError{
+			RoomID:    res.RoomID,
+			StartDate: res.StartDate,
+			EndDate:   res.EndDate,
+		}
+	}
+
 	return nil
 }
 
@@ -175,6 +422,50 @@ func (m *testDBRepo) GetAllRooms(limit int) ([]models.Room, error) {
 	return rooms, nil
 }
 
+func (m *testDBRepo) QuoteStay(roomID int, start, end time.Time) (models.Quote, error) {
+	if roomID == 404 {
+		return models.Quote{}, errors.New("err")
+	}
+
+	rate, err := m.GetRoomRate(roomID)
+	if errors.Is(err, repository.ErrNoRoomRates) {
+		rate = models.RoomRate{
+			RoomID:      roomID,
+			BaseRate:    10000,
+			WeekendRate: 15000,
+		}
+	}
+
+	return pricing.Quote(rate, nil, start, end)
+}
+
+// GetRoomRate returns the rates of rooms added with CreateRoom, and the same rates
+// for rooms 1 and 2. Other rooms have none.
+func (m *testDBRepo) GetRoomRate(roomID int) (models.RoomRate, error) {
+	if created, ok := m.createdRoom(roomID); ok {
+		return created.rate, nil
+	}
+
+	if roomID != 1 && roomID != 2 {
+		return models.RoomRate{}, repository.ErrNoRoomRates
+	}
+
+	return models.RoomRate{
+		RoomID:      roomID,
+		BaseRate:    10000,
+		WeekendRate: 15000,
+	}, nil
+}
+
+// createdRoom returns a room added with CreateRoom
+func (m *testDBRepo) createdRoom(id int) (createdRoom, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	created, ok := m.created[id]
+	return created, ok
+}
+
 func (m *testDBRepo) CreateUser(user models.User) (int, error) {
 	return 1, nil
 }
@@ -187,3 +478,412 @@ func (m *testDBRepo) ListUsers() ([]models.User, error) {
 func (m *testDBRepo) DeleteUser(id int) error {
 	return nil
 }
+
+func (m *testDBRepo) CreateAPIToken(token models.APIToken) (int, error) {
+	if token.UserID == 2 {
+		return 0, errors.New("err")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) ListAPITokens(userID int) ([]models.APIToken, error) {
+	var apiTokens []models.APIToken
+	return apiTokens, nil
+}
+
+func (m *testDBRepo) DeleteAPIToken(userID, id int) error {
+	if id == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserByAPIToken accepts the token "bk_test-token" as belonging to an administrator
+func (m *testDBRepo) GetUserByAPIToken(tokenHash string) (models.User, error) {
+	if tokenHash != tokens.HashAPIToken("bk_test-token") {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	return models.User{
+		ID:          1,
+		FirstName:   "Admin",
+		LastName:    "User",
+		Email:       "admin@example.com",
+		AccessLevel: 3,
+	}, nil
+}
+
+func (m *testDBRepo) EnqueueMail(msg models.MailData) (int, error) {
+	if msg.To == "outbox@error.com" {
+		return 0, errors.New("err")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) DueOutboxMessages(now time.Time, limit int) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	return messages, nil
+}
+
+func (m *testDBRepo) UpdateOutboxMessage(msg models.OutboxMessage) error {
+	return nil
+}
+
+func (m *testDBRepo) ListOutboxMessages(status string, limit int) ([]models.OutboxMessage, error) {
+	if status == models.OutboxSent {
+		return nil, errors.New("err")
+	}
+
+	return []models.OutboxMessage{
+		{
+			ID: 1,
+			Mail: models.MailData{
+				To:      "john@example.com",
+				From:    "noreply@bookings.com",
+				Subject: "Your Reservation is Confirmed!",
+			},
+			Status:        models.OutboxFailed,
+			Attempts:      5,
+			LastError:     "dial tcp: connection refused",
+			NextAttemptAt: time.Now(),
+			CreatedAt:     time.Now(),
+		},
+	}, nil
+}
+
+func (m *testDBRepo) RequeueOutboxMessage(id int) error {
+	if id == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// InsertRoomBlock reports a conflicting reservation for room 2
+func (m *testDBRepo) InsertRoomBlock(block models.RoomRestriction) (int, error) {
+	if block.RoomID == 2 {
+		return 0, &repository.DatesConflictError{
+			RoomID:    block.RoomID,
+			StartDate: block.StartDate,
+			EndDate:   block.EndDate,
+			Conflicts: []models.RoomRestriction{
+				{
+					ID:            1,
+					StartDate:     block.StartDate,
+					EndDate:       block.EndDate,
+					RoomID:        block.RoomID,
+					ReservationID: 1,
+					RestrictionID: models.RestrictionReservation,
+					Reservation:   models.Reservation{ID: 1, FirstName: "John", LastName: "Doe"},
+				},
+			},
+		}
+	}
+
+	return 1, nil
+}
+
+func (m *testDBRepo) GetRoomBlocks(roomID int) ([]models.RoomRestriction, error) {
+	return []models.RoomRestriction{
+		{
+			ID:            1,
+			StartDate:     time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:       time.Date(2050, 1, 8, 0, 0, 0, 0, time.UTC),
+			RoomID:        roomID,
+			RestrictionID: models.RestrictionOwnerBlock,
+			Reason:        "Painting",
+		},
+	}, nil
+}
+
+// RoomBlocksBetween fails when the range starts at the zero time, like AllReservations
+func (m *testDBRepo) RoomBlocksBetween(start, end time.Time) ([]models.RoomRestriction, error) {
+	if start.IsZero() {
+		return nil, errors.New("err")
+	}
+
+	return []models.RoomRestriction{
+		{
+			ID:            7,
+			StartDate:     start,
+			EndDate:       start.AddDate(0, 0, 2),
+			RoomID:        1,
+			RestrictionID: models.RestrictionOwnerBlock,
+			Reason:        "Owner stay",
+			Room:          models.Room{ID: 1, RoomName: "Test"},
+		},
+	}, nil
+}
+
+// RoomClosuresBetween returns the owner block of RoomBlocksBetween and an external
+// booking of room 2
+func (m *testDBRepo) RoomClosuresBetween(start, end time.Time) ([]models.RoomRestriction, error) {
+	closures, err := m.RoomBlocksBetween(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(closures, models.RoomRestriction{
+		ID:               8,
+		StartDate:        start.AddDate(0, 0, 3),
+		EndDate:          start.AddDate(0, 0, 5),
+		RoomID:           2,
+		RestrictionID:    models.RestrictionExternal,
+		CalendarImportID: 1,
+		UID:              "abc@example.com",
+		Room:             models.Room{ID: 2, RoomName: "Major's Suite"},
+	}), nil
+}
+
+func (m *testDBRepo) DeleteRoomBlock(roomID, id int) error {
+	if id == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) ListRooms() ([]models.Room, error) {
+	return []models.Room{
+		{ID: 1, RoomName: "General's Quarters", RoomURL: "generals-quarters", Capacity: 2, Active: 1},
+		{ID: 3, RoomName: "Closed Suite", RoomURL: "closed-suite", Capacity: 4},
+	}, nil
+}
+
+// CreateRoom keeps the room and its rates so it can be looked up and booked, numbering
+// rooms from 100. It rejects the slug "taken-room" as already used.
+func (m *testDBRepo) CreateRoom(room models.Room, rate models.RoomRate) (int, error) {
+	if room.RoomURL == "taken-room" {
+		return 0, repository.ErrRoomURLTaken
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room.ID = 100 + len(m.created)
+	rate.RoomID = room.ID
+	m.created[room.ID] = createdRoom{room: room, rate: rate}
+
+	return room.ID, nil
+}
+
+// UpdateRoom rejects the slug "taken-room" as already used
+func (m *testDBRepo) UpdateRoom(room models.Room, rate models.RoomRate) error {
+	if room.RoomURL == "taken-room" {
+		return repository.ErrRoomURLTaken
+	}
+	return nil
+}
+
+// DeleteRoom reports that room 2 still has reservations
+func (m *testDBRepo) DeleteRoom(id int) error {
+	if id == 2 {
+		return repository.ErrRoomHasReservations
+	}
+	return nil
+}
+
+// GetRoomPhotos returns two photos for room 2, the first being the cover
+func (m *testDBRepo) GetRoomPhotos(roomID int) ([]models.RoomPhoto, error) {
+	if roomID != 2 {
+		return nil, nil
+	}
+
+	return []models.RoomPhoto{
+		{ID: 1, RoomID: 2, FileName: "room-2-cover", SortOrder: 1, IsCover: 1},
+		{ID: 2, RoomID: 2, FileName: "room-2-bathroom", SortOrder: 2},
+	}, nil
+}
+
+func (m *testDBRepo) InsertRoomPhoto(photo models.RoomPhoto) (int, error) {
+	return 1, nil
+}
+
+// SetRoomCoverPhoto returns sql.ErrNoRows for photo id 3
+func (m *testDBRepo) SetRoomCoverPhoto(roomID, id int) error {
+	if id == 3 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MoveRoomPhoto returns sql.ErrNoRows for photo id 3
+func (m *testDBRepo) MoveRoomPhoto(roomID, id, offset int) error {
+	if id == 3 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteRoomPhoto returns sql.ErrNoRows for photo id 3
+func (m *testDBRepo) DeleteRoomPhoto(roomID, id int) (models.RoomPhoto, error) {
+	if id == 3 {
+		return models.RoomPhoto{}, sql.ErrNoRows
+	}
+	return models.RoomPhoto{ID: id, RoomID: roomID, FileName: fmt.Sprintf("room-%d-photo-%d", roomID, id)}, nil
+}
+
+// GetStayRules returns a default rule for room 1
+func (m *testDBRepo) GetStayRules(roomID int) ([]models.StayRule, error) {
+	if roomID != 1 {
+		return nil, nil
+	}
+
+	return []models.StayRule{
+		{ID: 1, RoomID: 1, MinNights: 2, ClosedToArrival: 1 << time.Sunday},
+	}, nil
+}
+
+func (m *testDBRepo) SaveStayRule(rule models.StayRule) (int, error) {
+	return 1, nil
+}
+
+// DeleteStayRule returns sql.ErrNoRows for rule id 2
+func (m *testDBRepo) DeleteStayRule(roomID, id int) error {
+	if id == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) CreateCalendarFeed(feed models.CalendarFeed) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) ListCalendarFeeds() ([]models.CalendarFeed, error) {
+	return []models.CalendarFeed{
+		{ID: 1, Name: "Owner phone"},
+		{ID: 2, RoomID: 1, Name: "Cleaning team", Room: models.Room{ID: 1, RoomName: "General's Quarters"}},
+	}, nil
+}
+
+// DeleteCalendarFeed returns sql.ErrNoRows for feed id 3
+func (m *testDBRepo) DeleteCalendarFeed(id int) error {
+	if id == 3 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetCalendarFeedByToken accepts "cal_test-property" for a property-wide feed and
+// "cal_test-room" for a feed of room 1
+func (m *testDBRepo) GetCalendarFeedByToken(tokenHash string) (models.CalendarFeed, error) {
+	switch tokenHash {
+	case tokens.HashFeedToken("cal_test-property"):
+		return models.CalendarFeed{ID: 1, Name: "Owner phone"}, nil
+	case tokens.HashFeedToken("cal_test-room"):
+		return models.CalendarFeed{ID: 2, RoomID: 1, Name: "Cleaning team", Room: models.Room{ID: 1, RoomName: "Test"}}, nil
+	}
+
+	return models.CalendarFeed{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) CreateCalendarImport(imp models.CalendarImport) (int, error) {
+	return 1, nil
+}
+
+// GetCalendarImports returns a polled and an upload-only calendar for room 1
+func (m *testDBRepo) GetCalendarImports(roomID int) ([]models.CalendarImport, error) {
+	if roomID != 1 {
+		return nil, nil
+	}
+
+	return []models.CalendarImport{
+		{ID: 1, RoomID: 1, Name: "Channel", URL: "https://channel.example.com/calendar.ics", LastError: "calendar feed returned 404 Not Found"},
+		{ID: 2, RoomID: 1, Name: "Offline"},
+	}, nil
+}
+
+// GetCalendarImport returns sql.ErrNoRows for calendar id 3
+func (m *testDBRepo) GetCalendarImport(roomID, id int) (models.CalendarImport, error) {
+	imports, _ := m.GetCalendarImports(roomID)
+	for _, imp := range imports {
+		if imp.ID == id {
+			return imp, nil
+		}
+	}
+
+	return models.CalendarImport{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) PolledCalendarImports() ([]models.CalendarImport, error) {
+	return nil, nil
+}
+
+// DeleteCalendarImport returns sql.ErrNoRows for calendar id 3
+func (m *testDBRepo) DeleteCalendarImport(roomID, id int) error {
+	if id == 3 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) UpdateCalendarImportStatus(id int, syncedAt time.Time, syncErr string) error {
+	return nil
+}
+
+// SyncExternalBlocks reports every block as added
+func (m *testDBRepo) SyncExternalBlocks(imp models.CalendarImport, blocks []models.RoomRestriction) (models.CalendarSyncResult, error) {
+	return models.CalendarSyncResult{Added: len(blocks)}, nil
+}
+
+// OccupancyReport builds a report from one reservation in room 1. Only rooms 1 and 2 exist.
+func (m *testDBRepo) OccupancyReport(start, end time.Time, roomID int) (models.Report, error) {
+	if roomID > 2 {
+		return models.Report{}, sql.ErrNoRows
+	}
+
+	rooms := []models.Room{
+		{ID: 1, RoomName: "General's Quarters", Active: 1},
+		{ID: 2, RoomName: "Major's Suite", Active: 1},
+	}
+	if roomID != 0 {
+		rooms = rooms[roomID-1 : roomID]
+	}
+
+	reservations := []models.Reservation{
+		{ID: 1, RoomID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 2), Total: 25000, CreatedAt: start.AddDate(0, 0, -10)},
+	}
+
+	report, err := reports.Build(start, end, rooms, reservations, nil)
+	report.RoomID = roomID
+
+	return report, err
+}
+
+// EachReservation yields a pending reservation in room 1 and a confirmed one in
+// room 2, filtered by room and status. Searching for "error" fails.
+func (m *testDBRepo) EachReservation(filter models.ReservationFilter, fn func(res models.Reservation) error) error {
+	if filter.Search == "error" {
+		return errors.New("err")
+	}
+
+	reservations := []models.Reservation{
+		{
+			ID: 1, FirstName: "John", LastName: "Doe", Email: "john@example.com", Phone: "=1+2",
+			StartDate: time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC),
+			RoomID: 1, Room: models.Room{ID: 1, RoomName: "General's Quarters"}, Total: 35000,
+			Adults: 2, Status: string(lifecycle.Pending),
+		},
+		{
+			ID: 2, FirstName: "Jane", LastName: "Roe", Email: "jane@example.com", Phone: "555-0100",
+			StartDate: time.Date(2050, 12, 22, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 12, 24, 0, 0, 0, 0, time.UTC),
+			RoomID: 2, Room: models.Room{ID: 2, RoomName: "Major's Suite"},
+			Adults: 1, Children: 1, Status: string(lifecycle.Confirmed),
+		},
+	}
+
+	for _, res := range reservations {
+		if filter.RoomID != 0 && res.RoomID != filter.RoomID {
+			continue
+		}
+
+		if filter.Status != "" && res.Status != filter.Status {
+			continue
+		}
+
+		if err := fn(res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -2,10 +2,22 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
+	"github.com/mlvieira/bookings/internal/dates"
+	"github.com/mlvieira/bookings/internal/lifecycle"
 	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/pricing"
+	"github.com/mlvieira/bookings/internal/reports"
+	"github.com/mlvieira/bookings/internal/repository"
+	"github.com/mlvieira/bookings/internal/stayrules"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -19,21 +31,287 @@ func (m *mysqlDBRepo) InsertReservation(res models.Reservation) (int, error) {
 		return 0, err
 	}
 
+	lastID, err := insertReservationTx(ctx, tx, res)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return lastID, nil
+}
+
+// InsertRoomRestriction inserts a room restriction in the database
+func (m *mysqlDBRepo) InsertRoomRestriction(res models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = insertRoomRestrictionTx(ctx, tx, res)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// BookRoom inserts a reservation and its room restriction in a single transaction.
+// The room row is locked first, so concurrent bookings of the same room are serialized
+// and availability is checked again right before anything is written.
+func (m *mysqlDBRepo) BookRoom(res models.Reservation) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, err := bookRoomTx(ctx, tx, res)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return lastID, nil
+}
+
+// BookGroup books every reservation of the group in a single transaction, so either
+// all the rooms are booked or none is. It returns the group with its id and the ids
+// of its reservations set.
+func (m *mysqlDBRepo) BookGroup(group models.ReservationGroup) (models.ReservationGroup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return group, err
+	}
+
+	booked, err := bookGroupTx(ctx, tx, group)
+	if err != nil {
+		tx.Rollback()
+		return group, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return group, err
+	}
+
+	return booked, nil
+}
+
+// bookGroupTx locks the rooms of the group in id order, so two checkouts sharing
+// rooms can't deadlock, then writes the group and books each reservation in it
+func bookGroupTx(ctx context.Context, tx *sql.Tx, group models.ReservationGroup) (models.ReservationGroup, error) {
+	roomIDs := make([]int, 0, len(group.Reservations))
+	for _, res := range group.Reservations {
+		if !slices.Contains(roomIDs, res.RoomID) {
+			roomIDs = append(roomIDs, res.RoomID)
+		}
+	}
+	slices.Sort(roomIDs)
+
+	for _, roomID := range roomIDs {
+		if err := lockRoomTx(ctx, tx, roomID); err != nil {
+			return group, err
+		}
+	}
+
+	group.Total = 0
+	for _, res := range group.Reservations {
+		group.Total += res.Total
+	}
+
+	ret, err := tx.ExecContext(ctx, `
+				INSERT INTO
+					reservation_groups
+					(total, created_at, updated_at)
+				VALUES
+					(?, ?, ?)
+			`, group.Total, time.Now(), time.Now())
+	if err != nil {
+		return group, err
+	}
+
+	groupID, err := ret.LastInsertId()
+	if err != nil {
+		return group, err
+	}
+
+	group.ID = int(groupID)
+
+	reservations := make([]models.Reservation, len(group.Reservations))
+	for i, res := range group.Reservations {
+		res.GroupID = group.ID
+
+		res.ID, err = bookRoomTx(ctx, tx, res)
+		if err != nil {
+			return group, err
+		}
+
+		reservations[i] = res
+	}
+
+	group.Reservations = reservations
+
+	return group, nil
+}
+
+// bookRoomTx locks the room, re-validates availability and stay rules and writes the
+// reservation and its restriction
+func bookRoomTx(ctx context.Context, tx *sql.Tx, res models.Reservation) (int, error) {
+	if err := lockRoomTx(ctx, tx, res.RoomID); err != nil {
+		return 0, err
+	}
+
+	if err := checkOccupancyTx(ctx, tx, res.RoomID, res.Guests()); err != nil {
+		return 0, err
+	}
+
+	available, err := roomAvailableTx(ctx, tx, res.StartDate, res.EndDate, res.RoomID, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if !available {
+		return 0, &repository.RoomUnavailableError{
+			RoomID:    res.RoomID,
+			StartDate: res.StartDate,
+			EndDate:   res.EndDate,
+		}
+	}
+
+	if err := checkStayRules(ctx, tx, res.RoomID, res.StartDate, res.EndDate); err != nil {
+		return 0, err
+	}
+
+	lastID, err := insertReservationTx(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = insertRoomRestrictionTx(ctx, tx, models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: lastID,
+		RestrictionID: models.RestrictionReservation,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return lastID, nil
+}
+
+// lockRoomTx takes a row lock on the room until the transaction ends
+func lockRoomTx(ctx context.Context, tx *sql.Tx, roomID int) error {
+	var id int
+
+	row := tx.QueryRowContext(ctx, `
+				SELECT
+					id
+				FROM
+					rooms
+				WHERE
+					id = ?
+				FOR UPDATE
+			`, roomID)
+
+	return row.Scan(&id)
+}
+
+// checkOccupancyTx returns an OccupancyError when the room sleeps fewer than guests
+func checkOccupancyTx(ctx context.Context, tx *sql.Tx, roomID, guests int) error {
+	var capacity int
+
+	row := tx.QueryRowContext(ctx, `
+				SELECT
+					capacity
+				FROM
+					rooms
+				WHERE
+					id = ?
+			`, roomID)
+	if err := row.Scan(&capacity); err != nil {
+		return err
+	}
+
+	if guests > capacity {
+		return &repository.OccupancyError{
+			RoomID:   roomID,
+			Capacity: capacity,
+			Guests:   guests,
+		}
+	}
+
+	return nil
+}
+
+// roomAvailableTx returns true if no restriction overlaps the date range for roomID.
+// The restriction of reservationID is ignored, so a reservation doesn't conflict with
+// itself when it is moved; pass 0 for new reservations.
+func roomAvailableTx(ctx context.Context, tx *sql.Tx, start, end time.Time, roomID, reservationID int) (bool, error) {
+	var numRows int
+
+	row := tx.QueryRowContext(ctx, `
+				SELECT
+					count(id)
+				FROM
+					room_restrictions
+				WHERE 1=1
+				AND	room_id = ?
+				AND ? < end_date
+				AND ? > start_date
+				AND (reservation_id IS NULL OR reservation_id <> ?)
+			`, roomID, start, end, reservationID)
+
+	if err := row.Scan(&numRows); err != nil {
+		return false, err
+	}
+
+	return numRows == 0, nil
+}
+
+// insertReservationTx inserts a reservation using the given transaction
+func insertReservationTx(ctx context.Context, tx *sql.Tx, res models.Reservation) (int, error) {
 	stmt, err := tx.Prepare(`
 				INSERT INTO
 					reservations 
 					(first_name, last_name, email, phone, start_date,
-					end_date, room_id, created_at, updated_at) 
+					end_date, room_id, total, group_id, adults, children,
+					created_at, updated_at) 
 				VALUES
-					(?, ?, ?, ?, ?, ?, ?, ?, ?)
+					(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 				`)
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 
 	defer stmt.Close()
 
+	var groupID sql.NullInt64
+	if res.GroupID != 0 {
+		groupID = sql.NullInt64{Int64: int64(res.GroupID), Valid: true}
+	}
+
 	ret, err := stmt.ExecContext(ctx,
 		res.FirstName,
 		res.LastName,
@@ -42,69 +320,79 @@ func (m *mysqlDBRepo) InsertReservation(res models.Reservation) (int, error) {
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		res.Total,
+		groupID,
+		res.Adults,
+		res.Children,
 		time.Now(),
 		time.Now(),
 	)
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 
-	if err = tx.Commit(); err != nil {
+	lastID, err := ret.LastInsertId()
+	if err != nil {
 		return 0, err
 	}
 
-	lastID, _ := ret.LastInsertId()
-
 	return int(lastID), nil
 }
 
-// InsertRoomRestriction inserts a room restriction in the database
-func (m *mysqlDBRepo) InsertRoomRestriction(res models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	tx, err := m.DB.Begin()
-	if err != nil {
-		return err
-	}
-
+// insertRoomRestrictionTx inserts a room restriction using the given transaction.
+// Restrictions that do not belong to a reservation, like owner blocks, store a NULL
+// reservation_id, and those not imported from a calendar a NULL calendar_import_id.
+func insertRoomRestrictionTx(ctx context.Context, tx *sql.Tx, res models.RoomRestriction) (int, error) {
 	stmt, err := tx.Prepare(`
 				INSERT INTO
 					room_restrictions
-					(start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id)
+					(start_date, end_date, room_id, reservation_id, reason, calendar_import_id, uid,
+					created_at, updated_at, restriction_id)
 				VALUES 
-					(?, ?, ?, ?, ?, ?, ?)
+					(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 				`)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return 0, err
 	}
 
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	var reservationID sql.NullInt64
+	if res.ReservationID != 0 {
+		reservationID = sql.NullInt64{Int64: int64(res.ReservationID), Valid: true}
+	}
+
+	var calendarImportID sql.NullInt64
+	if res.CalendarImportID != 0 {
+		calendarImportID = sql.NullInt64{Int64: int64(res.CalendarImportID), Valid: true}
+	}
+
+	ret, err := stmt.ExecContext(ctx,
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
-		res.ReservationID,
+		reservationID,
+		res.Reason,
+		calendarImportID,
+		res.UID,
 		time.Now(),
 		time.Now(),
 		res.RestrictionID,
 	)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return 0, err
 	}
 
-	if err = tx.Commit(); err != nil {
-		return err
+	lastID, err := ret.LastInsertId()
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return int(lastID), nil
 }
 
-// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false if no availability
+// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false if no availability.
+// A room that is free but excluded by its stay rules returns a repository.StayRuleError.
 func (m *mysqlDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -133,15 +421,26 @@ func (m *mysqlDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, ro
 		return false, nil
 	}
 
-	return numRows == 0, nil
+	if numRows > 0 {
+		return false, nil
+	}
+
+	if err := checkStayRules(ctx, m.DB, roomID, start, end); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 // SearchAvailabilityForAllRooms return a slice of available rooms, if any, for given date range
-func (m *mysqlDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+// that sleep at least guests. Rooms that are free but excluded by their stay rules are returned
+// as violations instead.
+func (m *mysqlDBRepo) SearchAvailabilityForAllRooms(start, end time.Time, guests int) ([]models.Room, []models.StayRuleViolation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var rooms []models.Room
+	var violations []models.StayRuleViolation
 
 	stmt, err := m.DB.Prepare(`
 				SELECT
@@ -149,10 +448,20 @@ func (m *mysqlDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]mod
 					, r.room_name
 					, r.room_description
 					, r.room_url
+					, r.capacity
+					, r.active
+					, coalesce((
+						SELECT p.file_name FROM room_photos p
+						WHERE p.room_id = r.id
+						ORDER BY p.is_cover DESC, p.sort_order, p.id
+						LIMIT 1
+					), '')
 				FROM
 					rooms r
 				WHERE
-					r.id NOT IN (
+					r.active = 1
+					AND r.capacity >= ?
+					AND r.id NOT IN (
 						SELECT
 							rr.room_id
 						FROM
@@ -163,32 +472,54 @@ func (m *mysqlDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]mod
 					)
 				`)
 	if err != nil {
-		return rooms, err
+		return rooms, violations, err
 	}
 
 	defer stmt.Close()
 
-	rows, err := stmt.QueryContext(ctx, start, end)
+	rows, err := stmt.QueryContext(ctx, guests, start, end)
 	if err != nil {
-		return rooms, err
+		return rooms, violations, err
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
 		var room models.Room
-		err := rows.Scan(&room.ID, &room.RoomName, &room.RoomDescription, &room.RoomURL)
+		err := rows.Scan(&room.ID, &room.RoomName, &room.RoomDescription, &room.RoomURL, &room.Capacity, &room.Active, &room.CoverPhoto)
 		if err != nil {
-			return rooms, err
+			return rooms, violations, err
 		}
 
 		rooms = append(rooms, room)
 	}
 
 	if err = rows.Err(); err != nil {
-		return rooms, err
+		return rooms, violations, err
 	}
 
-	return rooms, nil
+	rules, err := queryStayRules(ctx, m.DB, "")
+	if err != nil {
+		return rooms, violations, err
+	}
+
+	byRoom := make(map[int][]models.StayRule)
+	for _, rule := range rules {
+		byRoom[rule.RoomID] = append(byRoom[rule.RoomID], rule)
+	}
+
+	allowed := rooms[:0]
+	for _, room := range rooms {
+		if v := stayrules.Check(byRoom[room.ID], start, end, time.Now()); v != nil {
+			v.RoomName = room.RoomName
+			violations = append(violations, *v)
+			continue
+		}
+
+		allowed = append(allowed, room)
+	}
 
+	return allowed, violations, nil
 }
 
 // GetRoomByID gets a room by id
@@ -202,6 +533,12 @@ func (m *mysqlDBRepo) GetRoomByID(id int) (models.Room, error) {
 				SELECT
 					id
 					, room_name
+					, room_description
+					, room_url
+					, capacity
+					, active
+					, created_at
+					, updated_at
 				FROM
 					rooms
 				WHERE
@@ -214,7 +551,7 @@ func (m *mysqlDBRepo) GetRoomByID(id int) (models.Room, error) {
 	defer stmt.Close()
 
 	row := stmt.QueryRowContext(ctx, id)
-	err = row.Scan(&room.ID, &room.RoomName)
+	err = row.Scan(&room.ID, &room.RoomName, &room.RoomDescription, &room.RoomURL, &room.Capacity, &room.Active, &room.CreatedAt, &room.UpdatedAt)
 	if err != nil {
 		return room, err
 	}
@@ -235,6 +572,14 @@ func (m *mysqlDBRepo) GetRoomByUrl(url string) (models.Room, error) {
 					, room_name
 					, room_description
 					, room_url
+					, capacity
+					, active
+					, coalesce((
+						SELECT p.file_name FROM room_photos p
+						WHERE p.room_id = rooms.id
+						ORDER BY p.is_cover DESC, p.sort_order, p.id
+						LIMIT 1
+					), '')
 				FROM
 					rooms
 				WHERE
@@ -247,7 +592,7 @@ func (m *mysqlDBRepo) GetRoomByUrl(url string) (models.Room, error) {
 	defer stmt.Close()
 
 	row := stmt.QueryRowContext(ctx, url)
-	err = row.Scan(&room.ID, &room.RoomName, &room.RoomDescription, &room.RoomURL)
+	err = row.Scan(&room.ID, &room.RoomName, &room.RoomDescription, &room.RoomURL, &room.Capacity, &room.Active, &room.CoverPhoto)
 	if err != nil {
 		return room, err
 	}
@@ -420,7 +765,8 @@ func (m *mysqlDBRepo) AllReservations(start, end *time.Time) ([]models.Reservati
 			, r.phone
 			, r.start_date
 			, r.end_date
-			, r.processed
+			, r.status
+			, r.total
 			, r.room_id
 			, r.created_at
 			, r.updated_at
@@ -463,7 +809,8 @@ func (m *mysqlDBRepo) AllReservations(start, end *time.Time) ([]models.Reservati
 			&i.Phone,
 			&i.StartDate,
 			&i.EndDate,
-			&i.Processed,
+			&i.Status,
+			&i.Total,
 			&i.RoomID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
@@ -484,74 +831,210 @@ func (m *mysqlDBRepo) AllReservations(start, end *time.Time) ([]models.Reservati
 	return reservations, nil
 }
 
-// AllNewReservations returns a slice of all new reservations
-func (m *mysqlDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// exportTimeout bounds streaming reservations, which takes longer than a page query
+const exportTimeout = 2 * time.Minute
+
+// EachReservation calls fn with every reservation matching the filter, ordered by
+// arrival, as rows are read, so exports don't hold every reservation in memory.
+// It stops at the first error fn returns.
+func (m *mysqlDBRepo) EachReservation(filter models.ReservationFilter, fn func(res models.Reservation) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
 	defer cancel()
 
-	var reservations []models.Reservation
+	clauses, args := reservationFilterClauses(filter)
 
-	stmt, err := m.DB.Prepare(`
-		SELECT
-			r.id
-			, r.first_name
-			, r.last_name
-			, r.email
-			, r.phone
-			, r.start_date
-			, r.end_date
-			, r.room_id
-			, r.created_at
-			, r.updated_at
-			, rm.id
-			, rm.room_name
-		FROM
-			reservations r
-		LEFT JOIN
-			rooms rm on r.room_id = rm.id
-		WHERE
-			r.processed = 0
-		ORDER BY r.start_date asc
-	`)
+	rows, err := m.DB.QueryContext(ctx, reservationListQuery+clauses+`
+		ORDER BY r.start_date ASC, r.id ASC
+	`, args...)
 	if err != nil {
-		return reservations, err
+		return err
 	}
 
-	defer stmt.Close()
+	defer rows.Close()
 
-	rows, err := stmt.QueryContext(ctx)
-	if err != nil {
-		return reservations, err
+	for rows.Next() {
+		res, err := scanReservationRow(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(res); err != nil {
+			return err
+		}
 	}
 
-	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
-		if err != nil {
-			return reservations, err
+	return rows.Err()
+}
+
+// reservationListQuery selects reservations r with their room rm for the admin lists
+// and exports, for scanReservationRow. Filter clauses and ORDER BY follow it.
+const reservationListQuery = `
+	SELECT
+		r.id
+		, r.first_name
+		, r.last_name
+		, r.email
+		, r.phone
+		, r.start_date
+		, r.end_date
+		, r.status
+		, r.total
+		, r.adults
+		, r.children
+		, r.room_id
+		, r.created_at
+		, r.updated_at
+		, coalesce(rm.id, 0)
+		, coalesce(rm.room_name, '')
+	FROM
+		reservations r
+	LEFT JOIN
+		rooms rm ON r.room_id = rm.id
+	WHERE 1=1
+`
+
+// scanReservationRow scans a row selected by reservationListQuery
+func scanReservationRow(rows *sql.Rows) (models.Reservation, error) {
+	var i models.Reservation
+	err := rows.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.StartDate,
+		&i.EndDate,
+		&i.Status,
+		&i.Total,
+		&i.Adults,
+		&i.Children,
+		&i.RoomID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Room.ID,
+		&i.Room.RoomName,
+	)
+
+	return i, err
+}
+
+// reservationFilterClauses turns a filter into AND clauses on reservations r
+func reservationFilterClauses(filter models.ReservationFilter) (string, []any) {
+	var clauses strings.Builder
+	var args []any
+
+	if !filter.Start.IsZero() {
+		clauses.WriteString(" AND r.end_date > ?")
+		args = append(args, filter.Start)
+	}
+
+	if !filter.End.IsZero() {
+		clauses.WriteString(" AND r.start_date < ?")
+		args = append(args, filter.End)
+	}
+
+	if filter.RoomID != 0 {
+		clauses.WriteString(" AND r.room_id = ?")
+		args = append(args, filter.RoomID)
+	}
+
+	if filter.Status != "" {
+		clauses.WriteString(" AND r.status = ?")
+		args = append(args, filter.Status)
+	}
+
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		like := "%" + likeEscaper.Replace(search) + "%"
+
+		clauses.WriteString(` AND (concat(r.first_name, ' ', r.last_name) LIKE ? OR r.email LIKE ? OR r.phone LIKE ?`)
+		args = append(args, like, like, like)
+
+		if id, err := strconv.Atoi(search); err == nil {
+			clauses.WriteString(" OR r.id = ?")
+			args = append(args, id)
 		}
 
-		reservations = append(reservations, i)
+		clauses.WriteString(")")
 	}
 
-	if err = rows.Err(); err != nil {
-		return reservations, err
+	return clauses.String(), args
+}
+
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// reservationSorts maps the sorts of models.ReservationSorts to ORDER BY columns
+var reservationSorts = map[string][]string{
+	"id":         {"r.id"},
+	"name":       {"r.last_name", "r.first_name"},
+	"room":       {"rm.room_name", "r.start_date"},
+	"start_date": {"r.start_date"},
+	"end_date":   {"r.end_date"},
+	"created_at": {"r.created_at"},
+}
+
+// SearchReservations returns one page of the reservations matching the query and the
+// number of matching reservations. Unknown sorts order by arrival.
+func (m *mysqlDBRepo) SearchReservations(query models.ReservationQuery) (models.ReservationPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	page := models.ReservationPage{
+		Page:     max(query.Page, 1),
+		PageSize: query.PageSize,
 	}
 
-	return reservations, nil
+	if page.PageSize <= 0 {
+		page.PageSize = models.DefaultPageSize
+	}
+
+	clauses, args := reservationFilterClauses(query.ReservationFilter)
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT
+			count(*)
+		FROM
+			reservations r
+		WHERE 1=1
+	`+clauses, args...)
+
+	if err := row.Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	columns, ok := reservationSorts[query.Sort]
+	if !ok {
+		columns = reservationSorts["start_date"]
+	}
+
+	dir := " ASC"
+	if query.Desc {
+		dir = " DESC"
+	}
+
+	// the id breaks ties so rows don't move between pages
+	orderBy := strings.Join(slices.Concat(columns, []string{"r.id"}), dir+", ") + dir
+
+	rows, err := m.DB.QueryContext(ctx, reservationListQuery+clauses+`
+		ORDER BY `+orderBy+`
+		LIMIT ? OFFSET ?
+	`, append(args, page.PageSize, (page.Page-1)*page.PageSize)...)
+	if err != nil {
+		return page, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		res, err := scanReservationRow(rows)
+		if err != nil {
+			return page, err
+		}
+
+		page.Reservations = append(page.Reservations, res)
+	}
+
+	return page, rows.Err()
 }
 
 // GetReservationById return reservation associated by ID
@@ -573,9 +1056,19 @@ func (m *mysqlDBRepo) GetReservationById(id int) (models.Reservation, error) {
 			, r.room_id
 			, r.created_at
 			, r.updated_at
-			, r.processed
+			, r.total
+			, r.status
+			, r.confirmed_at
+			, r.checked_in_at
+			, r.checked_out_at
+			, r.cancelled_at
+			, r.no_show_at
+			, coalesce(r.group_id, 0)
+			, r.adults
+			, r.children
 			, rm.id
 			, rm.room_name
+			, rm.capacity
 		FROM
 			reservations r
 		LEFT JOIN rooms rm ON r.room_id = rm.id
@@ -588,6 +1081,8 @@ func (m *mysqlDBRepo) GetReservationById(id int) (models.Reservation, error) {
 
 	defer stmt.Close()
 
+	var confirmedAt, checkedInAt, checkedOutAt, cancelledAt, noShowAt sql.NullTime
+
 	row := stmt.QueryRowContext(ctx, id)
 	err = row.Scan(
 		&reservation.ID,
@@ -600,17 +1095,62 @@ func (m *mysqlDBRepo) GetReservationById(id int) (models.Reservation, error) {
 		&reservation.RoomID,
 		&reservation.CreatedAt,
 		&reservation.UpdatedAt,
-		&reservation.Processed,
+		&reservation.Total,
+		&reservation.Status,
+		&confirmedAt,
+		&checkedInAt,
+		&checkedOutAt,
+		&cancelledAt,
+		&noShowAt,
+		&reservation.GroupID,
+		&reservation.Adults,
+		&reservation.Children,
 		&reservation.Room.ID,
 		&reservation.Room.RoomName,
+		&reservation.Room.Capacity,
 	)
 	if err != nil {
 		return reservation, err
 	}
 
+	reservation.ConfirmedAt = confirmedAt.Time
+	reservation.CheckedInAt = checkedInAt.Time
+	reservation.CheckedOutAt = checkedOutAt.Time
+	reservation.CancelledAt = cancelledAt.Time
+	reservation.NoShowAt = noShowAt.Time
+
 	return reservation, nil
 }
 
+// GetGroupReservations returns the reservations booked together in a group, ordered by arrival
+func (m *mysqlDBRepo) GetGroupReservations(groupID int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	rows, err := m.DB.QueryContext(ctx, reservationListQuery+`
+		AND r.group_id = ?
+		ORDER BY r.start_date ASC, r.id ASC
+	`, groupID)
+	if err != nil {
+		return reservations, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		res, err := scanReservationRow(rows)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, res)
+	}
+
+	return reservations, rows.Err()
+}
+
 // UpdateReservation updates user information in the database
 func (m *mysqlDBRepo) UpdateReservation(res models.Reservation) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -629,6 +1169,8 @@ func (m *mysqlDBRepo) UpdateReservation(res models.Reservation) error {
 					, last_name = ?
 					, email = ?
 					, phone = ?
+					, adults = ?
+					, children = ?
 					, updated_at = ?
 				WHERE
 					id = ?
@@ -645,6 +1187,8 @@ func (m *mysqlDBRepo) UpdateReservation(res models.Reservation) error {
 		res.LastName,
 		res.Email,
 		res.Phone,
+		res.Adults,
+		res.Children,
 		time.Now(),
 		res.ID,
 	)
@@ -697,72 +1241,240 @@ func (m *mysqlDBRepo) DeleteReservation(id int) error {
 	return nil
 }
 
-// UpdateProcessedForReservation updates processed for a reservation ID
-func (m *mysqlDBRepo) UpdateProcessedForReservation(id, processed int) error {
+// RescheduleReservation moves a reservation to the room, dates and total of res and
+// moves its room restriction along in the same transaction. The reservation and the
+// target room are locked, and the room must be free for the new dates apart from the
+// reservation's own restriction.
+func (m *mysqlDBRepo) RescheduleReservation(res models.Reservation) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	tx, err := m.DB.Begin()
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	stmt, err := tx.Prepare(`
-				UPDATE	
+	if err = rescheduleReservationTx(ctx, tx, res); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rescheduleReservationTx checks the reservation's status and that its stay hasn't
+// started, that its party fits the room and the room's availability and updates the
+// reservation and its restriction
+func rescheduleReservationTx(ctx context.Context, tx *sql.Tx, res models.Reservation) error {
+	var status string
+	var startDate time.Time
+	var adults, children int
+
+	row := tx.QueryRowContext(ctx, `
+				SELECT
+					status
+					, start_date
+					, adults
+					, children
+				FROM
+					reservations
+				WHERE
+					id = ?
+				FOR UPDATE
+			`, res.ID)
+	if err := row.Scan(&status, &startDate, &adults, &children); err != nil {
+		return err
+	}
+
+	if !lifecycle.CanReschedule(status, startDate, time.Now()) {
+		return repository.ErrNotReschedulable
+	}
+
+	if err := lockRoomTx(ctx, tx, res.RoomID); err != nil {
+		return err
+	}
+
+	if err := checkOccupancyTx(ctx, tx, res.RoomID, adults+children); err != nil {
+		return err
+	}
+
+	available, err := roomAvailableTx(ctx, tx, res.StartDate, res.EndDate, res.RoomID, res.ID)
+	if err != nil {
+		return err
+	}
+
+	if !available {
+		return &repository.RoomUnavailableError{
+			RoomID:    res.RoomID,
+			StartDate: res.StartDate,
+			EndDate:   res.EndDate,
+		}
+	}
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+				UPDATE
 					reservations
 				SET
-					processed = ?
+					room_id = ?
+					, start_date = ?
+					, end_date = ?
+					, total = ?
 					, updated_at = ?
 				WHERE
 					id = ?
-			`)
+			`, res.RoomID, res.StartDate, res.EndDate, res.Total, now, res.ID)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	defer stmt.Close()
+	_, err = tx.ExecContext(ctx, `
+				UPDATE
+					room_restrictions
+				SET
+					room_id = ?
+					, start_date = ?
+					, end_date = ?
+					, updated_at = ?
+				WHERE
+					reservation_id = ?
+			`, res.RoomID, res.StartDate, res.EndDate, now, res.ID)
+
+	return err
+}
+
+// statusTimestamps names the column recording when a reservation moved to each status
+var statusTimestamps = map[lifecycle.Status]string{
+	lifecycle.Confirmed:  "confirmed_at",
+	lifecycle.CheckedIn:  "checked_in_at",
+	lifecycle.CheckedOut: "checked_out_at",
+	lifecycle.Cancelled:  "cancelled_at",
+	lifecycle.NoShow:     "no_show_at",
+}
 
-	_, err = stmt.ExecContext(ctx, processed, time.Now(), id)
+// TransitionReservation moves a reservation to another status and records when. The
+// reservation row is locked so concurrent changes are checked against the latest
+// status. Cancelled and no-show reservations release their room restriction.
+func (m *mysqlDBRepo) TransitionReservation(id int, to lifecycle.Status) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	column, ok := statusTimestamps[to]
+	if !ok {
+		return fmt.Errorf("%w to %s", lifecycle.ErrTransition, to)
+	}
+
+	tx, err := m.DB.Begin()
 	if err != nil {
+		return err
+	}
+
+	var from string
+
+	row := tx.QueryRowContext(ctx, `
+				SELECT
+					status
+				FROM
+					reservations
+				WHERE
+					id = ?
+				FOR UPDATE
+			`, id)
+	if err = row.Scan(&from); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	if err = tx.Commit(); err != nil {
+	if err = lifecycle.Status(from).Transition(to); err != nil {
+		tx.Rollback()
 		return err
 	}
 
-	return nil
+	now := time.Now()
+
+	// column comes from statusTimestamps, never from the caller
+	_, err = tx.ExecContext(ctx, `
+				UPDATE
+					reservations
+				SET
+					status = ?
+					, `+column+` = ?
+					, updated_at = ?
+				WHERE
+					id = ?
+			`, string(to), now, now, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if to.ReleasesRoom() {
+		_, err = tx.ExecContext(ctx, `
+					DELETE FROM
+						room_restrictions
+					WHERE
+						reservation_id = ?
+				`, id)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
-// GetAllRooms gets all rooms registred
+// GetAllRooms gets the active rooms guests can book
 func (m *mysqlDBRepo) GetAllRooms(limit int) ([]models.Room, error) {
+	return m.queryRooms(`
+		WHERE
+			active = 1
+		ORDER BY
+			id
+		LIMIT ?
+	`, limit)
+}
+
+// ListRooms returns every room, including inactive ones, for the admin area
+func (m *mysqlDBRepo) ListRooms() ([]models.Room, error) {
+	return m.queryRooms(`
+		ORDER BY
+			room_name, id
+	`)
+}
+
+// queryRooms selects rooms using the given WHERE/ORDER BY/LIMIT clauses
+func (m *mysqlDBRepo) queryRooms(clauses string, args ...any) ([]models.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var rooms []models.Room
 
-	stmt, err := m.DB.Prepare(`
-				SELECT
-					id
-					, room_name
-					, room_description
-					, room_url
-				FROM
-					rooms
-				LIMIT ?
-			`)
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT
+			id
+			, room_name
+			, room_description
+			, room_url
+			, capacity
+			, active
+			, coalesce((
+				SELECT p.file_name FROM room_photos p
+				WHERE p.room_id = rooms.id
+				ORDER BY p.is_cover DESC, p.sort_order, p.id
+				LIMIT 1
+			), '')
+			, created_at
+			, updated_at
+		FROM
+			rooms
+	`+clauses, args...)
 	if err != nil {
 		return rooms, err
 	}
 
-	defer stmt.Close()
-
-	rows, err := stmt.QueryContext(ctx, limit)
-	if err != nil {
-		return rooms, err
-	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var r models.Room
@@ -771,6 +1483,11 @@ func (m *mysqlDBRepo) GetAllRooms(limit int) ([]models.Room, error) {
 			&r.RoomName,
 			&r.RoomDescription,
 			&r.RoomURL,
+			&r.Capacity,
+			&r.Active,
+			&r.CoverPhoto,
+			&r.CreatedAt,
+			&r.UpdatedAt,
 		)
 		if err != nil {
 			return rooms, err
@@ -786,6 +1503,95 @@ func (m *mysqlDBRepo) GetAllRooms(limit int) ([]models.Room, error) {
 	return rooms, nil
 }
 
+// QuoteStay prices a stay in a room using its base rate and any seasonal overrides
+func (m *mysqlDBRepo) QuoteStay(roomID int, start, end time.Time) (models.Quote, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rate models.RoomRate
+	var seasons []models.SeasonalRate
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT
+			id
+			, room_id
+			, base_rate
+			, weekend_rate
+			, created_at
+			, updated_at
+		FROM
+			room_rates
+		WHERE
+			room_id = ?
+	`, roomID)
+
+	err := row.Scan(
+		&rate.ID,
+		&rate.RoomID,
+		&rate.BaseRate,
+		&rate.WeekendRate,
+		&rate.CreatedAt,
+		&rate.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Quote{}, repository.ErrNoRoomRates
+	}
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT
+			id
+			, room_id
+			, season_name
+			, start_date
+			, end_date
+			, base_rate
+			, weekend_rate
+			, created_at
+			, updated_at
+		FROM
+			seasonal_rates
+		WHERE 1=1
+		AND room_id = ?
+		AND start_date < ?
+		AND end_date >= ?
+		ORDER BY start_date ASC
+	`, roomID, end, start)
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.SeasonalRate
+		err := rows.Scan(
+			&s.ID,
+			&s.RoomID,
+			&s.SeasonName,
+			&s.StartDate,
+			&s.EndDate,
+			&s.BaseRate,
+			&s.WeekendRate,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+		)
+		if err != nil {
+			return models.Quote{}, err
+		}
+
+		seasons = append(seasons, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return models.Quote{}, err
+	}
+
+	return pricing.Quote(rate, seasons, start, end)
+}
+
 // CreateUser creates a user
 func (m *mysqlDBRepo) CreateUser(user models.User) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -926,3 +1732,1878 @@ func (m *mysqlDBRepo) DeleteUser(id int) error {
 
 	return nil
 }
+
+// CreateAPIToken stores a new personal API token for a user
+func (m *mysqlDBRepo) CreateAPIToken(token models.APIToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt, err := m.DB.Prepare(`
+		INSERT INTO
+			api_tokens
+			(user_id, name, token_hash, created_at, updated_at)
+		VALUES
+			(?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	defer stmt.Close()
+
+	ret, err := stmt.ExecContext(ctx,
+		token.UserID,
+		token.Name,
+		token.TokenHash,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, _ := ret.LastInsertId()
+
+	return int(lastID), nil
+}
+
+// ListAPITokens returns the personal API tokens of a user, newest first
+func (m *mysqlDBRepo) ListAPITokens(userID int) ([]models.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var apiTokens []models.APIToken
+
+	stmt, err := m.DB.Prepare(`
+		SELECT
+			id
+			, user_id
+			, name
+			, last_used_at
+			, created_at
+			, updated_at
+		FROM
+			api_tokens
+		WHERE
+			user_id = ?
+		ORDER BY
+			created_at DESC
+	`)
+	if err != nil {
+		return apiTokens, err
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return apiTokens, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.APIToken
+		var lastUsed sql.NullTime
+
+		err := rows.Scan(
+			&t.ID,
+			&t.UserID,
+			&t.Name,
+			&lastUsed,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return apiTokens, err
+		}
+
+		t.LastUsedAt = lastUsed.Time
+		apiTokens = append(apiTokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return apiTokens, err
+	}
+
+	return apiTokens, nil
+}
+
+// DeleteAPIToken revokes a personal API token belonging to a user
+func (m *mysqlDBRepo) DeleteAPIToken(userID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ret, err := m.DB.ExecContext(ctx, `
+		DELETE FROM
+			api_tokens
+		WHERE
+			id = ? AND user_id = ?
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetUserByAPIToken returns the owner of a personal API token and records when it was used
+func (m *mysqlDBRepo) GetUserByAPIToken(tokenHash string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var u models.User
+	var tokenID int
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT
+			t.id
+			, u.id
+			, u.first_name
+			, u.last_name
+			, u.email
+			, u.access_level
+			, u.created_at
+			, u.updated_at
+		FROM
+			api_tokens t
+			INNER JOIN users u ON (u.id = t.user_id)
+		WHERE
+			t.token_hash = ?
+	`, tokenHash)
+
+	err := row.Scan(
+		&tokenID,
+		&u.ID,
+		&u.FirstName,
+		&u.LastName,
+		&u.Email,
+		&u.AccessLevel,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
+	if err != nil {
+		return u, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE
+			api_tokens
+		SET
+			last_used_at = ?
+		WHERE
+			id = ?
+	`, time.Now(), tokenID)
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+// EnqueueMail stores an email in the outbox so the mail worker can deliver it
+func (m *mysqlDBRepo) EnqueueMail(msg models.MailData) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	ret, err := m.DB.ExecContext(ctx, `
+		INSERT INTO
+			mail_outbox
+			(to_address, from_address, subject, content, text_content, template,
+			status, attempts, next_attempt_at, created_at, updated_at)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?)
+	`,
+		msg.To,
+		msg.From,
+		msg.Subject,
+		msg.Content,
+		msg.PlainContent,
+		msg.Template,
+		models.OutboxQueued,
+		now,
+		now,
+		now,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, _ := ret.LastInsertId()
+
+	return int(lastID), nil
+}
+
+// DueOutboxMessages returns queued emails whose next attempt is due, oldest first
+func (m *mysqlDBRepo) DueOutboxMessages(now time.Time, limit int) ([]models.OutboxMessage, error) {
+	return m.queryOutbox(`
+		WHERE
+			status = ? AND next_attempt_at <= ?
+		ORDER BY
+			next_attempt_at, id
+		LIMIT ?
+	`, models.OutboxQueued, now, limit)
+}
+
+// ListOutboxMessages returns the most recent outbox emails, optionally filtered by status
+func (m *mysqlDBRepo) ListOutboxMessages(status string, limit int) ([]models.OutboxMessage, error) {
+	if status == "" {
+		return m.queryOutbox(`
+			ORDER BY
+				id DESC
+			LIMIT ?
+		`, limit)
+	}
+
+	return m.queryOutbox(`
+		WHERE
+			status = ?
+		ORDER BY
+			id DESC
+		LIMIT ?
+	`, status, limit)
+}
+
+// queryOutbox selects outbox emails using the given WHERE/ORDER BY/LIMIT clauses
+func (m *mysqlDBRepo) queryOutbox(clauses string, args ...any) ([]models.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var messages []models.OutboxMessage
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT
+			id
+			, to_address
+			, from_address
+			, subject
+			, content
+			, text_content
+			, template
+			, status
+			, attempts
+			, last_error
+			, next_attempt_at
+			, sent_at
+			, created_at
+			, updated_at
+		FROM
+			mail_outbox
+	`+clauses, args...)
+	if err != nil {
+		return messages, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg models.OutboxMessage
+		var lastError, plainContent sql.NullString
+		var sentAt sql.NullTime
+
+		err := rows.Scan(
+			&msg.ID,
+			&msg.Mail.To,
+			&msg.Mail.From,
+			&msg.Mail.Subject,
+			&msg.Mail.Content,
+			&plainContent,
+			&msg.Mail.Template,
+			&msg.Status,
+			&msg.Attempts,
+			&lastError,
+			&msg.NextAttemptAt,
+			&sentAt,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+		)
+		if err != nil {
+			return messages, err
+		}
+
+		msg.Mail.PlainContent = plainContent.String
+		msg.LastError = lastError.String
+		msg.SentAt = sentAt.Time
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return messages, err
+	}
+
+	return messages, nil
+}
+
+// UpdateOutboxMessage records the outcome of a delivery attempt
+func (m *mysqlDBRepo) UpdateOutboxMessage(msg models.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var sentAt sql.NullTime
+	if !msg.SentAt.IsZero() {
+		sentAt = sql.NullTime{Time: msg.SentAt, Valid: true}
+	}
+
+	var lastError sql.NullString
+	if msg.LastError != "" {
+		lastError = sql.NullString{String: msg.LastError, Valid: true}
+	}
+
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE
+			mail_outbox
+		SET
+			status = ?
+			, attempts = ?
+			, last_error = ?
+			, next_attempt_at = ?
+			, sent_at = ?
+			, updated_at = ?
+		WHERE
+			id = ?
+	`,
+		msg.Status,
+		msg.Attempts,
+		lastError,
+		msg.NextAttemptAt,
+		sentAt,
+		time.Now(),
+		msg.ID,
+	)
+
+	return err
+}
+
+// RequeueOutboxMessage schedules an email for immediate delivery with a fresh attempt count
+func (m *mysqlDBRepo) RequeueOutboxMessage(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	ret, err := m.DB.ExecContext(ctx, `
+		UPDATE
+			mail_outbox
+		SET
+			status = ?
+			, attempts = 0
+			, last_error = NULL
+			, next_attempt_at = ?
+			, updated_at = ?
+		WHERE
+			id = ?
+	`, models.OutboxQueued, now, now, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// InsertRoomBlock closes a room for an owner block or maintenance. The room is locked
+// while overlapping reservations and blocks are looked up, and a DatesConflictError
+// listing them is returned instead of writing the block.
+func (m *mysqlDBRepo) InsertRoomBlock(block models.RoomRestriction) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, err := insertRoomBlockTx(ctx, tx, block)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return lastID, nil
+}
+
+// insertRoomBlockTx locks the room, checks for conflicts and writes the block
+func insertRoomBlockTx(ctx context.Context, tx *sql.Tx, block models.RoomRestriction) (int, error) {
+	if err := lockRoomTx(ctx, tx, block.RoomID); err != nil {
+		return 0, err
+	}
+
+	conflicts, err := queryRoomRestrictions(ctx, tx, `
+		AND rr.room_id = ?
+		AND ? < rr.end_date
+		AND ? > rr.start_date
+	`, block.RoomID, block.StartDate, block.EndDate)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(conflicts) > 0 {
+		return 0, &repository.DatesConflictError{
+			RoomID:    block.RoomID,
+			StartDate: block.StartDate,
+			EndDate:   block.EndDate,
+			Conflicts: conflicts,
+		}
+	}
+
+	block.ReservationID = 0
+	block.RestrictionID = models.RestrictionOwnerBlock
+
+	return insertRoomRestrictionTx(ctx, tx, block)
+}
+
+// GetRoomBlocks returns the owner blocks of a room that have not ended yet, soonest first
+func (m *mysqlDBRepo) GetRoomBlocks(roomID int) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryRoomRestrictions(ctx, m.DB, `
+		AND rr.restriction_id = ?
+		AND rr.room_id = ?
+		AND rr.end_date > ?
+	`, models.RestrictionOwnerBlock, roomID, dates.TruncateDay(time.Now()))
+}
+
+// RoomBlocksBetween returns the owner blocks of every room overlapping the date range
+func (m *mysqlDBRepo) RoomBlocksBetween(start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryRoomRestrictions(ctx, m.DB, `
+		AND rr.restriction_id = ?
+		AND rr.end_date > ?
+		AND rr.start_date < ?
+	`, models.RestrictionOwnerBlock, start, end)
+}
+
+// RoomClosuresBetween returns the owner blocks and imported external bookings of
+// every room overlapping the date range
+func (m *mysqlDBRepo) RoomClosuresBetween(start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryRoomRestrictions(ctx, m.DB, `
+		AND rr.restriction_id IN (?, ?)
+		AND rr.end_date > ?
+		AND rr.start_date < ?
+	`, models.RestrictionOwnerBlock, models.RestrictionExternal, start, end)
+}
+
+// DeleteRoomBlock removes an owner block from a room. It returns sql.ErrNoRows when
+// the room has no such block.
+func (m *mysqlDBRepo) DeleteRoomBlock(roomID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ret, err := m.DB.ExecContext(ctx, `
+		DELETE FROM
+			room_restrictions
+		WHERE
+			id = ?
+			AND room_id = ?
+			AND restriction_id = ?
+	`, id, roomID, models.RestrictionOwnerBlock)
+	if err != nil {
+		return err
+	}
+
+	affected, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryRoomRestrictions selects room restrictions with their room, restriction and
+// reservation, filtered by the given AND clauses and ordered by start date
+func queryRoomRestrictions(ctx context.Context, q queryer, clauses string, args ...any) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT
+			rr.id
+			, rr.start_date
+			, rr.end_date
+			, rr.room_id
+			, rr.reservation_id
+			, rr.restriction_id
+			, rr.reason
+			, rr.calendar_import_id
+			, rr.uid
+			, rr.created_at
+			, rr.updated_at
+			, rm.room_name
+			, rs.restriction_name
+			, coalesce(r.first_name, '')
+			, coalesce(r.last_name, '')
+		FROM
+			room_restrictions rr
+		LEFT JOIN
+			rooms rm ON rr.room_id = rm.id
+		LEFT JOIN
+			restrictions rs ON rr.restriction_id = rs.id
+		LEFT JOIN
+			reservations r ON rr.reservation_id = r.id
+		WHERE 1=1
+	`+clauses+`
+		ORDER BY
+			rr.start_date, rr.id
+	`, args...)
+	if err != nil {
+		return restrictions, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var rr models.RoomRestriction
+		var reservationID, calendarImportID sql.NullInt64
+
+		err := rows.Scan(
+			&rr.ID,
+			&rr.StartDate,
+			&rr.EndDate,
+			&rr.RoomID,
+			&reservationID,
+			&rr.RestrictionID,
+			&rr.Reason,
+			&calendarImportID,
+			&rr.UID,
+			&rr.CreatedAt,
+			&rr.UpdatedAt,
+			&rr.Room.RoomName,
+			&rr.Restriction.RestrictionName,
+			&rr.Reservation.FirstName,
+			&rr.Reservation.LastName,
+		)
+		if err != nil {
+			return restrictions, err
+		}
+
+		rr.ReservationID = int(reservationID.Int64)
+		rr.CalendarImportID = int(calendarImportID.Int64)
+		rr.Room.ID = rr.RoomID
+		rr.Reservation.ID = rr.ReservationID
+		rr.Restriction.ID = rr.RestrictionID
+		restrictions = append(restrictions, rr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
+
+// CreateRoom inserts a room along with its nightly rates, so it can be booked right
+// away. It returns repository.ErrRoomURLTaken when another room already uses the URL slug.
+func (m *mysqlDBRepo) CreateRoom(room models.Room, rate models.RoomRate) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	taken, err := m.roomURLTaken(ctx, room.RoomURL, 0)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, repository.ErrRoomURLTaken
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	ret, err := tx.ExecContext(ctx, `
+		INSERT INTO
+			rooms
+			(room_name, room_description, room_url, capacity, active, created_at, updated_at)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?)
+	`,
+		room.RoomName,
+		room.RoomDescription,
+		room.RoomURL,
+		room.Capacity,
+		room.Active,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, duplicateRoomURL(err)
+	}
+
+	lastID, err := ret.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	rate.RoomID = int(lastID)
+	if err := saveRoomRateTx(ctx, tx, rate); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(lastID), nil
+}
+
+// UpdateRoom saves the details and nightly rates of a room. It returns
+// repository.ErrRoomURLTaken when another room already uses the URL slug.
+func (m *mysqlDBRepo) UpdateRoom(room models.Room, rate models.RoomRate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	taken, err := m.roomURLTaken(ctx, room.RoomURL, room.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return repository.ErrRoomURLTaken
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+			rooms
+		SET
+			room_name = ?
+			, room_description = ?
+			, room_url = ?
+			, capacity = ?
+			, active = ?
+			, updated_at = ?
+		WHERE
+			id = ?
+	`,
+		room.RoomName,
+		room.RoomDescription,
+		room.RoomURL,
+		room.Capacity,
+		room.Active,
+		time.Now(),
+		room.ID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return duplicateRoomURL(err)
+	}
+
+	rate.RoomID = room.ID
+	if err := saveRoomRateTx(ctx, tx, rate); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveRoomRateTx sets the nightly rates of a room, adding them when the room has none yet
+func saveRoomRateTx(ctx context.Context, tx *sql.Tx, rate models.RoomRate) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO
+			room_rates
+			(room_id, base_rate, weekend_rate, created_at, updated_at)
+		VALUES
+			(?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			base_rate = VALUES(base_rate)
+			, weekend_rate = VALUES(weekend_rate)
+			, updated_at = VALUES(updated_at)
+	`,
+		rate.RoomID,
+		rate.BaseRate,
+		rate.WeekendRate,
+		time.Now(),
+		time.Now(),
+	)
+
+	return err
+}
+
+// GetRoomRate returns the nightly rates of a room, or repository.ErrNoRoomRates when
+// none were set
+func (m *mysqlDBRepo) GetRoomRate(roomID int) (models.RoomRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rate models.RoomRate
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT
+			id
+			, room_id
+			, base_rate
+			, weekend_rate
+			, created_at
+			, updated_at
+		FROM
+			room_rates
+		WHERE
+			room_id = ?
+	`, roomID)
+
+	err := row.Scan(
+		&rate.ID,
+		&rate.RoomID,
+		&rate.BaseRate,
+		&rate.WeekendRate,
+		&rate.CreatedAt,
+		&rate.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rate, repository.ErrNoRoomRates
+	}
+
+	return rate, err
+}
+
+// roomURLTaken reports whether a room other than exceptID uses the URL slug
+func (m *mysqlDBRepo) roomURLTaken(ctx context.Context, url string, exceptID int) (bool, error) {
+	var numRows int
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT
+			count(id)
+		FROM
+			rooms
+		WHERE
+			room_url = ?
+			AND id <> ?
+	`, url, exceptID)
+	if err := row.Scan(&numRows); err != nil {
+		return false, err
+	}
+
+	return numRows > 0, nil
+}
+
+// duplicateRoomURL maps a unique index violation on rooms.room_url, which happens when
+// two rooms race for the same slug, to repository.ErrRoomURLTaken
+func duplicateRoomURL(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return repository.ErrRoomURLTaken
+	}
+
+	return err
+}
+
+// DeleteRoom removes a room with its rates and blocks. Rooms that have reservations,
+// including past and cancelled ones, are kept for the records and
+// repository.ErrRoomHasReservations is returned; deactivate them instead.
+func (m *mysqlDBRepo) DeleteRoom(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = deleteRoomTx(ctx, tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteRoomTx locks the room, makes sure it has no reservations and deletes it.
+// Rates and restrictions go with it through their cascading foreign keys.
+func deleteRoomTx(ctx context.Context, tx *sql.Tx, id int) error {
+	if err := lockRoomTx(ctx, tx, id); err != nil {
+		return err
+	}
+
+	var numRows int
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT
+			count(id)
+		FROM
+			reservations
+		WHERE
+			room_id = ?
+	`, id)
+	if err := row.Scan(&numRows); err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return repository.ErrRoomHasReservations
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM
+			rooms
+		WHERE
+			id = ?
+	`, id)
+
+	return err
+}
+
+// GetRoomPhotos returns the photos of a room in gallery order
+func (m *mysqlDBRepo) GetRoomPhotos(roomID int) ([]models.RoomPhoto, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryRoomPhotos(ctx, m.DB, roomID)
+}
+
+// queryRoomPhotos selects the photos of a room ordered by their position
+func queryRoomPhotos(ctx context.Context, q queryer, roomID int) ([]models.RoomPhoto, error) {
+	var photos []models.RoomPhoto
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT
+			id
+			, room_id
+			, file_name
+			, sort_order
+			, is_cover
+			, created_at
+			, updated_at
+		FROM
+			room_photos
+		WHERE
+			room_id = ?
+		ORDER BY
+			sort_order, id
+	`, roomID)
+	if err != nil {
+		return photos, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.RoomPhoto
+		err := rows.Scan(
+			&p.ID,
+			&p.RoomID,
+			&p.FileName,
+			&p.SortOrder,
+			&p.IsCover,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return photos, err
+		}
+
+		photos = append(photos, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return photos, err
+	}
+
+	return photos, nil
+}
+
+// InsertRoomPhoto adds a photo at the end of a room's gallery. The first photo of a
+// room becomes its cover.
+func (m *mysqlDBRepo) InsertRoomPhoto(photo models.RoomPhoto) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, err := insertRoomPhotoTx(ctx, tx, photo)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return lastID, nil
+}
+
+// insertRoomPhotoTx locks the room so concurrent uploads get distinct positions
+func insertRoomPhotoTx(ctx context.Context, tx *sql.Tx, photo models.RoomPhoto) (int, error) {
+	if err := lockRoomTx(ctx, tx, photo.RoomID); err != nil {
+		return 0, err
+	}
+
+	var sortOrder, covers int
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT
+			coalesce(max(sort_order), 0) + 1
+			, coalesce(sum(is_cover), 0)
+		FROM
+			room_photos
+		WHERE
+			room_id = ?
+	`, photo.RoomID)
+	if err := row.Scan(&sortOrder, &covers); err != nil {
+		return 0, err
+	}
+
+	isCover := 0
+	if covers == 0 {
+		isCover = 1
+	}
+
+	ret, err := tx.ExecContext(ctx, `
+		INSERT INTO
+			room_photos
+			(room_id, file_name, sort_order, is_cover, created_at, updated_at)
+		VALUES
+			(?, ?, ?, ?, ?, ?)
+	`,
+		photo.RoomID,
+		photo.FileName,
+		sortOrder,
+		isCover,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, err := ret.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(lastID), nil
+}
+
+// SetRoomCoverPhoto makes a photo the cover of its room. It returns sql.ErrNoRows when
+// the room has no such photo.
+func (m *mysqlDBRepo) SetRoomCoverPhoto(roomID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = setRoomCoverPhotoTx(ctx, tx, roomID, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setRoomCoverPhotoTx flags the photo as cover and clears the flag on the others
+func setRoomCoverPhotoTx(ctx context.Context, tx *sql.Tx, roomID, id int) error {
+	var numRows int
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT
+			count(id)
+		FROM
+			room_photos
+		WHERE
+			id = ?
+			AND room_id = ?
+	`, id, roomID)
+	if err := row.Scan(&numRows); err != nil {
+		return err
+	}
+
+	if numRows == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE
+			room_photos
+		SET
+			is_cover = IF(id = ?, 1, 0)
+			, updated_at = ?
+		WHERE
+			room_id = ?
+	`, id, time.Now(), roomID)
+
+	return err
+}
+
+// MoveRoomPhoto moves a photo offset positions in its room's gallery, negative
+// offsets moving it towards the start. Moves past either end stop there. It returns
+// sql.ErrNoRows when the room has no such photo.
+func (m *mysqlDBRepo) MoveRoomPhoto(roomID, id, offset int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = moveRoomPhotoTx(ctx, tx, roomID, id, offset); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// moveRoomPhotoTx reorders the gallery in memory and renumbers every photo
+func moveRoomPhotoTx(ctx context.Context, tx *sql.Tx, roomID, id, offset int) error {
+	if err := lockRoomTx(ctx, tx, roomID); err != nil {
+		return err
+	}
+
+	photos, err := queryRoomPhotos(ctx, tx, roomID)
+	if err != nil {
+		return err
+	}
+
+	from := -1
+	for i, p := range photos {
+		if p.ID == id {
+			from = i
+			break
+		}
+	}
+
+	if from < 0 {
+		return sql.ErrNoRows
+	}
+
+	to := min(max(from+offset, 0), len(photos)-1)
+	photo := photos[from]
+	photos = append(photos[:from], photos[from+1:]...)
+	photos = append(photos[:to], append([]models.RoomPhoto{photo}, photos[to:]...)...)
+
+	for i, p := range photos {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE
+				room_photos
+			SET
+				sort_order = ?
+				, updated_at = ?
+			WHERE
+				id = ?
+		`, i+1, time.Now(), p.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteRoomPhoto removes a photo from a room and returns it so its files can be
+// deleted. When the cover is removed the next photo in the gallery takes its place.
+// It returns sql.ErrNoRows when the room has no such photo.
+func (m *mysqlDBRepo) DeleteRoomPhoto(roomID, id int) (models.RoomPhoto, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.RoomPhoto{}, err
+	}
+
+	photo, err := deleteRoomPhotoTx(ctx, tx, roomID, id)
+	if err != nil {
+		tx.Rollback()
+		return models.RoomPhoto{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.RoomPhoto{}, err
+	}
+
+	return photo, nil
+}
+
+// deleteRoomPhotoTx deletes the photo and promotes a new cover when needed
+func deleteRoomPhotoTx(ctx context.Context, tx *sql.Tx, roomID, id int) (models.RoomPhoto, error) {
+	if err := lockRoomTx(ctx, tx, roomID); err != nil {
+		return models.RoomPhoto{}, err
+	}
+
+	photos, err := queryRoomPhotos(ctx, tx, roomID)
+	if err != nil {
+		return models.RoomPhoto{}, err
+	}
+
+	var photo models.RoomPhoto
+	var next int
+	for _, p := range photos {
+		if p.ID == id {
+			photo = p
+		} else if next == 0 {
+			next = p.ID
+		}
+	}
+
+	if photo.ID == 0 {
+		return photo, sql.ErrNoRows
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM
+			room_photos
+		WHERE
+			id = ?
+	`, id)
+	if err != nil {
+		return photo, err
+	}
+
+	if photo.IsCover == 1 && next != 0 {
+		if err := setRoomCoverPhotoTx(ctx, tx, roomID, next); err != nil {
+			return photo, err
+		}
+	}
+
+	return photo, nil
+}
+
+// GetStayRules returns the stay rules of a room, the default rule first and then the
+// seasonal rules by start date
+func (m *mysqlDBRepo) GetStayRules(roomID int) ([]models.StayRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryStayRules(ctx, m.DB, "AND room_id = ?", roomID)
+}
+
+// checkStayRules returns a repository.StayRuleError when the stay breaks the room's stay rules
+func checkStayRules(ctx context.Context, q queryer, roomID int, start, end time.Time) error {
+	rules, err := queryStayRules(ctx, q, "AND room_id = ?", roomID)
+	if err != nil {
+		return err
+	}
+
+	if v := stayrules.Check(rules, start, end, time.Now()); v != nil {
+		return &repository.StayRuleError{Violation: *v}
+	}
+
+	return nil
+}
+
+// queryStayRules selects stay rules filtered by the given AND clauses
+func queryStayRules(ctx context.Context, q queryer, clauses string, args ...any) ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT
+			id
+			, room_id
+			, season_name
+			, start_date
+			, end_date
+			, min_nights
+			, max_nights
+			, closed_to_arrival
+			, closed_to_departure
+			, lead_days
+			, horizon_days
+			, created_at
+			, updated_at
+		FROM
+			stay_rules
+		WHERE 1=1
+		`+clauses+`
+		ORDER BY
+			room_id, start_date IS NOT NULL, start_date, id
+	`, args...)
+	if err != nil {
+		return rules, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.StayRule
+		var startDate, endDate sql.NullTime
+
+		err := rows.Scan(
+			&r.ID,
+			&r.RoomID,
+			&r.SeasonName,
+			&startDate,
+			&endDate,
+			&r.MinNights,
+			&r.MaxNights,
+			&r.ClosedToArrival,
+			&r.ClosedToDeparture,
+			&r.LeadDays,
+			&r.HorizonDays,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		)
+		if err != nil {
+			return rules, err
+		}
+
+		r.StartDate = startDate.Time
+		r.EndDate = endDate.Time
+
+		rules = append(rules, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// SaveStayRule inserts a stay rule, or replaces the room's default rule when rule has
+// no dates and the room already has one
+func (m *mysqlDBRepo) SaveStayRule(rule models.StayRule) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, err := saveStayRuleTx(ctx, tx, rule)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return lastID, nil
+}
+
+// saveStayRuleTx locks the room so two default rules can't be created concurrently
+func saveStayRuleTx(ctx context.Context, tx *sql.Tx, rule models.StayRule) (int, error) {
+	if err := lockRoomTx(ctx, tx, rule.RoomID); err != nil {
+		return 0, err
+	}
+
+	var startDate, endDate sql.NullTime
+	if !stayrules.IsDefault(rule) {
+		startDate = sql.NullTime{Time: rule.StartDate, Valid: true}
+		endDate = sql.NullTime{Time: rule.EndDate, Valid: true}
+	} else {
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM
+				stay_rules
+			WHERE
+				room_id = ?
+				AND start_date IS NULL
+		`, rule.RoomID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	ret, err := tx.ExecContext(ctx, `
+		INSERT INTO
+			stay_rules
+			(room_id, season_name, start_date, end_date, min_nights, max_nights,
+			closed_to_arrival, closed_to_departure, lead_days, horizon_days, created_at, updated_at)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		rule.RoomID,
+		rule.SeasonName,
+		startDate,
+		endDate,
+		rule.MinNights,
+		rule.MaxNights,
+		rule.ClosedToArrival,
+		rule.ClosedToDeparture,
+		rule.LeadDays,
+		rule.HorizonDays,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, err := ret.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(lastID), nil
+}
+
+// DeleteStayRule removes a stay rule from a room. It returns sql.ErrNoRows when the
+// room has no such rule.
+func (m *mysqlDBRepo) DeleteStayRule(roomID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ret, err := m.DB.ExecContext(ctx, `
+		DELETE FROM
+			stay_rules
+		WHERE
+			id = ?
+			AND room_id = ?
+	`, id, roomID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CreateCalendarFeed stores a new calendar feed. A RoomID of 0 exports every room.
+func (m *mysqlDBRepo) CreateCalendarFeed(feed models.CalendarFeed) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var roomID sql.NullInt64
+	if feed.RoomID != 0 {
+		roomID = sql.NullInt64{Int64: int64(feed.RoomID), Valid: true}
+	}
+
+	ret, err := m.DB.ExecContext(ctx, `
+		INSERT INTO
+			calendar_feeds
+			(room_id, name, token_hash, created_at, updated_at)
+		VALUES
+			(?, ?, ?, ?, ?)
+	`,
+		roomID,
+		feed.Name,
+		feed.TokenHash,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, _ := ret.LastInsertId()
+
+	return int(lastID), nil
+}
+
+// ListCalendarFeeds returns every calendar feed, property-wide feeds first
+func (m *mysqlDBRepo) ListCalendarFeeds() ([]models.CalendarFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryCalendarFeeds(ctx, m.DB, "")
+}
+
+// DeleteCalendarFeed revokes a calendar feed. It returns sql.ErrNoRows when there is
+// no such feed.
+func (m *mysqlDBRepo) DeleteCalendarFeed(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ret, err := m.DB.ExecContext(ctx, `
+		DELETE FROM
+			calendar_feeds
+		WHERE
+			id = ?
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetCalendarFeedByToken returns the calendar feed with the given secret hash and
+// records when it was fetched. It returns sql.ErrNoRows for unknown secrets.
+func (m *mysqlDBRepo) GetCalendarFeedByToken(tokenHash string) (models.CalendarFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	feeds, err := queryCalendarFeeds(ctx, m.DB, "AND f.token_hash = ?", tokenHash)
+	if err != nil {
+		return models.CalendarFeed{}, err
+	}
+
+	if len(feeds) == 0 {
+		return models.CalendarFeed{}, sql.ErrNoRows
+	}
+
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE
+			calendar_feeds
+		SET
+			last_used_at = ?
+		WHERE
+			id = ?
+	`, time.Now(), feeds[0].ID)
+	if err != nil {
+		return feeds[0], err
+	}
+
+	return feeds[0], nil
+}
+
+// queryCalendarFeeds selects calendar feeds with their room, filtered by the given AND clauses
+func queryCalendarFeeds(ctx context.Context, q queryer, clauses string, args ...any) ([]models.CalendarFeed, error) {
+	var feeds []models.CalendarFeed
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT
+			f.id
+			, f.room_id
+			, f.name
+			, f.last_used_at
+			, f.created_at
+			, f.updated_at
+			, coalesce(rm.room_name, '')
+		FROM
+			calendar_feeds f
+		LEFT JOIN
+			rooms rm ON f.room_id = rm.id
+		WHERE 1=1
+	`+clauses+`
+		ORDER BY
+			f.room_id IS NOT NULL, rm.room_name, f.created_at
+	`, args...)
+	if err != nil {
+		return feeds, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var f models.CalendarFeed
+		var roomID sql.NullInt64
+		var lastUsed sql.NullTime
+
+		err := rows.Scan(
+			&f.ID,
+			&roomID,
+			&f.Name,
+			&lastUsed,
+			&f.CreatedAt,
+			&f.UpdatedAt,
+			&f.Room.RoomName,
+		)
+		if err != nil {
+			return feeds, err
+		}
+
+		f.RoomID = int(roomID.Int64)
+		f.Room.ID = f.RoomID
+		f.LastUsedAt = lastUsed.Time
+		feeds = append(feeds, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return feeds, err
+	}
+
+	return feeds, nil
+}
+
+// CreateCalendarImport adds an external calendar to a room
+func (m *mysqlDBRepo) CreateCalendarImport(imp models.CalendarImport) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ret, err := m.DB.ExecContext(ctx, `
+		INSERT INTO
+			calendar_imports
+			(room_id, name, url, created_at, updated_at)
+		VALUES
+			(?, ?, ?, ?, ?)
+	`,
+		imp.RoomID,
+		imp.Name,
+		imp.URL,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	lastID, _ := ret.LastInsertId()
+
+	return int(lastID), nil
+}
+
+// GetCalendarImports returns the external calendars of a room
+func (m *mysqlDBRepo) GetCalendarImports(roomID int) ([]models.CalendarImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryCalendarImports(ctx, m.DB, "AND room_id = ?", roomID)
+}
+
+// GetCalendarImport returns an external calendar of a room. It returns
+// sql.ErrNoRows when the room has no such calendar.
+func (m *mysqlDBRepo) GetCalendarImport(roomID, id int) (models.CalendarImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	imports, err := queryCalendarImports(ctx, m.DB, "AND room_id = ? AND id = ?", roomID, id)
+	if err != nil {
+		return models.CalendarImport{}, err
+	}
+
+	if len(imports) == 0 {
+		return models.CalendarImport{}, sql.ErrNoRows
+	}
+
+	return imports[0], nil
+}
+
+// PolledCalendarImports returns every external calendar with a URL to fetch
+func (m *mysqlDBRepo) PolledCalendarImports() ([]models.CalendarImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryCalendarImports(ctx, m.DB, "AND url <> ''")
+}
+
+// DeleteCalendarImport removes an external calendar and the blocks imported from it.
+// It returns sql.ErrNoRows when the room has no such calendar.
+func (m *mysqlDBRepo) DeleteCalendarImport(roomID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ret, err := m.DB.ExecContext(ctx, `
+		DELETE FROM
+			calendar_imports
+		WHERE
+			id = ?
+			AND room_id = ?
+	`, id, roomID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// UpdateCalendarImportStatus records when an external calendar was last synced and
+// why the sync failed, if it did
+func (m *mysqlDBRepo) UpdateCalendarImportStatus(id int, syncedAt time.Time, syncErr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE
+			calendar_imports
+		SET
+			last_synced_at = ?
+			, last_error = ?
+			, updated_at = ?
+		WHERE
+			id = ?
+	`, syncedAt, syncErr, time.Now(), id)
+
+	return err
+}
+
+// queryCalendarImports selects external calendars filtered by the given AND clauses
+func queryCalendarImports(ctx context.Context, q queryer, clauses string, args ...any) ([]models.CalendarImport, error) {
+	var imports []models.CalendarImport
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT
+			id
+			, room_id
+			, name
+			, url
+			, last_synced_at
+			, coalesce(last_error, '')
+			, created_at
+			, updated_at
+		FROM
+			calendar_imports
+		WHERE 1=1
+	`+clauses+`
+		ORDER BY
+			room_id, name, id
+	`, args...)
+	if err != nil {
+		return imports, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var imp models.CalendarImport
+		var lastSynced sql.NullTime
+
+		err := rows.Scan(
+			&imp.ID,
+			&imp.RoomID,
+			&imp.Name,
+			&imp.URL,
+			&lastSynced,
+			&imp.LastError,
+			&imp.CreatedAt,
+			&imp.UpdatedAt,
+		)
+		if err != nil {
+			return imports, err
+		}
+
+		imp.LastSyncedAt = lastSynced.Time
+		imports = append(imports, imp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return imports, err
+	}
+
+	return imports, nil
+}
+
+// SyncExternalBlocks makes the External restrictions of an external calendar match
+// blocks, the events it currently lists. Events are matched by UID: new ones are
+// added, changed ones updated and those no longer listed removed, so running it
+// twice with the same events changes nothing. The room is locked while it runs.
+func (m *mysqlDBRepo) SyncExternalBlocks(imp models.CalendarImport, blocks []models.RoomRestriction) (models.CalendarSyncResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.CalendarSyncResult{}, err
+	}
+
+	result, err := syncExternalBlocksTx(ctx, tx, imp, blocks)
+	if err != nil {
+		tx.Rollback()
+		return models.CalendarSyncResult{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.CalendarSyncResult{}, err
+	}
+
+	return result, nil
+}
+
+// syncExternalBlocksTx reconciles the imported restrictions and counts the upcoming
+// ones that overlap reservations or other blocks
+func syncExternalBlocksTx(ctx context.Context, tx *sql.Tx, imp models.CalendarImport, blocks []models.RoomRestriction) (models.CalendarSyncResult, error) {
+	var result models.CalendarSyncResult
+
+	if err := lockRoomTx(ctx, tx, imp.RoomID); err != nil {
+		return result, err
+	}
+
+	existing, err := queryRoomRestrictions(ctx, tx, `
+		AND rr.calendar_import_id = ?
+	`, imp.ID)
+	if err != nil {
+		return result, err
+	}
+
+	byUID := make(map[string]models.RoomRestriction, len(existing))
+	for _, rr := range existing {
+		byUID[rr.UID] = rr
+	}
+
+	seen := make(map[string]bool, len(blocks))
+
+	for _, block := range blocks {
+		if seen[block.UID] {
+			continue
+		}
+		seen[block.UID] = true
+
+		current, ok := byUID[block.UID]
+		switch {
+		case !ok:
+			block.RoomID = imp.RoomID
+			block.ReservationID = 0
+			block.RestrictionID = models.RestrictionExternal
+			block.CalendarImportID = imp.ID
+
+			if _, err := insertRoomRestrictionTx(ctx, tx, block); err != nil {
+				return result, err
+			}
+			result.Added++
+		case !current.StartDate.Equal(block.StartDate) || !current.EndDate.Equal(block.EndDate) || current.Reason != block.Reason:
+			_, err := tx.ExecContext(ctx, `
+				UPDATE
+					room_restrictions
+				SET
+					start_date = ?
+					, end_date = ?
+					, reason = ?
+					, updated_at = ?
+				WHERE
+					id = ?
+			`, block.StartDate, block.EndDate, block.Reason, time.Now(), current.ID)
+			if err != nil {
+				return result, err
+			}
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	for uid, current := range byUID {
+		if seen[uid] {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM
+				room_restrictions
+			WHERE
+				id = ?
+		`, current.ID)
+		if err != nil {
+			return result, err
+		}
+		result.Removed++
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT
+			count(DISTINCT e.id)
+		FROM
+			room_restrictions e
+		INNER JOIN
+			room_restrictions o ON (
+				o.room_id = e.room_id
+				AND o.id <> e.id
+				AND (o.calendar_import_id IS NULL OR o.calendar_import_id <> e.calendar_import_id)
+				AND e.start_date < o.end_date
+				AND e.end_date > o.start_date
+			)
+		WHERE
+			e.calendar_import_id = ?
+			AND e.end_date > ?
+	`, imp.ID, dates.TruncateDay(time.Now()))
+
+	if err := row.Scan(&result.Conflicts); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// OccupancyReport reports occupancy and revenue for the nights from start up to end,
+// for every room or only roomID when it is not 0. An unknown roomID returns sql.ErrNoRows.
+func (m *mysqlDBRepo) OccupancyReport(start, end time.Time, roomID int) (models.Report, error) {
+	rooms, err := m.ListRooms()
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	if roomID != 0 {
+		var room []models.Room
+		for _, r := range rooms {
+			if r.ID == roomID {
+				room = append(room, r)
+			}
+		}
+
+		if len(room) == 0 {
+			return models.Report{}, sql.ErrNoRows
+		}
+
+		rooms = room
+	}
+
+	reservations, err := m.AllReservations(&start, &end)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	restrictions, err := queryRoomRestrictions(ctx, m.DB, `
+		AND rr.restriction_id IN (?, ?)
+		AND rr.end_date > ?
+		AND rr.start_date < ?
+	`, models.RestrictionOwnerBlock, models.RestrictionExternal, start, end)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	report, err := reports.Build(start, end, rooms, reservations, restrictions)
+	report.RoomID = roomID
+
+	return report, err
+}
@@ -0,0 +1,428 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/driver"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/repository"
+)
+
+// testMysqlRepo connects to the database in BOOKINGS_TEST_DSN or skips the test
+func testMysqlRepo(t *testing.T) *mysqlDBRepo {
+	dsn := os.Getenv("BOOKINGS_TEST_DSN")
+	if dsn == "" {
+		t.Skip("BOOKINGS_TEST_DSN not set, skipping database test")
+	}
+
+	db, err := driver.NewDatabase(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return &mysqlDBRepo{
+		App: &config.AppConfig{},
+		DB:  db,
+	}
+}
+
+func TestMysqlDBRepo_BookRoomConcurrent(t *testing.T) {
+	repo := testMysqlRepo(t)
+
+	const (
+		email = "concurrency-test@example.com"
+		slug  = "concurrency-test-room"
+	)
+	start := time.Date(2099, 1, 10, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 3)
+
+	cleanup := func() {
+		_, err := repo.DB.Exec("DELETE FROM reservations WHERE email = ?", email)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = repo.DB.Exec("DELETE FROM rooms WHERE room_url = ?", slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	// a room of its own, without the stay rules seeded for the other rooms, so only the
+	// race decides which booking wins
+	roomID, err := repo.CreateRoom(models.Room{
+		RoomName: "Concurrency Test Room",
+		RoomURL:  slug,
+		Capacity: 2,
+		Active:   1,
+	}, models.RoomRate{BaseRate: 10000, WeekendRate: 10000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 20
+
+	var (
+		wg          sync.WaitGroup
+		mu          sync.Mutex
+		booked      int
+		unavailable int
+		failures    []error
+	)
+
+	ready := make(chan struct{})
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ready
+
+			_, err := repo.BookRoom(models.Reservation{
+				FirstName: "Concurrent",
+				LastName:  "Guest",
+				Email:     email,
+				Phone:     "555",
+				StartDate: start.AddDate(0, 0, i%2),
+				EndDate:   end,
+				RoomID:    roomID,
+				Adults:    1,
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			var unavailableErr *repository.RoomUnavailableError
+			switch {
+			case err == nil:
+				booked++
+			case errors.As(err, &unavailableErr):
+				unavailable++
+			default:
+				failures = append(failures, err)
+			}
+		}()
+	}
+
+	close(ready)
+	wg.Wait()
+
+	for _, err := range failures {
+		t.Errorf("unexpected error booking room: %v", err)
+	}
+
+	if booked != 1 {
+		t.Errorf("expected exactly 1 successful booking, got %d", booked)
+	}
+
+	if booked+unavailable != workers {
+		t.Errorf("expected %d unavailable errors, got %d", workers-booked, unavailable)
+	}
+
+	var restrictions int
+	row := repo.DB.QueryRow(`
+		SELECT
+			count(rr.id)
+		FROM
+			room_restrictions rr
+		JOIN
+			reservations r ON r.id = rr.reservation_id
+		WHERE
+			r.email = ?
+	`, email)
+	if err := row.Scan(&restrictions); err != nil {
+		t.Fatal(err)
+	}
+
+	if restrictions != 1 {
+		t.Errorf("expected 1 room restriction to be written, got %d", restrictions)
+	}
+}
+
+func TestMysqlDBRepo_BookGroup(t *testing.T) {
+	repo := testMysqlRepo(t)
+
+	rooms, err := repo.GetAllRooms(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) == 0 {
+		t.Skip("no rooms seeded, skipping database test")
+	}
+
+	const email = "group-test@example.com"
+	start := time.Date(2099, 2, 10, 0, 0, 0, 0, time.UTC)
+	roomID := rooms[0].ID
+
+	var groupIDs []int
+	cleanup := func() {
+		if _, err := repo.DB.Exec("DELETE FROM reservations WHERE email = ?", email); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range groupIDs {
+			if _, err := repo.DB.Exec("DELETE FROM reservation_groups WHERE id = ?", id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	stay := func(from, nights int) models.Reservation {
+		return models.Reservation{
+			FirstName: "Group",
+			LastName:  "Guest",
+			Email:     email,
+			Phone:     "555",
+			StartDate: start.AddDate(0, 0, from),
+			EndDate:   start.AddDate(0, 0, from+nights),
+			RoomID:    roomID,
+			Total:     10000,
+		}
+	}
+
+	// the second stay overlaps the first, so nothing may be written
+	_, err = repo.BookGroup(models.ReservationGroup{
+		Reservations: []models.Reservation{stay(0, 3), stay(2, 2)},
+	})
+
+	var unavailable *repository.RoomUnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("expected a RoomUnavailableError, got %v", err)
+	}
+
+	var count int
+	if err := repo.DB.QueryRow("SELECT count(id) FROM reservations WHERE email = ?", email).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no reservation to be written, got %d", count)
+	}
+
+	group, err := repo.BookGroup(models.ReservationGroup{
+		Reservations: []models.Reservation{stay(0, 3), stay(3, 2)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupIDs = append(groupIDs, group.ID)
+
+	if group.ID == 0 || group.Total != 20000 {
+		t.Errorf("unexpected group %+v", group)
+	}
+
+	reservations, err := repo.GetGroupReservations(group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reservations) != 2 {
+		t.Fatalf("expected 2 reservations in the group, got %d", len(reservations))
+	}
+
+	res, err := repo.GetReservationById(group.Reservations[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GroupID != group.ID {
+		t.Errorf("expected reservation in group %d, got %d", group.ID, res.GroupID)
+	}
+}
+
+func TestMysqlDBRepo_InsertRoomBlock(t *testing.T) {
+	repo := testMysqlRepo(t)
+
+	rooms, err := repo.GetAllRooms(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) == 0 {
+		t.Skip("no rooms seeded, skipping database test")
+	}
+
+	const email = "block-test@example.com"
+	start := time.Date(2099, 2, 10, 0, 0, 0, 0, time.UTC)
+	roomID := rooms[0].ID
+
+	cleanup := func() {
+		_, err := repo.DB.Exec("DELETE FROM room_restrictions WHERE room_id = ? AND start_date >= ? AND start_date < ?", roomID, start, start.AddDate(0, 1, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = repo.DB.Exec("DELETE FROM reservations WHERE email = ?", email)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	resID, err := repo.BookRoom(models.Reservation{
+		FirstName: "Blocked",
+		LastName:  "Guest",
+		Email:     email,
+		Phone:     "555",
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 3),
+		RoomID:    roomID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.InsertRoomBlock(models.RoomRestriction{
+		RoomID:    roomID,
+		StartDate: start.AddDate(0, 0, 2),
+		EndDate:   start.AddDate(0, 0, 5),
+		Reason:    "Repainting",
+	})
+
+	var conflictErr *repository.DatesConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a DatesConflictError, got %v", err)
+	}
+
+	if len(conflictErr.Conflicts) != 1 || conflictErr.Conflicts[0].ReservationID != resID {
+		t.Errorf("expected reservation %d as the only conflict, got %+v", resID, conflictErr.Conflicts)
+	}
+
+	blockID, err := repo.InsertRoomBlock(models.RoomRestriction{
+		RoomID:    roomID,
+		StartDate: start.AddDate(0, 0, 3),
+		EndDate:   start.AddDate(0, 0, 5),
+		Reason:    "Repainting",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := repo.RoomBlocksBetween(start, start.AddDate(0, 0, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks) != 1 || blocks[0].ID != blockID || blocks[0].Reason != "Repainting" {
+		t.Errorf("unexpected blocks: %+v", blocks)
+	}
+
+	if err := repo.DeleteRoomBlock(roomID, blockID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteRoomBlock(roomID, blockID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows deleting a removed block, got %v", err)
+	}
+}
+
+func TestMysqlDBRepo_RoomCRUD(t *testing.T) {
+	repo := testMysqlRepo(t)
+
+	const slug = "crud-test-room"
+
+	cleanup := func() {
+		_, err := repo.DB.Exec("DELETE FROM rooms WHERE room_url LIKE ?", slug+"%")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	room := models.Room{
+		RoomName: "CRUD Test Room",
+		RoomURL:  slug,
+		Capacity: 3,
+		Active:   0,
+	}
+
+	rate := models.RoomRate{BaseRate: 9000, WeekendRate: 11000}
+
+	id, err := repo.CreateRoom(room, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)
+	quote, err := repo.QuoteStay(id, start, start.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("expected the new room to be priced, got %v", err)
+	}
+	if quote.Total != 18000 {
+		t.Errorf("expected two weekday nights at the base rate, got %d", quote.Total)
+	}
+
+	if _, err := repo.CreateRoom(room, rate); !errors.Is(err, repository.ErrRoomURLTaken) {
+		t.Errorf("expected ErrRoomURLTaken for a duplicate slug, got %v", err)
+	}
+
+	rooms, err := repo.GetAllRooms(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rooms {
+		if r.ID == id {
+			t.Error("inactive room listed by GetAllRooms")
+		}
+	}
+
+	room.ID = id
+	room.RoomURL = slug + "-renamed"
+	room.Active = 1
+	rate.BaseRate = 9500
+	if err := repo.UpdateRoom(room, rate); err != nil {
+		t.Fatal(err)
+	}
+
+	if saved, err := repo.GetRoomRate(id); err != nil || saved.BaseRate != 9500 {
+		t.Errorf("unexpected rate after update: %+v, %v", saved, err)
+	}
+
+	saved, err := repo.GetRoomByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.RoomURL != room.RoomURL || saved.Capacity != 3 || saved.Active != 1 {
+		t.Errorf("unexpected room after update: %+v", saved)
+	}
+
+	if err := repo.DeleteRoom(id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReservationFilterClauses(t *testing.T) {
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	clauses, args := reservationFilterClauses(models.ReservationFilter{
+		Start:  start,
+		RoomID: 2,
+		Status: "pending",
+		Search: " 50%_off ",
+	})
+
+	expected := " AND r.end_date > ? AND r.room_id = ? AND r.status = ?" +
+		` AND (concat(r.first_name, ' ', r.last_name) LIKE ? OR r.email LIKE ? OR r.phone LIKE ?)`
+	if clauses != expected {
+		t.Errorf("unexpected clauses %q", clauses)
+	}
+
+	if len(args) != 6 || args[0] != start || args[1] != 2 || args[2] != "pending" || args[3] != `%50\%\_off%` {
+		t.Errorf("unexpected args %v", args)
+	}
+
+	clauses, args = reservationFilterClauses(models.ReservationFilter{Search: "42"})
+	if len(args) != 4 || args[3] != 42 || clauses[len(clauses)-len(" OR r.id = ?)"):] != " OR r.id = ?)" {
+		t.Errorf("expected a numeric search to match the id, got %q %v", clauses, args)
+	}
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// ErrRoomURLTaken is returned when another room already uses the URL slug
+var ErrRoomURLTaken = errors.New("room url is already taken")
+
+// ErrRoomHasReservations is returned when deleting a room that still has reservations
+var ErrRoomHasReservations = errors.New("room has reservations")
+
+// ErrNoRoomRates is returned when pricing a room that has no nightly rates set
+var ErrNoRoomRates = errors.New("room has no rates")
+
+// ErrNotReschedulable is returned when moving a reservation whose stay has started or ended
+var ErrNotReschedulable = errors.New("reservation can no longer be rescheduled")
+
+// RoomUnavailableError is returned when a room is no longer free for the requested dates
+type RoomUnavailableError struct {
+	RoomID    int
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+func (e *RoomUnavailableError) Error() string {
+	return fmt.Sprintf("room %d is no longer available from %s to %s",
+		e.RoomID, e.StartDate.Format("2006-01-02"), e.EndDate.Format("2006-01-02"))
+}
+
+// OccupancyError is returned when a party has more guests than the room sleeps
+type OccupancyError struct {
+	RoomID   int
+	Capacity int
+	Guests   int
+}
+
+func (e *OccupancyError) Error() string {
+	return fmt.Sprintf("room %d sleeps %d guests, not %d", e.RoomID, e.Capacity, e.Guests)
+}
+
+// DatesConflictError is returned when a room block overlaps existing reservations or blocks
+type DatesConflictError struct {
+	RoomID    int
+	StartDate time.Time
+	EndDate   time.Time
+	// Conflicts holds the overlapping restrictions, with the reservation loaded for bookings
+	Conflicts []models.RoomRestriction
+}
+
+func (e *DatesConflictError) Error() string {
+	return fmt.Sprintf("room %d has %d conflicting reservations or blocks from %s to %s",
+		e.RoomID, len(e.Conflicts), e.StartDate.Format("2006-01-02"), e.EndDate.Format("2006-01-02"))
+}
+
+// StayRuleError is returned when a stay breaks one of the room's stay rules
+type StayRuleError struct {
+	Violation models.StayRuleViolation
+}
+
+func (e *StayRuleError) Error() string {
+	return fmt.Sprintf("room %d stay rule %s: %s", e.Violation.RoomID, e.Violation.Rule, e.Violation.Message)
+}
@@ -3,27 +3,73 @@ package repository
 import (
 	"time"
 
+	"github.com/mlvieira/bookings/internal/lifecycle"
 	"github.com/mlvieira/bookings/internal/models"
 )
 
 type DatabaseRepo interface {
 	InsertReservation(res models.Reservation) (int, error)
 	InsertRoomRestriction(res models.RoomRestriction) error
+	BookRoom(res models.Reservation) (int, error)
+	BookGroup(group models.ReservationGroup) (models.ReservationGroup, error)
 	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
+	SearchAvailabilityForAllRooms(start, end time.Time, guests int) ([]models.Room, []models.StayRuleViolation, error)
 	GetRoomByID(id int) (models.Room, error)
 	GetRoomByUrl(url string) (models.Room, error)
 	GetUserByID(id int) (models.User, error)
 	UpdateUser(user models.User) error
 	Authenticate(email, testPassword string) (models.User, error)
 	AllReservations(start, end *time.Time) ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
+	SearchReservations(query models.ReservationQuery) (models.ReservationPage, error)
+	EachReservation(filter models.ReservationFilter, fn func(res models.Reservation) error) error
 	GetReservationById(id int) (models.Reservation, error)
+	GetGroupReservations(groupID int) ([]models.Reservation, error)
 	UpdateReservation(res models.Reservation) error
 	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
+	TransitionReservation(id int, to lifecycle.Status) error
+	RescheduleReservation(res models.Reservation) error
 	GetAllRooms(limit int) ([]models.Room, error)
+	ListRooms() ([]models.Room, error)
+	CreateRoom(room models.Room, rate models.RoomRate) (int, error)
+	UpdateRoom(room models.Room, rate models.RoomRate) error
+	GetRoomRate(roomID int) (models.RoomRate, error)
+	DeleteRoom(id int) error
+	QuoteStay(roomID int, start, end time.Time) (models.Quote, error)
 	CreateUser(user models.User) (int, error)
 	ListUsers() ([]models.User, error)
 	DeleteUser(id int) error
+	CreateAPIToken(token models.APIToken) (int, error)
+	ListAPITokens(userID int) ([]models.APIToken, error)
+	DeleteAPIToken(userID, id int) error
+	GetUserByAPIToken(tokenHash string) (models.User, error)
+	EnqueueMail(msg models.MailData) (int, error)
+	DueOutboxMessages(now time.Time, limit int) ([]models.OutboxMessage, error)
+	UpdateOutboxMessage(msg models.OutboxMessage) error
+	ListOutboxMessages(status string, limit int) ([]models.OutboxMessage, error)
+	RequeueOutboxMessage(id int) error
+	InsertRoomBlock(block models.RoomRestriction) (int, error)
+	GetRoomBlocks(roomID int) ([]models.RoomRestriction, error)
+	RoomBlocksBetween(start, end time.Time) ([]models.RoomRestriction, error)
+	RoomClosuresBetween(start, end time.Time) ([]models.RoomRestriction, error)
+	DeleteRoomBlock(roomID, id int) error
+	GetRoomPhotos(roomID int) ([]models.RoomPhoto, error)
+	InsertRoomPhoto(photo models.RoomPhoto) (int, error)
+	SetRoomCoverPhoto(roomID, id int) error
+	MoveRoomPhoto(roomID, id, offset int) error
+	DeleteRoomPhoto(roomID, id int) (models.RoomPhoto, error)
+	GetStayRules(roomID int) ([]models.StayRule, error)
+	SaveStayRule(rule models.StayRule) (int, error)
+	DeleteStayRule(roomID, id int) error
+	CreateCalendarFeed(feed models.CalendarFeed) (int, error)
+	ListCalendarFeeds() ([]models.CalendarFeed, error)
+	DeleteCalendarFeed(id int) error
+	GetCalendarFeedByToken(tokenHash string) (models.CalendarFeed, error)
+	CreateCalendarImport(imp models.CalendarImport) (int, error)
+	GetCalendarImports(roomID int) ([]models.CalendarImport, error)
+	GetCalendarImport(roomID, id int) (models.CalendarImport, error)
+	PolledCalendarImports() ([]models.CalendarImport, error)
+	DeleteCalendarImport(roomID, id int) error
+	UpdateCalendarImportStatus(id int, syncedAt time.Time, syncErr string) error
+	SyncExternalBlocks(imp models.CalendarImport, blocks []models.RoomRestriction) (models.CalendarSyncResult, error)
+	OccupancyReport(start, end time.Time, roomID int) (models.Report, error)
 }
@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
@@ -10,12 +13,18 @@ import (
 	"github.com/mlvieira/bookings/internal/config"
 	"github.com/mlvieira/bookings/internal/handlers"
 	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/rbac"
+	"github.com/mlvieira/bookings/internal/tokens"
 )
 
 func Routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Use(middleware.Recoverer)
+	mux.Use(limitUploads(
+		uploadLimit{"/admin/rooms/{id}/photos", handlers.Repo.PhotoUploadLimit},
+		uploadLimit{"/admin/rooms/{id}/calendars/{importID}/upload", handlers.Repo.CalendarUploadLimit},
+	))
 	mux.Use(noSurf(app))
 	mux.Use(sessionLoad(app.Session))
 
@@ -30,31 +39,115 @@ func Routes(app *config.AppConfig) http.Handler {
 	mux.Get("/book", handlers.Repo.Booking)
 	mux.Post("/book", handlers.Repo.PostBooking)
 	mux.Get("/book/summary", handlers.Repo.ReservationSummary)
+	mux.Get("/cart", handlers.Repo.Cart)
+	mux.Post("/cart", handlers.Repo.PostCart)
+	mux.Post("/cart/add", handlers.Repo.PostCartAdd)
+	mux.Post("/cart/remove", handlers.Repo.PostCartRemove)
+	mux.Get("/cart/summary", handlers.Repo.CartSummary)
+	mux.Get("/reservations/manage/{token}", handlers.Repo.ManageReservation)
+	mux.Post("/reservations/manage/{token}/cancel", handlers.Repo.PostCancelReservation)
 	mux.Get("/user/login", handlers.Repo.ShowLoginPage)
 	mux.Post("/user/login", handlers.Repo.PostShowLoginPage)
 	mux.Get("/user/logout", handlers.Repo.Logout)
+	mux.Get("/feeds/{token}.ics", handlers.Repo.CalendarFeed)
+
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.NotFound(handlers.Repo.ApiNotFound)
+		mux.MethodNotAllowed(handlers.Repo.ApiMethodNotAllowed)
+
+		mux.Get("/rooms", handlers.Repo.ApiListRooms)
+		mux.Get("/rooms/{room}", handlers.Repo.ApiGetRoom)
+		mux.Get("/availability", handlers.Repo.ApiSearchAvailability)
+		mux.Post("/reservations", handlers.Repo.ApiCreateReservation)
+		mux.Get("/reservations/{token}", handlers.Repo.ApiGetReservation)
+	})
 
 	mux.Route("/admin", func(mux chi.Router) {
-		mux.Use(auth(app.Session))
+		// JSON endpoints also accept a personal API token so they can be scripted
+		mux.Group(func(mux chi.Router) {
+			mux.Use(tokenAuth(app))
+
+			mux.With(jsonPermission(rbac.ViewReservations)).Get("/reservations/calendar/json", handlers.Repo.JsonAdminCalendarReservations)
+			mux.With(jsonPermission(rbac.ViewReservations)).Get("/reservations/timeline/json", handlers.Repo.JsonAdminTimeline)
+			mux.With(jsonPermission(rbac.ViewReservations)).Get("/reports/json", handlers.Repo.JsonAdminReport)
+			mux.With(jsonPermission(rbac.EditReservations)).Post("/reservations/status", handlers.Repo.PostJsonAdminChangeResStatus)
+			mux.With(jsonPermission(rbac.EditReservations)).Post("/reservations/calendar/move", handlers.Repo.PostJsonAdminMoveCalendarReservation)
+			mux.With(jsonPermission(rbac.DeleteReservations)).Post("/reservations/delete", handlers.Repo.PostJsonAdminDeleteRes)
+			mux.With(jsonPermission(rbac.ManageUsers)).Post("/users/delete", handlers.Repo.PostJsonAdminDeleteUser)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(auth(app.Session))
+
+			mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
+			})
+			mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+
+			mux.Group(func(mux chi.Router) {
+				mux.Use(permission(app, rbac.ViewReservations))
+
+				mux.Get("/reservations/new", handlers.Repo.AdminNewReservations)
+				mux.Get("/reservations/all", handlers.Repo.AdminAllReservations)
+				mux.Get("/reservations/export", handlers.Repo.AdminExportReservations)
+				mux.Get("/reservations/calendar", handlers.Repo.AdminCalendarReservations)
+				mux.Get("/reservations/details/{id}", handlers.Repo.AdminReservationSummary)
+			})
+
+			mux.With(permission(app, rbac.EditReservations)).Post("/reservations/details/{id}", handlers.Repo.PostAdminReservationSummary)
+			mux.With(permission(app, rbac.EditReservations)).Post("/reservations/details/{id}/reschedule", handlers.Repo.PostAdminRescheduleReservation)
 
-		mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
-			http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
+			mux.Group(func(mux chi.Router) {
+				mux.Use(permission(app, rbac.ManageUsers))
+
+				mux.Get("/users", handlers.Repo.AdminListUsers)
+				mux.Get("/users/new", handlers.Repo.AdminCreateUser)
+				mux.Post("/users/new", handlers.Repo.PostAdminCreateUser)
+				mux.Get("/users/details/{id}", handlers.Repo.AdminUserSummary)
+				mux.Post("/users/details/{id}", handlers.Repo.PostAdminUserSummary)
+				mux.Post("/users/details/{id}/tokens", handlers.Repo.PostAdminCreateAPIToken)
+				mux.Post("/users/details/{id}/tokens/{tokenID}/revoke", handlers.Repo.PostAdminRevokeAPIToken)
+			})
+
+			mux.Group(func(mux chi.Router) {
+				mux.Use(permission(app, rbac.ManageRooms))
+
+				mux.Get("/rooms", handlers.Repo.AdminRooms)
+				mux.Get("/rooms/new", handlers.Repo.AdminCreateRoom)
+				mux.Post("/rooms/new", handlers.Repo.PostAdminCreateRoom)
+				mux.Get("/rooms/{id}", handlers.Repo.AdminRoomDetails)
+				mux.Post("/rooms/{id}", handlers.Repo.PostAdminRoomDetails)
+				mux.Post("/rooms/{id}/delete", handlers.Repo.PostAdminDeleteRoom)
+				mux.Get("/rooms/{id}/photos", handlers.Repo.AdminRoomPhotos)
+				mux.Post("/rooms/{id}/photos", handlers.Repo.PostAdminRoomPhotos)
+				mux.Post("/rooms/{id}/photos/{photoID}/cover", handlers.Repo.PostAdminRoomPhotoCover)
+				mux.Post("/rooms/{id}/photos/{photoID}/move", handlers.Repo.PostAdminMoveRoomPhoto)
+				mux.Post("/rooms/{id}/photos/{photoID}/delete", handlers.Repo.PostAdminDeleteRoomPhoto)
+				mux.Get("/rooms/{id}/rules", handlers.Repo.AdminStayRules)
+				mux.Post("/rooms/{id}/rules", handlers.Repo.PostAdminStayRule)
+				mux.Post("/rooms/{id}/rules/{ruleID}/delete", handlers.Repo.PostAdminDeleteStayRule)
+				mux.Get("/rooms/{id}/blocks", handlers.Repo.AdminRoomBlocks)
+				mux.Post("/rooms/{id}/blocks", handlers.Repo.PostAdminRoomBlock)
+				mux.Post("/rooms/{id}/blocks/{blockID}/delete", handlers.Repo.PostAdminDeleteRoomBlock)
+				mux.Get("/rooms/{id}/calendars", handlers.Repo.AdminCalendarImports)
+				mux.Post("/rooms/{id}/calendars", handlers.Repo.PostAdminCalendarImport)
+				mux.Post("/rooms/{id}/calendars/{importID}/sync", handlers.Repo.PostAdminSyncCalendarImport)
+				mux.Post("/rooms/{id}/calendars/{importID}/upload", handlers.Repo.PostAdminUploadCalendarImport)
+				mux.Post("/rooms/{id}/calendars/{importID}/delete", handlers.Repo.PostAdminDeleteCalendarImport)
+				mux.Get("/feeds", handlers.Repo.AdminCalendarFeeds)
+				mux.Post("/feeds", handlers.Repo.PostAdminCreateCalendarFeed)
+				mux.Post("/feeds/{id}/delete", handlers.Repo.PostAdminDeleteCalendarFeed)
+			})
+
+			mux.Group(func(mux chi.Router) {
+				mux.Use(permission(app, rbac.ManageMail))
+
+				mux.Get("/mail", handlers.Repo.AdminMailOutbox)
+				mux.Post("/mail/{id}/resend", handlers.Repo.PostAdminResendMail)
+				mux.Get("/mail/templates", handlers.Repo.AdminMailTemplates)
+				mux.Get("/mail/templates/{name}", handlers.Repo.AdminPreviewMailTemplate)
+			})
 		})
-		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
-		mux.Get("/reservations/new", handlers.Repo.AdminNewReservations)
-		mux.Get("/reservations/all", handlers.Repo.AdminAllReservations)
-		mux.Get("/reservations/calendar", handlers.Repo.AdminCalendarReservations)
-		mux.Get("/reservations/calendar/json", handlers.Repo.JsonAdminCalendarReservations)
-		mux.Get("/reservations/details/{id}", handlers.Repo.AdminReservationSummary)
-		mux.Post("/reservations/details/{id}", handlers.Repo.PostAdminReservationSummary)
-		mux.Post("/reservations/processed", handlers.Repo.PostJsonAdminChangeResStatus)
-		mux.Post("/reservations/delete", handlers.Repo.PostJsonAdminDeleteRes)
-		mux.Get("/users", handlers.Repo.AdminListUsers)
-		mux.Get("/users/new", handlers.Repo.AdminCreateUser)
-		mux.Post("/users/new", handlers.Repo.PostAdminCreateUser)
-		mux.Get("/users/details/{id}", handlers.Repo.AdminUserSummary)
-		mux.Post("/users/details/{id}", handlers.Repo.PostAdminUserSummary)
-		mux.Post("/users/delete", handlers.Repo.PostJsonAdminDeleteUser)
 	})
 
 	mux.NotFound(handlers.Repo.NotFound)
@@ -62,18 +155,91 @@ func Routes(app *config.AppConfig) http.Handler {
 	fileServer := http.FileServer(http.Dir("./static"))
 	mux.Handle("/static/*", http.StripPrefix("/static/", fileServer))
 
+	if app.Photos != nil {
+		photoServer := http.FileServer(http.Dir(app.Photos.Dir()))
+		mux.Handle("/photos/*", http.StripPrefix("/photos/", noDirListing(photoServer)))
+	}
+
 	return mux
 }
 
+// noDirListing answers 404 for directory paths so uploaded files can't be enumerated
+func noDirListing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// uploadLimit is the largest body accepted by the POST route matching pattern
+type uploadLimit struct {
+	pattern string
+	limit   func() int64
+}
+
+// limitUploads caps the body of the upload routes and reads their form straight away,
+// answering 413 when it is too large. It must run before noSurf, which otherwise reads
+// the whole body looking for the CSRF token.
+func limitUploads(limits ...uploadLimit) func(http.Handler) http.Handler {
+	routes := make([]*chi.Mux, len(limits))
+	for i, l := range limits {
+		routes[i] = chi.NewRouter()
+		routes[i].Post(l.pattern, http.NotFound)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i, l := range limits {
+				if !routes[i].Match(chi.NewRouteContext(), r.Method, r.URL.Path) {
+					continue
+				}
+
+				limit := l.limit()
+				if r.ContentLength > limit {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+				// a form that fails to parse for another reason is left to the handler
+				var tooLarge *http.MaxBytesError
+				if err := r.ParseMultipartForm(32 << 20); errors.As(err, &tooLarge) {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+
+				break
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // sessionLoad loads and saves the session on every request
 func sessionLoad(session *scs.SessionManager) func(http.Handler) http.Handler {
 	return session.LoadAndSave
 }
 
-// noSurf adds CSRF protection to all POST requests
+// noSurf adds CSRF protection to all POST requests. The JSON API and requests
+// authenticated with a bearer token are exempt since they do not rely on cookies.
+// A bearer request that also carries the session cookie is still checked, as a
+// forged request can add any header but the browser adds the cookie.
 func noSurf(app *config.AppConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		csrfHandler := nosurf.New(next)
+		csrfHandler.ExemptFunc(func(r *http.Request) bool {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				return true
+			}
+
+			_, hasToken := bearerToken(r)
+			return hasToken && !hasSessionCookie(app, r)
+		})
 		csrfHandler.SetBaseCookie(http.Cookie{
 			HttpOnly: true,
 			Path:     "/",
@@ -96,3 +262,82 @@ func auth(session *scs.SessionManager) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// tokenAuth authenticates requests carrying a personal API token in the Authorization
+// header and falls back to the session for everything else
+func tokenAuth(app *config.AppConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		sessionAuth := auth(app.Session)(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				sessionAuth.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := handlers.Repo.DB.GetUserByAPIToken(tokens.HashAPIToken(token))
+			if err != nil {
+				if !errors.Is(err, sql.ErrNoRows) {
+					app.ErrorLog.Println(err)
+				}
+
+				w.Header().Set("WWW-Authenticate", `Bearer realm="bookings"`)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"ok":false,"message":"Invalid API token"}`))
+				return
+			}
+
+			next.ServeHTTP(w, helpers.WithUser(r, user))
+		})
+	}
+}
+
+// hasSessionCookie reports whether the request carries the session cookie
+func hasSessionCookie(app *config.AppConfig, r *http.Request) bool {
+	_, err := r.Cookie(app.Session.Cookie.Name)
+	return err == nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// permission redirects users whose role lacks p back to the dashboard
+func permission(app *config.AppConfig, p rbac.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := helpers.CurrentUser(r)
+			if !ok || !rbac.Can(user.AccessLevel, p) {
+				app.Session.Put(r.Context(), "error", "You don't have permission for this")
+				http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// jsonPermission answers 403 Forbidden to users whose role lacks p
+func jsonPermission(p rbac.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := helpers.CurrentUser(r)
+			if !ok || !rbac.Can(user.AccessLevel, p) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"ok":false,"message":"You don't have permission for this"}`))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
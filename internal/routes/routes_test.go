@@ -1,13 +1,24 @@
 package routes
 
 import (
+	"bytes"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/justinas/nosurf"
+	"github.com/mlvieira/bookings/internal/calsync"
 	"github.com/mlvieira/bookings/internal/config"
+	"github.com/mlvieira/bookings/internal/handlers"
+	"github.com/mlvieira/bookings/internal/helpers"
+	"github.com/mlvieira/bookings/internal/models"
+	"github.com/mlvieira/bookings/internal/photos"
+	"github.com/mlvieira/bookings/internal/rbac"
+	dbrepo "github.com/mlvieira/bookings/internal/repository/dbRepo"
 )
 
 func TestRoutes(t *testing.T) {
@@ -148,3 +159,224 @@ func TestNoSurf(t *testing.T) {
 		t.Errorf("Expected status 200 when CSRF token is valid, got %d", rr3.Code)
 	}
 }
+
+func TestTokenAuth(t *testing.T) {
+	session := scs.New()
+	app := &config.AppConfig{
+		Session:  session,
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	handlers.NewHandlers(&handlers.Repository{App: app, DB: dbrepo.NewTestRepo(app)})
+	helpers.NewHelpers(app)
+
+	var gotUser models.User
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = helpers.CurrentUser(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		expectedCode  int
+	}{
+		{"Valid token", "Bearer bk_test-token", http.StatusOK},
+		{"Lowercase scheme", "bearer bk_test-token", http.StatusOK},
+		{"Unknown token", "Bearer bk_unknown", http.StatusUnauthorized},
+		{"No token falls back to session", "", http.StatusSeeOther},
+		{"Other scheme falls back to session", "Basic dXNlcjpwYXNz", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = models.User{}
+			req := httptest.NewRequest("POST", "/admin/reservations/status", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			sessionLoad(session)(tokenAuth(app)(next)).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedCode == http.StatusOK && gotUser.ID != 1 {
+				t.Errorf("expected the token owner on the request, got %+v", gotUser)
+			}
+		})
+	}
+}
+
+func TestNoSurfBearerExempt(t *testing.T) {
+	app := &config.AppConfig{
+		InProduction: false,
+		Session:      scs.New(),
+	}
+
+	wrappedHandler := noSurf(app)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		withSession   bool
+		expectedCode  int
+	}{
+		{"Bearer token", "/admin/reservations/status", "Bearer bk_test-token", false, http.StatusOK},
+		{"Bearer token with session cookie", "/admin/reservations/status", "Bearer bk_forged", true, http.StatusBadRequest},
+		{"JSON API", "/api/v1/reservations", "", false, http.StatusOK},
+		{"Session request", "/admin/reservations/status", "", true, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.withSession {
+				req.AddCookie(&http.Cookie{Name: app.Session.Cookie.Name, Value: "session-token"})
+			}
+
+			rr := httptest.NewRecorder()
+			wrappedHandler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected %d, got %d", tt.expectedCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestPermission(t *testing.T) {
+	session := scs.New()
+	app := &config.AppConfig{
+		Session: session,
+	}
+	helpers.NewHelpers(app)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		accessLevel  int
+		json         bool
+		expectedCode int
+	}{
+		{"Owner", int(rbac.Owner), false, http.StatusOK},
+		{"Front desk", int(rbac.FrontDesk), false, http.StatusSeeOther},
+		{"Owner JSON", int(rbac.Owner), true, http.StatusOK},
+		{"Manager JSON", int(rbac.Manager), true, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handler http.Handler
+			if tt.json {
+				handler = jsonPermission(rbac.ManageUsers)(ok)
+			} else {
+				handler = permission(app, rbac.ManageUsers)(ok)
+			}
+
+			req := httptest.NewRequest("POST", "/admin/users/delete", nil)
+			req = helpers.WithUser(req, models.User{ID: 1, AccessLevel: tt.accessLevel})
+
+			rr := httptest.NewRecorder()
+			sessionLoad(session)(handler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedCode == http.StatusSeeOther && rr.Header().Get("Location") != "/admin/dashboard" {
+				t.Errorf("expected redirect to the dashboard, got %q", rr.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+// multipartUpload returns a multipart body with a file of size bytes in field
+func multipartUpload(t *testing.T, field string, size int64) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	fw, err := mw.CreateFormFile(field, "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(make([]byte, size))
+
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &body, mw.FormDataContentType()
+}
+
+func TestLimitUploads(t *testing.T) {
+	discard := log.New(io.Discard, "", 0)
+
+	store, err := photos.New(t.TempDir(), photos.Options{MaxFileSize: 64 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &config.AppConfig{
+		Session:  scs.New(),
+		Photos:   store,
+		InfoLog:  discard,
+		ErrorLog: discard,
+	}
+	repo := dbrepo.NewTestRepo(app)
+	app.CalendarSync = calsync.New(repo, calsync.Options{MaxFeedSize: 64 << 10, ErrorLog: discard, InfoLog: discard})
+	handlers.NewHandlers(&handlers.Repository{App: app, DB: repo})
+	helpers.NewHelpers(app)
+
+	mux := Routes(app)
+
+	tests := []struct {
+		name         string
+		path         string
+		field        string
+		size         int64
+		chunked      bool
+		expectedCode int
+	}{
+		{"Photos over the limit", "/admin/rooms/1/photos", "photos", handlers.Repo.PhotoUploadLimit(), false, http.StatusRequestEntityTooLarge},
+		{"Photos over the limit without a length", "/admin/rooms/1/photos", "photos", handlers.Repo.PhotoUploadLimit(), true, http.StatusRequestEntityTooLarge},
+		// the limit lets the form through to the CSRF check, which the test doesn't pass
+		{"Photos within the limit", "/admin/rooms/1/photos", "photos", 32 << 10, false, http.StatusBadRequest},
+		{"Calendar over the limit", "/admin/rooms/1/calendars/1/upload", "calendar", handlers.Repo.CalendarUploadLimit(), false, http.StatusRequestEntityTooLarge},
+		{"Calendar over the limit without a length", "/admin/rooms/1/calendars/1/upload", "calendar", handlers.Repo.CalendarUploadLimit(), true, http.StatusRequestEntityTooLarge},
+		{"Calendar within the limit", "/admin/rooms/1/calendars/1/upload", "calendar", 32 << 10, false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := multipartUpload(t, tt.field, tt.size)
+
+			var reader io.Reader = body
+			if tt.chunked {
+				reader = io.MultiReader(body)
+			}
+
+			req := httptest.NewRequest("POST", tt.path, reader)
+			req.Header.Set("Content-Type", contentType)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected %d, got %d", tt.expectedCode, rr.Code)
+			}
+		})
+	}
+}
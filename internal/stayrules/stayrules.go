@@ -0,0 +1,131 @@
+// Package stayrules checks stays against the minimum and maximum nights,
+// closed-to-arrival and closed-to-departure days, lead time and booking horizon
+// configured for a room.
+package stayrules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/dates"
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+// Names of the rules reported in a violation
+const (
+	MinNights         = "min_nights"
+	MaxNights         = "max_nights"
+	ClosedToArrival   = "closed_to_arrival"
+	ClosedToDeparture = "closed_to_departure"
+	LeadTime          = "lead_time"
+	Horizon           = "horizon"
+)
+
+// Applicable returns the rule that governs a stay arriving on start: the first
+// seasonal rule covering the arrival, otherwise the room's default rule.
+func Applicable(rules []models.StayRule, start time.Time) (models.StayRule, bool) {
+	start = dates.TruncateDay(start)
+
+	var fallback models.StayRule
+	var hasFallback bool
+
+	for _, rule := range rules {
+		if IsDefault(rule) {
+			if !hasFallback {
+				fallback, hasFallback = rule, true
+			}
+			continue
+		}
+
+		if !start.Before(dates.TruncateDay(rule.StartDate)) && !start.After(dates.TruncateDay(rule.EndDate)) {
+			return rule, true
+		}
+	}
+
+	return fallback, hasFallback
+}
+
+// IsDefault reports whether rule applies all year round
+func IsDefault(rule models.StayRule) bool {
+	return rule.StartDate.IsZero()
+}
+
+// Check returns the first rule the stay from start to end breaks when booked on
+// today, or nil when the stay is allowed
+func Check(rules []models.StayRule, start, end, today time.Time) *models.StayRuleViolation {
+	rule, ok := Applicable(rules, start)
+	if !ok {
+		return nil
+	}
+
+	start, end, today = dates.TruncateDay(start), dates.TruncateDay(end), dates.TruncateDay(today)
+
+	nights := dates.DaysBetween(start, end)
+	ahead := dates.DaysBetween(today, start)
+
+	violation := func(name, format string, args ...any) *models.StayRuleViolation {
+		msg := fmt.Sprintf(format, args...)
+		if rule.SeasonName != "" {
+			msg = fmt.Sprintf("%s (%s)", msg, rule.SeasonName)
+		}
+
+		return &models.StayRuleViolation{
+			RoomID:  rule.RoomID,
+			Rule:    name,
+			Message: msg,
+		}
+	}
+
+	switch {
+	case rule.LeadDays > 0 && ahead < rule.LeadDays:
+		return violation(LeadTime, "Stays must be booked at least %s before arrival", plural(rule.LeadDays, "day"))
+	case rule.HorizonDays > 0 && ahead > rule.HorizonDays:
+		return violation(Horizon, "Stays can be booked at most %s in advance", plural(rule.HorizonDays, "day"))
+	case IsClosed(rule.ClosedToArrival, start.Weekday()):
+		return violation(ClosedToArrival, "Arrivals are not possible on %ss", start.Weekday())
+	case IsClosed(rule.ClosedToDeparture, end.Weekday()):
+		return violation(ClosedToDeparture, "Departures are not possible on %ss", end.Weekday())
+	case rule.MinNights > 0 && nights < rule.MinNights:
+		return violation(MinNights, "The minimum stay is %s", plural(rule.MinNights, "night"))
+	case rule.MaxNights > 0 && nights > rule.MaxNights:
+		return violation(MaxNights, "The maximum stay is %s", plural(rule.MaxNights, "night"))
+	}
+
+	return nil
+}
+
+// IsClosed reports whether day is set in a weekday bitmask
+func IsClosed(mask int, day time.Weekday) bool {
+	return mask&(1<<day) != 0
+}
+
+// Weekdays returns a weekday bitmask with the given days set
+func Weekdays(days ...time.Weekday) int {
+	var mask int
+	for _, day := range days {
+		mask |= 1 << day
+	}
+
+	return mask
+}
+
+// DayNames lists the days set in a weekday bitmask, e.g. "Sat, Sun"
+func DayNames(mask int) string {
+	var names []string
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if IsClosed(mask, day) {
+			names = append(names, day.String()[:3])
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,86 @@
+package stayrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mlvieira/bookings/internal/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestCheck(t *testing.T) {
+	rules := []models.StayRule{
+		{
+			RoomID:            1,
+			MinNights:         2,
+			MaxNights:         14,
+			ClosedToArrival:   Weekdays(time.Sunday),
+			ClosedToDeparture: Weekdays(time.Monday),
+			LeadDays:          2,
+			HorizonDays:       365,
+		},
+		{
+			RoomID:     1,
+			SeasonName: "Holidays",
+			StartDate:  date(2050, 12, 20),
+			EndDate:    date(2050, 12, 31),
+			MinNights:  5,
+		},
+	}
+
+	// 2050-06-01 is a Wednesday
+	today := date(2050, 6, 1)
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		rule       string
+		message    string
+	}{
+		{"Allowed", date(2050, 6, 10), date(2050, 6, 14), "", ""},
+		{"Too soon", date(2050, 6, 2), date(2050, 6, 5), LeadTime, "Stays must be booked at least 2 days before arrival"},
+		{"Too far ahead", date(2051, 6, 10), date(2051, 6, 14), Horizon, "Stays can be booked at most 365 days in advance"},
+		{"Sunday arrival", date(2050, 6, 12), date(2050, 6, 15), ClosedToArrival, "Arrivals are not possible on Sundays"},
+		{"Monday departure", date(2050, 6, 10), date(2050, 6, 13), ClosedToDeparture, "Departures are not possible on Mondays"},
+		{"One night", date(2050, 6, 10), date(2050, 6, 11), MinNights, "The minimum stay is 2 nights"},
+		{"Too long", date(2050, 6, 10), date(2050, 6, 30), MaxNights, "The maximum stay is 14 nights"},
+		{"Seasonal minimum", date(2050, 12, 22), date(2050, 12, 25), MinNights, "The minimum stay is 5 nights (Holidays)"},
+		{"Seasonal rule replaces default", date(2050, 12, 22), date(2050, 12, 27), "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Check(rules, tt.start, tt.end, today)
+
+			if tt.rule == "" {
+				if v != nil {
+					t.Fatalf("expected the stay to be allowed, got %+v", v)
+				}
+				return
+			}
+
+			if v == nil {
+				t.Fatalf("expected a %s violation, got none", tt.rule)
+			}
+
+			if v.Rule != tt.rule || v.Message != tt.message || v.RoomID != 1 {
+				t.Errorf("unexpected violation %+v", v)
+			}
+		})
+	}
+}
+
+func TestCheck_NoRules(t *testing.T) {
+	if v := Check(nil, date(2050, 6, 10), date(2050, 6, 11), date(2050, 6, 10)); v != nil {
+		t.Errorf("expected no violation without rules, got %+v", v)
+	}
+}
+
+func TestDayNames(t *testing.T) {
+	if got := DayNames(Weekdays(time.Saturday, time.Sunday)); got != "Sun, Sat" {
+		t.Errorf("expected %q, got %q", "Sun, Sat", got)
+	}
+}
@@ -0,0 +1,48 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// APITokenPrefix marks personal API tokens so they are easy to recognise in logs and secret scanners
+const APITokenPrefix = "bk_"
+
+// FeedTokenPrefix marks the secrets of calendar feed URLs
+const FeedTokenPrefix = "cal_"
+
+// NewAPIToken generates a random personal API token. Only its hash should be stored.
+func NewAPIToken() (string, error) {
+	return randomToken(APITokenPrefix)
+}
+
+// HashAPIToken returns the hex encoded SHA-256 hash stored in place of a personal API token
+func HashAPIToken(token string) string {
+	return hashToken(token)
+}
+
+// NewFeedToken generates the random secret of a calendar feed URL. Only its hash should be stored.
+func NewFeedToken() (string, error) {
+	return randomToken(FeedTokenPrefix)
+}
+
+// HashFeedToken returns the hex encoded SHA-256 hash stored in place of a calendar feed secret
+func HashFeedToken(token string) string {
+	return hashToken(token)
+}
+
+func randomToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
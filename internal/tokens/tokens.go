@@ -0,0 +1,82 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned when a token is malformed or its signature does not match
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned when a valid token is past its expiry time
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Sign creates a URL-safe token for id that expires at the given time
+func Sign(key []byte, purpose string, id int, expires time.Time) string {
+	payload := fmt.Sprintf("%d.%d", id, expires.Unix())
+
+	return encode([]byte(payload)) + "." + encode(mac(key, purpose, payload))
+}
+
+// Verify checks the signature and expiry of a token and returns the id it was signed for
+func Verify(key []byte, purpose, token string, now time.Time) (int, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	if !hmac.Equal(sig, mac(key, purpose, string(payload))) {
+		return 0, ErrInvalidToken
+	}
+
+	idStr, expiresStr, ok := strings.Cut(string(payload), ".")
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	if now.Unix() > expires {
+		return id, ErrExpiredToken
+	}
+
+	return id, nil
+}
+
+// mac signs the payload, binding it to a purpose so tokens can't be reused elsewhere
+func mac(key []byte, purpose, payload string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(purpose))
+	h.Write([]byte{0})
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,112 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var key = []byte("test-signing-key")
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Date(2050, 12, 1, 0, 0, 0, 0, time.UTC)
+	token := Sign(key, "reservation", 42, now.Add(time.Hour))
+
+	id, err := Verify(key, "reservation", token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != 42 {
+		t.Errorf("expected id 42, got %d", id)
+	}
+}
+
+func TestVerify_Expired(t *testing.T) {
+	now := time.Date(2050, 12, 1, 0, 0, 0, 0, time.UTC)
+	token := Sign(key, "reservation", 42, now.Add(-time.Hour))
+
+	_, err := Verify(key, "reservation", token, now)
+	if !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestVerify_Invalid(t *testing.T) {
+	now := time.Date(2050, 12, 1, 0, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	token := Sign(key, "reservation", 42, expires)
+
+	_, sig, _ := strings.Cut(token, ".")
+	tampered := encode([]byte(fmt.Sprintf("43.%d", expires.Unix()))) + "." + sig
+
+	tests := map[string]struct {
+		key     []byte
+		purpose string
+		token   string
+	}{
+		"Wrong key":     {[]byte("other-key"), "reservation", token},
+		"Wrong purpose": {key, "api", token},
+		"Tampered":      {key, "reservation", tampered},
+		"Malformed":     {key, "reservation", "not-a-token"},
+		"Empty":         {key, "reservation", ""},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Verify(test.key, test.purpose, test.token, now)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewAPIToken(t *testing.T) {
+	a, err := NewAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Error("expected distinct tokens")
+	}
+
+	if !strings.HasPrefix(a, APITokenPrefix) {
+		t.Errorf("expected token to start with %q, got %q", APITokenPrefix, a)
+	}
+
+	if HashAPIToken(a) != HashAPIToken(a) || HashAPIToken(a) == HashAPIToken(b) {
+		t.Error("expected hashes to be deterministic and distinct per token")
+	}
+
+	if len(HashAPIToken(a)) != 64 {
+		t.Errorf("expected a 64 character hash, got %d", len(HashAPIToken(a)))
+	}
+}
+
+func TestNewFeedToken(t *testing.T) {
+	token, err := NewFeedToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(token, FeedTokenPrefix) {
+		t.Errorf("expected token to start with %q, got %q", FeedTokenPrefix, token)
+	}
+
+	if strings.ContainsAny(token, "./") {
+		t.Errorf("expected a token that fits in a URL path segment, got %q", token)
+	}
+
+	if len(HashFeedToken(token)) != 64 {
+		t.Errorf("expected a 64 character hash, got %d", len(HashFeedToken(token)))
+	}
+}
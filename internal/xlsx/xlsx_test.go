@@ -0,0 +1,105 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, "Reservations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteHeader([]string{"ID", "Name", "Arrival", "Total"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteRow([]any{1, `<John & "Jane">`, time.Date(2050, 12, 17, 0, 0, 0, 0, time.UTC), 250.5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteRow([]any{2}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parts[f.Name] = string(b)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		content, ok := parts[name]
+		if !ok {
+			t.Fatalf("missing part %s", name)
+		}
+
+		// every part must be well-formed XML
+		d := xml.NewDecoder(strings.NewReader(content))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+
+	for _, expected := range []string{
+		`<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">ID</t></is></c>`,
+		`<c r="A2"><v>1</v></c>`,
+		`<t xml:space="preserve">&lt;John &amp; &#34;Jane&#34;&gt;</t>`,
+		`<t xml:space="preserve">2050-12-17</t>`,
+		`<c r="D2"><v>250.5</v></c>`,
+	} {
+		if !strings.Contains(sheet, expected) {
+			t.Errorf("expected the sheet to contain %s", expected)
+		}
+	}
+
+	if !strings.Contains(parts["xl/workbook.xml"], `name="Reservations"`) {
+		t.Error("expected the sheet name in the workbook")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"}
+
+	for i, expected := range tests {
+		if got := ColumnName(i); got != expected {
+			t.Errorf("ColumnName(%d) = %s, want %s", i, got, expected)
+		}
+	}
+}
@@ -0,0 +1 @@
+truncate table room_rates;
@@ -0,0 +1,4 @@
+INSERT INTO room_rates (room_id,base_rate,weekend_rate,created_at,updated_at) VALUES
+	 (1,12000,15000,'2024-12-10 00:00:00.000','2024-12-10 00:00:00.000'),
+	 (2,18000,22000,'2024-12-10 00:00:00.000','2024-12-10 00:00:00.000');
+
@@ -0,0 +1,2 @@
+DELETE FROM room_restrictions WHERE restriction_id = 3;
+DELETE FROM restrictions WHERE id = 3;
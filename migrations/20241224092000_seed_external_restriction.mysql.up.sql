@@ -0,0 +1,2 @@
+INSERT INTO restrictions (id,restriction_name,created_at,updated_at) VALUES
+	 (3,'External','2024-12-24 00:00:00.000','2024-12-24 00:00:00.000');
@@ -0,0 +1,2 @@
+UPDATE reservations SET processed = 1 WHERE status IN ('confirmed', 'checked_in', 'checked_out');
+UPDATE reservations SET cancelled = 1 WHERE status IN ('cancelled', 'no_show');
@@ -0,0 +1,2 @@
+UPDATE reservations SET status = 'confirmed', confirmed_at = updated_at WHERE processed = 1 AND cancelled = 0;
+UPDATE reservations SET status = 'cancelled', cancelled_at = updated_at WHERE cancelled = 1;
@@ -1,3 +1,58 @@
+// escapeHTML keeps guest names and block reasons from being interpreted as markup in the popup
+const escapeHTML = (value) => {
+    const div = document.createElement('div');
+    div.textContent = value ?? '';
+    return div.innerHTML;
+};
+
+// isoDate formats a calendar date as YYYY-MM-DD in local time, the way all-day events are stored
+const isoDate = (date) => {
+    const pad = (n) => String(n).padStart(2, '0');
+    return `${date.getFullYear()}-${pad(date.getMonth() + 1)}-${pad(date.getDate())}`;
+};
+
+// moveReservation saves a reservation dragged or resized on the calendar, putting it
+// back where it was when the server refuses the move
+const moveReservation = async (info) => {
+    const event = info.event;
+
+    let end = event.end;
+    if (!end) {
+        const oldEvent = info.oldEvent;
+        const nights = Math.max(1, Math.round((oldEvent.end - oldEvent.start) / 86400000) || 1);
+        end = new Date(event.start);
+        end.setDate(end.getDate() + nights);
+    }
+
+    try {
+        const response = await fetch('/admin/reservations/calendar/move', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest',
+                'X-CSRF-Token': document.querySelector('input[name="csrf_token"]').value,
+            },
+            body: JSON.stringify({
+                id: parseInt(event.id, 10),
+                start: isoDate(event.start),
+                end: isoDate(end),
+                roomId: event.extendedProps.roomId,
+            }),
+        });
+
+        const data = await response.json().catch(() => null);
+        if (!response.ok || !data) {
+            throw new Error(data?.error ?? 'The reservation could not be moved');
+        }
+
+        event.setExtendedProp('lastUpdated', data.extendedProps.lastUpdated);
+        Prompt().toast({ msg: 'Reservation moved, the guest has been emailed the new dates' });
+    } catch (error) {
+        info.revert();
+        Prompt().error({ msg: error.message });
+    }
+};
+
 document.addEventListener('DOMContentLoaded', () => {
     const calendarEl = document.getElementById('calendar');
     const calendar = new FullCalendar.Calendar(calendarEl, {
@@ -12,6 +67,9 @@ document.addEventListener('DOMContentLoaded', () => {
             right: 'dayGridMonth,timeGridWeek,timeGridDay,listMonth'
         },
         events: '/admin/reservations/calendar/json',
+        // only reservations the user may change come with editable set
+        eventDrop: moveReservation,
+        eventResize: moveReservation,
         eventClick: (info) => {
             const event = info.event;
 
@@ -21,13 +79,19 @@ document.addEventListener('DOMContentLoaded', () => {
                 ? new Date(event.extendedProps.lastUpdated).toLocaleString()
                 : "N/A";
             const url = event.url;
-            const name = event.extendedProps.name;
-            const roomName = event.extendedProps.room;
+            const name = escapeHTML(event.extendedProps.name);
+            const roomName = escapeHTML(event.extendedProps.room);
+            const isBlock = event.extendedProps.type === 'block';
 
             const prompt = Prompt();
             prompt.custom({
-                title: 'Reservation Details',
-                msg: `
+                title: isBlock ? 'Blocked Dates' : 'Reservation Details',
+                msg: isBlock ? `
+                    <p><strong>Room:</strong> ${roomName}</p>
+                    <p><strong>Reason:</strong> ${escapeHTML(event.extendedProps.reason)}</p>
+                    <p><strong>Start:</strong> ${start}</p>
+                    <p><strong>End:</strong> ${end}</p>
+                ` : `
                     <p><strong>Room:</strong> ${roomName}</p>
                     <p><strong>Full Name:</strong> ${name}</p>
                     <p><strong>Start:</strong> ${start}</p>
@@ -37,7 +101,7 @@ document.addEventListener('DOMContentLoaded', () => {
                 showConfirmButton: true,
                 showCancelButton: true,
                 allowOutsideClick: true,
-                confirmButtonText: "Edit",
+                confirmButtonText: isBlock ? "Manage blocks" : "Edit",
                 cancelButtonText: "Close",
                 callback: (result) => {
                     if (result) {
@@ -50,4 +114,10 @@ document.addEventListener('DOMContentLoaded', () => {
         },
     });
     calendar.render();
+
+    // the calendar was hidden while the rooms timeline was open, where reservations may have moved
+    document.getElementById('calendar-tab')?.addEventListener('shown.bs.tab', () => {
+        calendar.updateSize();
+        calendar.refetchEvents();
+    });
 });
\ No newline at end of file
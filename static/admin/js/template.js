@@ -57,7 +57,7 @@ document.addEventListener('DOMContentLoaded', () => {
         });
     }
 
-    const sendRequest = async (url, id, alert) => {
+    const sendRequest = async (url, id, alert, extra = {}) => {
         try {
             const response = await fetch(url, {
                 method: 'POST',
@@ -66,14 +66,15 @@ document.addEventListener('DOMContentLoaded', () => {
                     'X-Requested-With': 'XMLHttpRequest',
                     'X-CSRF-Token': document.querySelector('input[name="csrf_token"]').value,
                 },
-                body: JSON.stringify({ id: parseInt(id, 10) }),
+                body: JSON.stringify({ id: parseInt(id, 10), ...extra }),
             });
 
-            if (!response.ok) {
+            // permission errors (403) still carry a JSON message worth showing
+            const data = await response.json().catch(() => null);
+            if (!data) {
                 throw new Error('Http error!');
             }
 
-            const data = await response.json();
             if (data.ok) {
                 alert.success({
                     msg: data.message,
@@ -111,9 +112,6 @@ document.addEventListener('DOMContentLoaded', () => {
                             const alertResult = await sendRequest(url, id, alert);
                             if (alertResult) {
                                 switch (selector) {
-                                    case '#markProcessed':
-                                        btn.disabled = true;
-                                        break;
                                     case '#deleteRes':
                                         setTimeout(() => {
                                             window.location.href = `/admin/reservations/${btn.dataset.source}`;
@@ -132,7 +130,29 @@ document.addEventListener('DOMContentLoaded', () => {
             });
         }
     };
-    handleAction('#markProcessed', '/admin/reservations/processed');
+    document.querySelectorAll('.changeStatus').forEach((btn) => {
+        btn.addEventListener('click', (event) => {
+            event.preventDefault();
+            const alert = Prompt();
+
+            alert.custom({
+                msg: `Are you sure you want to mark this reservation as ${btn.textContent.replace(/^Mark as /, '').toLowerCase()}?`,
+                icon: "warning",
+                allowOutsideClick: true,
+                showCancelButton: true,
+                callback: async (isConfirmed) => {
+                    if (isConfirmed) {
+                        const alertResult = await sendRequest('/admin/reservations/status', btn.dataset.id, alert, { status: btn.dataset.status });
+                        if (alertResult) {
+                            setTimeout(() => {
+                                window.location.reload();
+                            }, 2000);
+                        }
+                    }
+                },
+            });
+        });
+    });
     handleAction('#deleteRes', '/admin/reservations/delete');
     handleAction('#deleteUsr', '/admin/users/delete');
 });
@@ -0,0 +1,242 @@
+// The rooms timeline shows one row per room and one column per day. Reservations and
+// blocks are bars spanning the nights they take; editable reservations can be dragged
+// onto another room or day, keeping their number of nights.
+(() => {
+    const days = 14;
+    const dayMs = 86400000;
+
+    // dates are handled as UTC midnights so adding days never trips over daylight saving
+    const parseDate = (value) => {
+        const [year, month, day] = value.split('-').map(Number);
+        return new Date(Date.UTC(year, month - 1, day));
+    };
+    const formatDate = (date) => date.toISOString().slice(0, 10);
+    const addDays = (date, n) => new Date(date.getTime() + n * dayMs);
+    const nightsBetween = (start, end) => Math.round((end - start) / dayMs);
+
+    const today = () => {
+        const now = new Date();
+        return new Date(Date.UTC(now.getFullYear(), now.getMonth(), now.getDate()));
+    };
+
+    let start = today();
+
+    const element = (tag, className, text) => {
+        const el = document.createElement(tag);
+        if (className) {
+            el.className = className;
+        }
+        if (text !== undefined) {
+            el.textContent = text;
+        }
+        return el;
+    };
+
+    // lanes spreads a room's events over as few rows as possible so overlapping
+    // events never share a row
+    const lanes = (events) => {
+        const rows = [];
+        events
+            .slice()
+            .sort((a, b) => a.start.localeCompare(b.start))
+            .forEach((event) => {
+                const row = rows.find((r) => r[r.length - 1].end <= event.start);
+                if (row) {
+                    row.push(event);
+                } else {
+                    rows.push([event]);
+                }
+            });
+        return rows.length ? rows : [[]];
+    };
+
+    const moveReservation = async (id, roomId, newStart, nights) => {
+        try {
+            const response = await fetch('/admin/reservations/calendar/move', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'X-Requested-With': 'XMLHttpRequest',
+                    'X-CSRF-Token': document.querySelector('input[name="csrf_token"]').value,
+                },
+                body: JSON.stringify({
+                    id: parseInt(id, 10),
+                    start: formatDate(newStart),
+                    end: formatDate(addDays(newStart, nights)),
+                    roomId: roomId,
+                }),
+            });
+
+            const data = await response.json().catch(() => null);
+            if (!response.ok || !data) {
+                throw new Error(data?.error ?? 'The reservation could not be moved');
+            }
+
+            Prompt().toast({ msg: 'Reservation moved, the guest has been emailed the new dates' });
+        } catch (error) {
+            Prompt().error({ msg: error.message });
+        }
+
+        load();
+    };
+
+    const bar = (event) => {
+        const link = element('a', `timeline-bar timeline-${event.type}`, event.title);
+        link.href = event.url;
+        link.title = `${event.title}: ${event.start} to ${event.end}`;
+        link.style.backgroundColor = event.color;
+        if (event.status) {
+            link.classList.add(`timeline-${event.status}`);
+        }
+
+        if (event.editable) {
+            link.draggable = true;
+            link.addEventListener('dragstart', (e) => {
+                const nights = nightsBetween(parseDate(event.start), parseDate(event.end));
+                e.dataTransfer.setData('text/plain', JSON.stringify({ id: event.id, nights: nights }));
+                e.dataTransfer.effectAllowed = 'move';
+            });
+        }
+
+        return link;
+    };
+
+    const dropCell = (roomId, date) => {
+        const cell = element('td', 'timeline-cell');
+        cell.addEventListener('dragover', (e) => {
+            e.preventDefault();
+            cell.classList.add('timeline-drop');
+        });
+        cell.addEventListener('dragleave', () => cell.classList.remove('timeline-drop'));
+        cell.addEventListener('drop', (e) => {
+            e.preventDefault();
+            cell.classList.remove('timeline-drop');
+
+            let moved;
+            try {
+                moved = JSON.parse(e.dataTransfer.getData('text/plain'));
+            } catch {
+                return;
+            }
+
+            moveReservation(moved.id, roomId, date, moved.nights);
+        });
+        return cell;
+    };
+
+    const render = (data) => {
+        const container = document.getElementById('timeline');
+        const rangeStart = parseDate(data.start);
+        const rangeDays = nightsBetween(rangeStart, parseDate(data.end));
+        const dates = Array.from({ length: rangeDays }, (_, i) => addDays(rangeStart, i));
+        const todayValue = formatDate(today());
+
+        document.getElementById('timeline-title').textContent =
+            `${formatDate(rangeStart)} to ${formatDate(addDays(rangeStart, rangeDays - 1))}`;
+
+        const table = element('table', 'table table-bordered table-sm mb-0');
+        const headRow = element('tr');
+        headRow.appendChild(element('th', 'timeline-room', 'Room'));
+        dates.forEach((date) => {
+            const th = element('th', 'timeline-day');
+            th.appendChild(element('div', 'small text-muted',
+                date.toLocaleDateString(undefined, { weekday: 'short', timeZone: 'UTC' })));
+            th.appendChild(element('div', '', String(date.getUTCDate())));
+            if (formatDate(date) === todayValue) {
+                th.classList.add('timeline-today');
+            }
+            headRow.appendChild(th);
+        });
+        table.appendChild(element('thead')).appendChild(headRow);
+
+        const body = table.appendChild(element('tbody'));
+
+        data.resources.forEach((room) => {
+            const rows = lanes(data.events.filter((event) => event.resourceId === room.id));
+
+            rows.forEach((row, laneIndex) => {
+                const tr = body.appendChild(element('tr'));
+
+                if (laneIndex === 0) {
+                    const th = element('th', 'timeline-room', room.title);
+                    th.rowSpan = rows.length;
+                    if (!room.active) {
+                        th.appendChild(element('div', 'small text-danger', 'Out of service'));
+                    }
+                    tr.appendChild(th);
+                }
+
+                let day = 0;
+                row.forEach((event) => {
+                    const first = Math.max(0, nightsBetween(rangeStart, parseDate(event.start)));
+                    const last = Math.min(rangeDays, nightsBetween(rangeStart, parseDate(event.end)));
+
+                    for (; day < first; day++) {
+                        tr.appendChild(dropCell(room.id, dates[day]));
+                    }
+
+                    if (last > day) {
+                        const td = element('td', 'timeline-cell timeline-span');
+                        td.colSpan = last - day;
+                        td.appendChild(bar(event));
+                        tr.appendChild(td);
+                        day = last;
+                    }
+                });
+
+                for (; day < rangeDays; day++) {
+                    tr.appendChild(dropCell(room.id, dates[day]));
+                }
+            });
+        });
+
+        container.replaceChildren(table);
+    };
+
+    const load = async () => {
+        const end = addDays(start, days);
+        const container = document.getElementById('timeline');
+
+        try {
+            const response = await fetch(
+                `/admin/reservations/timeline/json?start=${formatDate(start)}&end=${formatDate(end)}`,
+                { headers: { 'X-Requested-With': 'XMLHttpRequest' } },
+            );
+            const data = await response.json().catch(() => null);
+            if (!response.ok || !data) {
+                throw new Error(data?.error ?? 'The timeline could not be loaded');
+            }
+
+            render(data);
+        } catch (error) {
+            container.replaceChildren(element('p', 'text-danger', error.message));
+        }
+    };
+
+    document.addEventListener('DOMContentLoaded', () => {
+        const tab = document.getElementById('timeline-tab');
+        if (!tab) {
+            return;
+        }
+
+        // the timeline is fetched each time its tab is opened, as reservations may
+        // have been moved on the calendar meanwhile
+        tab.addEventListener('shown.bs.tab', load);
+
+        document.querySelectorAll('[data-timeline]').forEach((button) => {
+            button.addEventListener('click', () => {
+                switch (button.dataset.timeline) {
+                    case 'prev':
+                        start = addDays(start, -days);
+                        break;
+                    case 'next':
+                        start = addDays(start, days);
+                        break;
+                    default:
+                        start = today();
+                }
+                load();
+            });
+        });
+    });
+})();
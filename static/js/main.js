@@ -142,6 +142,8 @@ const Prompt = () => {
 	};
 };
 
+const formatMoney = (cents) => `$${(cents / 100).toFixed(2)}`;
+
 const roomAvailability = () => {
 	const btn = document.getElementById('search-availability');
 	if (!btn) return;
@@ -191,10 +193,19 @@ const roomAvailability = () => {
 						const data = await response.json();
 
 						if (data.ok) {
+							const total = data.quote
+								? `<p>Total for your stay: <strong>${formatMoney(data.quote.total)}</strong></p>`
+								: '';
+
 							alert.custom({
 								icon: "success",
 								title: data.message,
-								msg: `<a href="/book" class="btn btn-primary">Book Now</a>`,
+								msg: `${total}<a href="/book" class="btn btn-primary">Book Now</a>
+									<form action="/cart/add" method="POST" class="d-inline">
+										<input type="hidden" name="csrf_token" value="${formData.get('csrf_token')}">
+										<input type="hidden" name="room_id" value="${room_id.dataset.roomId}">
+										<button type="submit" class="btn btn-outline-primary">Add to Cart</button>
+									</form>`,
 								showCancelButton: false,
 								showConfirmButton: false,
 								allowOutsideClick: true,
@@ -226,10 +237,34 @@ const displayMessages = async () => {
 	};
 };
 
+const confirmCancellation = () => {
+	const form = document.getElementById('cancel-reservation');
+	if (!form) return;
+
+	form.addEventListener('submit', (e) => {
+		e.preventDefault();
+
+		Prompt().custom({
+			icon: "warning",
+			msg: "Are you sure you want to cancel this reservation?",
+			showCancelButton: true,
+			allowOutsideClick: true,
+			confirmButtonText: "Yes, cancel it",
+			cancelButtonText: "Keep it",
+			callback: (result) => {
+				if (result) {
+					form.submit();
+				}
+			},
+		});
+	});
+};
+
 document.addEventListener('DOMContentLoaded', () => {
 	'use strict'
 
 	drawDatePicker();
+	confirmCancellation();
 	roomAvailability();
 	displayMessages();
 });
\ No newline at end of file